@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/**
+every request carries an API key or a JWT
+	X-API-Key: <key>
+	Authorization: Bearer <key or JWT>
+keys are listed in the config with their user and role,
+a JWT is signed with HS256 and the configured secret, sub is the user, role the role, exp is checked when set
+
+with no key and no secret authentication is disabled, every request runs as NoAuth
+**/
+
+const (
+	RoleAdmin  = "admin"  // every document and the /admin endpoints
+	RoleUser   = "user"   // writes its own documents, finds public documents and its own
+	RoleReader = "reader" // only searches, finds public documents and its own
+)
+
+// user a request runs as
+type User struct {
+	Name string
+	Role string
+}
+
+// user of every request when authentication is disabled, it sees and changes every document
+var NoAuth = User{Role: RoleAdmin}
+
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+func (u User) CanWrite() bool {
+	return u.Role == RoleAdmin || u.Role == RoleUser
+}
+
+// API key of a user
+type Key struct {
+	Key  string `yaml:"key" toml:"key"`
+	User string `yaml:"user" toml:"user"`
+	Role string `yaml:"role" toml:"role"` // user if empty
+}
+
+type Config struct {
+	Keys      []Key  `yaml:"keys" toml:"keys"`
+	JWTSecret string `yaml:"jwtSecret" toml:"jwtSecret"` // HS256 secret of bearer tokens, JWT are refused if empty
+}
+
+var (
+	ErrUnauthorized = errors.New("missing or invalid credentials")
+	ErrInvalidRole  = errors.New("unknown role")
+)
+
+type Authenticator struct {
+	keys   map[[sha256.Size]byte]User // by hash of the key, a lookup does not compare the key byte by byte
+	secret []byte
+}
+
+func New(config Config) (*Authenticator, error) {
+	a := &Authenticator{
+		keys:   make(map[[sha256.Size]byte]User),
+		secret: []byte(config.JWTSecret),
+	}
+	for _, key := range config.Keys {
+		if key.Key == "" || key.User == "" {
+			return nil, fmt.Errorf("api key of user %q : key and user are required", key.User)
+		}
+		role := key.Role
+		if role == "" {
+			role = RoleUser
+		}
+		if !ValidRole(role) {
+			return nil, fmt.Errorf("api key of user %q : %w %q", key.User, ErrInvalidRole, role)
+		}
+		hash := sha256.Sum256([]byte(key.Key))
+		if _, ok := a.keys[hash]; ok {
+			return nil, fmt.Errorf("api key of user %q is listed twice", key.User)
+		}
+		a.keys[hash] = User{Name: key.User, Role: role}
+	}
+	return a, nil
+}
+
+// check if role is admin, user or reader
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleUser || role == RoleReader
+}
+
+// check if a key or a secret is configured
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0 || len(a.secret) > 0
+}
+
+// user of the credentials of r, NoAuth when authentication is disabled
+func (a *Authenticator) Authenticate(r *http.Request) (User, error) {
+	if !a.Enabled() {
+		return NoAuth, nil
+	}
+	credential := r.Header.Get("X-API-Key")
+	if credential == "" {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return User{}, ErrUnauthorized
+		}
+		credential = strings.TrimSpace(bearer)
+	}
+	if user, ok := a.keys[sha256.Sum256([]byte(credential))]; ok {
+		return user, nil
+	}
+	if strings.Count(credential, ".") == 2 && len(a.secret) > 0 {
+		return a.verify(credential, time.Now())
+	}
+	return User{}, ErrUnauthorized
+}
+
+// claims of a token, other claims are ignored
+type claims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+/**
+1. Split header.payload.signature, header must name HS256
+2. Compare the signature with the HMAC-SHA256 of header.payload in constant time
+3. Check exp and nbf against now, sub and role
+
+returns the user of sub with role, user if role is empty
+**/
+
+func (a *Authenticator) verify(token string, now time.Time) (User, error) {
+	parts := strings.Split(token, ".")
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return User{}, ErrUnauthorized
+	}
+	var head struct {
+		Alg string `json:"alg"`
+	}
+	if json.Unmarshal(header, &head) != nil || head.Alg != "HS256" {
+		return User{}, ErrUnauthorized
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return User{}, ErrUnauthorized
+	}
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return User{}, ErrUnauthorized
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return User{}, ErrUnauthorized
+	}
+	var c claims
+	if json.Unmarshal(payload, &c) != nil || c.Subject == "" {
+		return User{}, ErrUnauthorized
+	}
+	if (c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt) || (c.NotBefore != 0 && now.Unix() < c.NotBefore) {
+		return User{}, ErrUnauthorized
+	}
+	if c.Role == "" {
+		c.Role = RoleUser
+	}
+	if !ValidRole(c.Role) {
+		return User{}, ErrUnauthorized
+	}
+	return User{Name: c.Subject, Role: c.Role}, nil
+}
+
+// HS256 token of user valid until expires, handed out by the token command
+func Sign(secret string, user User, expires time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, _ := json.Marshal(claims{Subject: user.Name, Role: user.Role, ExpiresAt: expires.Unix()})
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthenticate(t *testing.T) {
+	a, err := New(Config{
+		Keys: []Key{
+			{Key: "alice-key", User: "alice"},
+			{Key: "root-key", User: "root", Role: RoleAdmin},
+		},
+		JWTSecret: "secret",
+	})
+	if err != nil {
+		t.Fatalf("New() = %v want <nil>", err)
+	}
+	bob := User{Name: "bob", Role: RoleReader}
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+
+	testCase := []struct {
+		name   string
+		header string
+		value  string
+		want   User
+		err    error
+	}{
+		{"api key", "X-API-Key", "alice-key", User{Name: "alice", Role: RoleUser}, nil},
+		{"bearer key", "Authorization", "Bearer root-key", User{Name: "root", Role: RoleAdmin}, nil},
+		{"jwt", "Authorization", "Bearer " + Sign("secret", bob, future), bob, nil},
+		{"expired jwt", "Authorization", "Bearer " + Sign("secret", bob, past), User{}, ErrUnauthorized},
+		{"jwt of another secret", "Authorization", "Bearer " + Sign("other", bob, future), User{}, ErrUnauthorized},
+		{"jwt of unknown role", "Authorization", "Bearer " + Sign("secret", User{Name: "bob", Role: "owner"}, future), User{}, ErrUnauthorized},
+		{"unknown key", "X-API-Key", "mallory-key", User{}, ErrUnauthorized},
+		{"basic auth", "Authorization", "Basic YWxpY2U6a2V5", User{}, ErrUnauthorized},
+		{"no credentials", "", "", User{}, ErrUnauthorized},
+	}
+	for _, test := range testCase {
+		r := httptest.NewRequest("GET", "/search", nil)
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		user, err := a.Authenticate(r)
+		if user != test.want || !errors.Is(err, test.err) {
+			t.Errorf("Authenticate(%s) = %v, %v want %v, %v", test.name, user, err, test.want, test.err)
+		}
+	}
+}
+
+func TestAuthenticateDisabled(t *testing.T) {
+	a, _ := New(Config{})
+	user, err := a.Authenticate(httptest.NewRequest("GET", "/search", nil))
+	if a.Enabled() || user != NoAuth || err != nil {
+		t.Errorf("Authenticate() = %v, %v want %v, <nil> without keys and secret", user, err, NoAuth)
+	}
+	if _, err := New(Config{Keys: []Key{{Key: "k", User: "u", Role: "owner"}}}); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("New(role owner) = %v want %v", err, ErrInvalidRole)
+	}
+}
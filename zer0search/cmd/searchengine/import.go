@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"searchengine/importer"
+	"searchengine/schema"
+	"searchengine/services"
+)
+
+// searchengine import [flags] dir
+// index every text, Markdown and JSON file under dir, the server must not run on the same index
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	opts := indexFlags(flags)
+	batchSize := flags.Int("batch", 500, "documents indexed at once")
+	field := flags.String("field", schema.DefaultField, "field of the text of .txt and .md files")
+	owner := flags.String("owner", "", "user owning the imported documents, no owner if empty")
+	private := flags.Bool("private", false, "only the owner and admins find the imported documents")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: searchengine import [flags] dir")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	engineService, closeAll := openIndex(opts.load(), opts)
+	defer closeAll()
+
+	im := importer.New(engineService, *batchSize)
+	im.Field = *field
+	im.Access = services.Access{Owner: *owner, Private: *private}
+	im.OnResult = func(result importer.Result) {
+		if result.Err == nil {
+			return
+		}
+		if result.Line > 0 {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", result.Source, result.Line, result.Err)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", result.Source, result.Err)
+		}
+	}
+	err := im.ImportDir(flags.Arg(0))
+	im.Flush()
+	fmt.Println(im.Stats())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		closeAll()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"searchengine/config"
+	"searchengine/db"
+	"searchengine/logging"
+	memorymapper "searchengine/memory_mapper"
+	"searchengine/repositories"
+	"searchengine/schema"
+	"searchengine/services"
+	"searchengine/tokenizer"
+	"searchengine/utils"
+	"sync"
+)
+
+// flags of the index shared by the server and the commands
+type indexOptions struct {
+	flags   *flag.FlagSet
+	config  *config.Flags
+	reset   *bool
+	restore *string
+}
+
+func indexFlags(flags *flag.FlagSet) *indexOptions {
+	return &indexOptions{
+		flags:   flags,
+		config:  config.RegisterFlags(flags),
+		reset:   flags.Bool("reset", false, "delete the stored index and documents on startup"),
+		restore: flags.String("restore", "", "replace the index and documents with a snapshot, a directory or .tar.gz, before opening it"),
+	}
+}
+
+// config of the command line, after flags.Parse(), the default logger is set up with it
+func (opts *indexOptions) load() config.Config {
+	cfg, err := opts.config.Load(opts.flags)
+	if err != nil {
+		panic(err)
+	}
+	logger, err := logging.New(cfg.Log, os.Stderr)
+	if err != nil {
+		panic(err)
+	}
+	slog.SetDefault(logger)
+	return cfg
+}
+
+/**
+1. Open the document store, mysql or docs.dat
+2. Delete the stored index and documents on -reset, or replace them with the snapshot of -restore
+3. Open the segments and every shared index file
+4. Load the analyzer and the schema the index is built with
+5. Restore the engine, start merging segments in the background
+
+returns the engine and a func closing every file, see closeIndex()
+**/
+
+func openIndex(cfg config.Config, opts *indexOptions) (*services.EngineService, func() error) {
+	var newDb *sql.DB
+	var err error
+	switch cfg.Store {
+	case "file":
+	case "mysql":
+		newDb, err = db.NewDocumentMysqlDb(cfg.MySQL)
+		if err != nil {
+			panic(err)
+		}
+	default:
+		panic("unknown document store " + cfg.Store)
+	}
+
+	indexOpts := cfg.IndexOptions()
+	slog.Info("[index.go] data directory", "path", indexOpts.Dir)
+
+	if *opts.reset {
+		if newDb != nil {
+			if err := db.ResetDocumentTable(newDb); err != nil {
+				panic(err)
+			}
+		}
+		if err := memorymapper.RemoveIndexFiles(indexOpts); err != nil {
+			panic(err)
+		}
+	}
+
+	if *opts.restore != "" {
+		// a snapshot holds docs.dat, mysql keeps its own documents
+		if newDb != nil {
+			panic("-restore needs the file document store")
+		}
+		info, err := memorymapper.RestoreSnapshot(indexOpts, *opts.restore)
+		if err != nil {
+			panic(err)
+		}
+		slog.Info("[index.go] snapshot restored", "path", *opts.restore, "created", info.Created, "lastDocId", info.LastDocId)
+	}
+
+	newSegments, err := memorymapper.NewSegments(indexOpts)
+	if err != nil {
+		panic(err)
+	}
+
+	newNorms, err := memorymapper.NewNorms(indexOpts)
+	if err != nil {
+		panic(err)
+	}
+
+	newTombstones, err := memorymapper.NewTombstones(indexOpts)
+	if err != nil {
+		panic(err)
+	}
+
+	newWAL, err := memorymapper.NewWAL(indexOpts)
+	if err != nil {
+		panic(err)
+	}
+
+	newTerms, err := memorymapper.NewTerms(indexOpts)
+	if err != nil {
+		panic(err)
+	}
+
+	newAccess, err := memorymapper.NewAccess(indexOpts)
+	if err != nil {
+		panic(err)
+	}
+
+	var docRepo repositories.DocumentStore
+	var newDocs *memorymapper.Documents
+	if newDb != nil {
+		docRepo = repositories.NewDocumentRepo(newDb)
+	} else {
+		newDocs, err = memorymapper.NewDocuments(indexOpts)
+		if err != nil {
+			panic(err)
+		}
+		docRepo = repositories.NewFileDocumentRepo(newDocs)
+	}
+
+	var engineService *services.EngineService
+	var closeOnce sync.Once
+	var closeErr error
+	closeAll := func() error {
+		closeOnce.Do(func() {
+			closeErr = closeIndex(engineService, newSegments, newDb, newDocs, newNorms, newTombstones, newWAL, newTerms, newAccess)
+		})
+		return closeErr
+	}
+
+	// an index keeps the analyzer it was built with, an index built before analyzers were stored used simple
+	analyzerName := cfg.Analyzer
+	analyzerPath := filepath.Join(indexOpts.Dir, memorymapper.AnalyzerFile)
+	if !utils.FileExists(analyzerPath) && len(newSegments.Infos()) > 0 {
+		analyzerName = "simple"
+	}
+	analyzer, err := tokenizer.Load(analyzerPath, analyzerName)
+	if err != nil {
+		panic(err)
+	}
+	slog.Info("[index.go] analyzer", "config", analyzer.Config())
+
+	// an index keeps the schema it was built with, an index built before schemas holds plain text documents
+	schemaFile := cfg.Schema
+	schemaPath := filepath.Join(indexOpts.Dir, memorymapper.SchemaFile)
+	if !utils.FileExists(schemaPath) && len(newSegments.Infos()) > 0 {
+		schemaFile = ""
+	}
+	docSchema, err := schema.Load(schemaPath, schemaFile)
+	if err != nil {
+		panic(err)
+	}
+	slog.Info("[index.go] schema", "fields", docSchema.Fields)
+
+	indexRepo := repositories.NewIndexRepo(newSegments, newNorms, newTombstones, newWAL, newTerms, newAccess)
+	engineService = services.NewEngineService(indexRepo, docRepo, analyzer, docSchema)
+	if err := engineService.Restore(context.Background()); err != nil {
+		panic(err)
+	}
+	go indexRepo.MergeLoop()
+	return engineService, closeAll
+}
+
+/**
+close in dependency order, every step waits for the ones using the files it closes
+1. Close the engine, it waits for the running writes and searches, flushes the buffer as a segment and refuses later calls
+2. Close the segments, it waits for a running merge, which reads tombstones.index
+3. Close the document store
+4. Close access.index, terms.index, norms.index and tombstones.index
+5. Close index.wal last, a crash before it still rolls back an unfinished insert
+every mapped file is msynced, fsynced and cut to its length as it is closed
+
+a failed step does not stop the next ones, returns every error
+**/
+
+func closeIndex(engineService *services.EngineService, segments *memorymapper.Segments, mysqlDb *sql.DB, docs *memorymapper.Documents,
+	norms *memorymapper.Norms, tombstones *memorymapper.Tombstones, wal *memorymapper.WAL, terms *memorymapper.Terms, access *memorymapper.Access) error {
+	errs := make([]error, 0)
+	step := func(name string, err error) {
+		if err != nil {
+			slog.Error("[index.go] [closeIndex()] close failed", "step", name, "err", err)
+			errs = append(errs, fmt.Errorf("%s : %w", name, err))
+		}
+	}
+	if engineService != nil {
+		step("engine", engineService.Close(context.Background()))
+	}
+	step("segments", segments.Close())
+	if mysqlDb != nil {
+		step("mysql", mysqlDb.Close())
+	}
+	if docs != nil {
+		step("documents", docs.Close())
+	}
+	step("access", access.Close())
+	step("terms", terms.Close())
+	step("norms", norms.Close())
+	step("tombstones", tombstones.Close())
+	step("wal", wal.Close())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"searchengine/services"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// searchengine inspect [flags] [term]
+// print the usage of the index and its top terms, or every posting of term
+// with -server "" the index is opened directly, the server must not run on the same index
+func runInspect(args []string) {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	opts := indexFlags(flags)
+	server := flags.String("server", "http://localhost:8080", "server to inspect, empty to open the index directly")
+	key := flags.String("key", os.Getenv("ZER0_API_KEY"), "api key or JWT of an admin of the server, ZER0_API_KEY if empty")
+	top := flags.Int("top", 10, "number of terms of the most documents to print")
+	asJSON := flags.Bool("json", false, "print the JSON of GET /stats instead of a table")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: searchengine inspect [flags] [term]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var stats services.IndexStats
+	var postings struct {
+		Term     string                 `json:"term"`
+		Postings []services.TermPosting `json:"postings"`
+	}
+	var err error
+	switch {
+	case *server == "":
+		engineService, closeAll := openIndex(opts.load(), opts)
+		if flags.NArg() == 1 {
+			postings.Term = flags.Arg(0)
+			postings.Postings, err = engineService.TermPostings(context.Background(), postings.Term)
+		} else {
+			stats, err = engineService.Stats(context.Background(), *top)
+		}
+		closeAll()
+	case flags.NArg() == 1:
+		err = getJSON(*server+"/stats/terms/"+url.PathEscape(flags.Arg(0)), *key, &postings)
+	default:
+		err = getJSON(*server+"/stats?top="+strconv.Itoa(*top), *key, &stats)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if flags.NArg() == 1 {
+			encoder.Encode(postings)
+		} else {
+			encoder.Encode(stats)
+		}
+		return
+	}
+	if flags.NArg() == 1 {
+		printPostings(postings.Term, postings.Postings)
+		return
+	}
+	printStats(stats)
+}
+
+// decode the JSON response of a GET on the server into v
+func getJSON(target, key string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s : %s", resp.Status, strings.TrimSpace(string(out)))
+	}
+	return json.Unmarshal(out, v)
+}
+
+func printStats(stats services.IndexStats) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "documents\t%d\t(%d deleted)\n", stats.Documents, stats.Deleted)
+	fmt.Fprintf(w, "vocabulary\t%d\t(%d in terms.index)\n", stats.Vocabulary, stats.Terms)
+	fmt.Fprintf(w, "postings\t%d bytes live\t%d bytes dead\n", stats.LiveBytes, stats.DeadBytes)
+	fmt.Fprintf(w, "buffer\t%d documents\t%d bytes\n", stats.BufferDocs, stats.BufferBytes)
+	w.Flush()
+
+	fmt.Printf("\nsegments\n")
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "name\tdocIds\twords\tbytes\tlive\tdead\tdead postings\t")
+	for _, seg := range stats.Segments {
+		fmt.Fprintf(w, "%s\t%d-%d\t%d\t%d\t%d\t%d\t%d\t\n", seg.Name, seg.MinDocId, seg.MaxDocId, seg.Words, seg.Bytes, seg.LiveBytes, seg.DeadBytes, seg.DeadPostings)
+	}
+	w.Flush()
+
+	fmt.Printf("\nfiles, fill against max file size %d bytes\n", stats.MaxFileSize)
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "name\tbytes\tfill\t")
+	for _, file := range stats.Files {
+		fmt.Fprintf(w, "%s\t%d\t%.4f%%\t\n", file.Name, file.Bytes, 100*file.Fill)
+	}
+	w.Flush()
+
+	if len(stats.TopTerms) == 0 {
+		return
+	}
+	fmt.Printf("\ntop terms\n")
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "term\tdocuments\t")
+	for _, term := range stats.TopTerms {
+		fmt.Fprintf(w, "%s\t%d\t\n", term.Term, term.DocFreq)
+	}
+	w.Flush()
+}
+
+func printPostings(term string, postings []services.TermPosting) {
+	fmt.Printf("%s : %d postings\n", term, len(postings))
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "segment\tdocId\tfreq\tpositions\t")
+	for _, posting := range postings {
+		deleted := ""
+		if posting.Deleted {
+			deleted = "deleted"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%v\t%s\n", posting.Segment, posting.DocId, posting.Freq, posting.Positions, deleted)
+	}
+	w.Flush()
+}
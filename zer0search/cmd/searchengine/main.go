@@ -1,74 +1,127 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"searchengine/db"
+	"searchengine/auth"
 	"searchengine/handler"
-	memorymapper "searchengine/memory_mapper"
-	"searchengine/repositories"
-	"searchengine/services"
-	"searchengine/utils"
+	"searchengine/metrics"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-
-	path, err := os.Getwd()
-	if err != nil {
-		panic(err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			runImport(os.Args[2:])
+			return
+		case "snapshot":
+			runSnapshot(os.Args[2:])
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		case "token":
+			runToken(os.Args[2:])
+			return
+		case "inspect":
+			runInspect(os.Args[2:])
+			return
+		}
 	}
 
-	utils.Path = filepath.Join(path, "../../")
+	opts := indexFlags(flag.CommandLine)
+	flag.Parse()
 
-	newDb, err := db.NewDocumentMysqlDb()
-	if err != nil {
-		panic(err)
-	}
-	defer newDb.Close()
+	cfg := opts.load()
+	engineService, closeAll := openIndex(cfg, opts)
 
-	newDict, err := memorymapper.NewDictionary()
+	authenticator, err := auth.New(cfg.Auth)
 	if err != nil {
 		panic(err)
 	}
-	defer newDict.Close()
+	if !authenticator.Enabled() {
+		slog.Warn("[main.go] no api key and no jwt secret configured, authentication is disabled")
+	}
 
-	newPost, err := memorymapper.NewPosting()
-	if err != nil {
+	if err := metrics.RegisterIndex(engineService); err != nil {
 		panic(err)
 	}
-	defer newPost.Close()
-
-	newHasher := utils.NewHash()
-
-	// On shutdown CTRL + C
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	go func(newDb *sql.DB, newDict *memorymapper.Dictionary, newPost *memorymapper.Posting) {
-		sig := <-sigChan
-		fmt.Println("Received: ", sig)
-		newDict.Close()
-		newDb.Close()
-		newPost.Close()
-		os.Exit(0)
-	}(newDb, newDict, newPost)
-
-	docRepo := repositories.NewDocumentRepo(newDb)
-	indexRepo := repositories.NewIndexRepo(newDict, newPost)
-	engineService := services.NewEngineService(indexRepo, docRepo, newHasher)
-	engineHandler := handler.NewEngineHandler(engineService)
-
-	router := gin.Default()
-	router.Static("/", filepath.Join(utils.Path, "static"))
 
+	engineHandler := handler.NewEngineHandler(engineService, cfg.Static)
+
+	router := gin.New()
+	router.Use(gin.Recovery(), handler.RequestID, handler.Logger)
+	// files of cfg.Static are served by NoRoute, a /*filepath route conflicts with every other GET route
 	router.NoRoute(engineHandler.FrontPage)
-	router.POST("/insert", engineHandler.Index)
-	router.POST("/search", engineHandler.Search)
+	api := router.Group("/", handler.Authenticate(authenticator))
+	api.POST("/insert", engineHandler.Index)
+	api.POST("/bulk", engineHandler.Bulk)
+	api.POST("/search", engineHandler.Search)
+	api.DELETE("/documents/:id", engineHandler.Delete)
+	api.PUT("/documents/:id", engineHandler.Update)
+	api.GET("/stats", handler.RequireAdmin, engineHandler.Stats)
+	api.GET("/stats/terms/:term", handler.RequireAdmin, engineHandler.TermPostings)
+	api.GET("/metrics", handler.RequireAdmin, handler.Metrics)
+	admin := api.Group("/admin", handler.RequireAdmin)
+	admin.POST("/compact", engineHandler.Compact)
+	admin.POST("/snapshot", engineHandler.Snapshot)
 
-	router.Run(":8080")
+	if err := serve(&http.Server{Addr: cfg.Listen, Handler: router}, cfg.ShutdownDuration(), closeAll); err != nil {
+		os.Exit(1)
+	}
+}
+
+/**
+1. Serve until SIGINT or SIGTERM, a second signal kills the process at once
+2. Stop accepting connections, wait up to timeout for the in-flight requests to finish
+3. Cancel the context of the requests still running, so their mysql queries stop
+4. Close the index, the engine waits for the requests still inside it and refuses the later ones
+	the index files are never unmapped under a running handler
+
+returns an error if the server failed or the index did not close cleanly
+**/
+
+func serve(server *http.Server, timeout time.Duration, closeAll func() error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	server.BaseContext = func(net.Listener) context.Context { return requestCtx }
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	slog.Info("[main.go] [serve()] listening", "addr", server.Addr)
+
+	var err error
+	select {
+	case err = <-serveErr:
+		slog.Error("[main.go] [serve()] server failed", "err", err)
+	case <-ctx.Done():
+		stop()
+		slog.Info("[main.go] [serve()] shutting down, draining in-flight requests", "timeout", timeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+			slog.Warn("[main.go] [serve()] requests still running after the timeout, cancelling them", "err", shutdownErr)
+		}
+		cancelRequests()
+	}
+
+	if closeErr := closeAll(); closeErr != nil {
+		return errors.Join(err, closeErr)
+	}
+	slog.Info("[main.go] [serve()] index closed")
+	return err
 }
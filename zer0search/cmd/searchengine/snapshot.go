@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// searchengine snapshot [flags] path
+// take a snapshot of the index of a running server into path, a new directory or a .tar.gz file
+// with -server "" the index is opened directly, the server must not run on the same index
+func runSnapshot(args []string) {
+	flags := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	opts := indexFlags(flags)
+	server := flags.String("server", "http://localhost:8080", "server taking the snapshot, empty to open the index directly")
+	key := flags.String("key", os.Getenv("ZER0_API_KEY"), "api key or JWT of an admin of the server, ZER0_API_KEY if empty")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: searchengine snapshot [flags] path")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	// the server resolves the path, it runs on this host
+	path, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *server == "" {
+		engineService, closeAll := openIndex(opts.load(), opts)
+		info, err := engineService.Snapshot(context.Background(), path)
+		closeAll()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("snapshot %s : %d files, %d bytes, last docId %d\n", path, info.Files, info.Bytes, info.LastDocId)
+		return
+	}
+
+	body, _ := json.Marshal(map[string]string{"path": path})
+	req, err := http.NewRequest(http.MethodPost, *server+"/admin/snapshot", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if *key != "" {
+		req.Header.Set("Authorization", "Bearer "+*key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	out, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "%s : %s\n", resp.Status, out)
+		os.Exit(1)
+	}
+	fmt.Println(string(out))
+}
+
+// searchengine restore [flags] path
+// replace the index and documents with the snapshot at path and check it opens, the server must not run
+func runRestore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	opts := indexFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: searchengine restore [flags] path")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	*opts.restore = flags.Arg(0)
+
+	// openIndex() panics if the restored index does not match its documents
+	_, closeAll := openIndex(opts.load(), opts)
+	closeAll()
+	fmt.Printf("restored %s\n", flags.Arg(0))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"searchengine/auth"
+	"searchengine/config"
+	"time"
+)
+
+// searchengine token [flags]
+// print a JWT of a user signed with the jwtSecret of the config, sent as Authorization: Bearer <token>
+func runToken(args []string) {
+	flags := flag.NewFlagSet("token", flag.ExitOnError)
+	settings := config.RegisterFlags(flags)
+	user := flags.String("user", "", "user the token is issued to")
+	role := flags.String("role", auth.RoleUser, "role of the user, admin, user or reader")
+	ttl := flags.Duration("ttl", 24*time.Hour, "time the token is valid for")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: searchengine token -user name [flags]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *user == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	cfg, err := settings.Load(flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if cfg.Auth.JWTSecret == "" {
+		fmt.Fprintln(os.Stderr, "no jwtSecret configured, set auth.jwtSecret or ZER0_JWT_SECRET")
+		os.Exit(1)
+	}
+	if !auth.ValidRole(*role) {
+		fmt.Fprintf(os.Stderr, "%v %q\n", auth.ErrInvalidRole, *role)
+		os.Exit(1)
+	}
+	fmt.Println(auth.Sign(cfg.Auth.JWTSecret, auth.User{Name: *user, Role: *role}, time.Now().Add(*ttl)))
+}
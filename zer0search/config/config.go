@@ -0,0 +1,351 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"searchengine/auth"
+	"searchengine/db"
+	"searchengine/logging"
+	memorymapper "searchengine/memory_mapper"
+	"searchengine/tokenizer"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+/**
+settings of the server and the commands, every layer overrides the one before
+1. Defaults of Default()
+2. The YAML (.yaml, .yml) or TOML (.toml) file of -config or ZER0_CONFIG, missing keys keep their value
+3. ZER0_ env vars, see vars()
+4. Flags given on the command line, see RegisterFlags()
+
+the loaded Config is handed to the constructors, no package keeps a copy
+**/
+
+type Config struct {
+	DataDir         string         `yaml:"dataDir" toml:"dataDir"`                 // directory holding memory_mapper/
+	Static          string         `yaml:"static" toml:"static"`                   // directory of the front page, DataDir/static if empty
+	Listen          string         `yaml:"listen" toml:"listen"`                   // address the server listens on
+	ShutdownTimeout string         `yaml:"shutdownTimeout" toml:"shutdownTimeout"` // time in-flight requests get to finish on SIGINT or SIGTERM, a Go duration
+	Store           string         `yaml:"store" toml:"store"`                     // document store, file (embedded docs.dat) or mysql
+	Analyzer        string         `yaml:"analyzer" toml:"analyzer"`               // analyzer of a new index, simple, standard, english or charFilters|tokenizer|tokenFilters
+	Schema          string         `yaml:"schema" toml:"schema"`                   // JSON schema file of a new index, plain text documents if empty
+	MySQL           db.Config      `yaml:"mysql" toml:"mysql"`
+	Index           Index          `yaml:"index" toml:"index"`
+	Auth            auth.Config    `yaml:"auth" toml:"auth"` // API keys and JWT secret, authentication is disabled without them
+	Log             logging.Config `yaml:"log" toml:"log"`
+}
+
+// sizes of the index files, sizes are in bytes
+type Index struct {
+	InitialFileSize uint64 `yaml:"initialFileSize" toml:"initialFileSize"`
+	MaxFileSize     uint64 `yaml:"maxFileSize" toml:"maxFileSize"`
+	FlushDocs       uint64 `yaml:"flushDocs" toml:"flushDocs"`
+	FlushBytes      uint64 `yaml:"flushBytes" toml:"flushBytes"`
+	MergeFactor     uint64 `yaml:"mergeFactor" toml:"mergeFactor"`
+	MergeFloorBytes uint64 `yaml:"mergeFloorBytes" toml:"mergeFloorBytes"`
+}
+
+const envPrefix = "ZER0_"
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// the repository root when run from cmd/searchengine, where the index was always kept
+func Default() Config {
+	opts := memorymapper.DefaultOptions("")
+	return Config{
+		DataDir:         "../..",
+		Listen:          ":8080",
+		ShutdownTimeout: "30s",
+		Store:           "file",
+		Analyzer:        "standard",
+		MySQL:           db.DefaultConfig(),
+		Log:             logging.DefaultConfig(),
+		Index: Index{
+			InitialFileSize: opts.InitialFileSize,
+			MaxFileSize:     opts.MaxFileSize,
+			FlushDocs:       opts.FlushDocs,
+			FlushBytes:      opts.FlushBytes,
+			MergeFactor:     opts.MergeFactor,
+			MergeFloorBytes: opts.MergeFloorBytes,
+		},
+	}
+}
+
+// defaults overridden by the file at path, ZER0_CONFIG if empty, and the env vars
+func Load(path string) (Config, error) {
+	return load(path, nil)
+}
+
+func load(path string, override func(c *Config)) (Config, error) {
+	if path == "" {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+	c := Default()
+	if path != "" {
+		if err := c.readFile(path); err != nil {
+			return c, err
+		}
+	}
+	if err := c.applyEnv(os.LookupEnv); err != nil {
+		return c, err
+	}
+	if override != nil {
+		override(&c)
+	}
+	return c, c.finish()
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(c)
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(c)
+	default:
+		return fmt.Errorf("%s : %w, unknown format, use .yaml, .yml or .toml", path, ErrInvalidConfig)
+	}
+	if err != nil {
+		return fmt.Errorf("%s : %w", path, err)
+	}
+	return nil
+}
+
+// settings overridden by env vars, named without the ZER0_ prefix
+func (c *Config) vars() (map[string]*string, map[string]*uint64) {
+	strs := map[string]*string{
+		"DATA_DIR":         &c.DataDir,
+		"STATIC":           &c.Static,
+		"LISTEN":           &c.Listen,
+		"SHUTDOWN_TIMEOUT": &c.ShutdownTimeout,
+		"STORE":            &c.Store,
+		"ANALYZER":         &c.Analyzer,
+		"SCHEMA":           &c.Schema,
+		"MYSQL_USER":       &c.MySQL.User,
+		"MYSQL_PASSWORD":   &c.MySQL.Password,
+		"MYSQL_HOST":       &c.MySQL.Host,
+		"MYSQL_PORT":       &c.MySQL.Port,
+		"MYSQL_DATABASE":   &c.MySQL.Database,
+		"JWT_SECRET":       &c.Auth.JWTSecret,
+		"LOG_FORMAT":       &c.Log.Format,
+		"LOG_LEVEL":        &c.Log.Level,
+	}
+	nums := map[string]*uint64{
+		"INITIAL_FILE_SIZE": &c.Index.InitialFileSize,
+		"MAX_FILE_SIZE":     &c.Index.MaxFileSize,
+		"FLUSH_DOCS":        &c.Index.FlushDocs,
+		"FLUSH_BYTES":       &c.Index.FlushBytes,
+		"MERGE_FACTOR":      &c.Index.MergeFactor,
+		"MERGE_FLOOR_BYTES": &c.Index.MergeFloorBytes,
+	}
+	return strs, nums
+}
+
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	strs, nums := c.vars()
+	for name, field := range strs {
+		if value, ok := lookup(envPrefix + name); ok {
+			*field = value
+		}
+	}
+	for name, field := range nums {
+		value, ok := lookup(envPrefix + name)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s%s : %w, %q is not a number", envPrefix, name, ErrInvalidConfig, value)
+		}
+		*field = n
+	}
+	return nil
+}
+
+// resolve the directories and check every setting
+func (c *Config) finish() error {
+	dataDir, err := filepath.Abs(c.DataDir)
+	if err != nil {
+		return err
+	}
+	c.DataDir = dataDir
+	if c.Static == "" {
+		c.Static = filepath.Join(c.DataDir, "static")
+	}
+	return c.Validate()
+}
+
+func (c Config) Validate() error {
+	var errs []string
+	if c.Listen == "" {
+		errs = append(errs, "listen is empty")
+	}
+	if timeout, err := time.ParseDuration(c.ShutdownTimeout); err != nil || timeout <= 0 {
+		errs = append(errs, fmt.Sprintf("shutdownTimeout %q must be a positive duration like 30s", c.ShutdownTimeout))
+	}
+	if c.Store != "file" && c.Store != "mysql" {
+		errs = append(errs, fmt.Sprintf("unknown store %q, use file or mysql", c.Store))
+	}
+	if _, err := tokenizer.Named(c.Analyzer); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if c.Index.InitialFileSize == 0 || c.Index.InitialFileSize > c.Index.MaxFileSize {
+		errs = append(errs, "initialFileSize must be between 1 and maxFileSize")
+	}
+	if c.Index.FlushDocs == 0 || c.Index.FlushBytes == 0 {
+		errs = append(errs, "flushDocs and flushBytes must be positive")
+	}
+	if c.Index.MergeFactor < 2 {
+		errs = append(errs, "mergeFactor must be at least 2")
+	}
+	if c.Index.MergeFloorBytes == 0 {
+		errs = append(errs, "mergeFloorBytes must be positive")
+	}
+	if _, err := auth.New(c.Auth); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := c.Log.Validate(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w : %s", ErrInvalidConfig, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// time in-flight requests get to finish on shutdown, after Validate()
+func (c Config) ShutdownDuration() time.Duration {
+	timeout, _ := time.ParseDuration(c.ShutdownTimeout)
+	return timeout
+}
+
+// options of the index files under DataDir
+func (c Config) IndexOptions() memorymapper.Options {
+	return memorymapper.Options{
+		Dir:             c.DataDir,
+		InitialFileSize: c.Index.InitialFileSize,
+		MaxFileSize:     c.Index.MaxFileSize,
+		FlushDocs:       c.Index.FlushDocs,
+		FlushBytes:      c.Index.FlushBytes,
+		MergeFactor:     c.Index.MergeFactor,
+		MergeFloorBytes: c.Index.MergeFloorBytes,
+	}
+}
+
+// flag of every env var of vars(), name and usage
+var flagSettings = map[string]struct{ name, usage string }{
+	"DATA_DIR":          {"data", "data directory holding memory_mapper/"},
+	"STATIC":            {"static", "directory of the front page, <data>/static if empty"},
+	"LISTEN":            {"listen", "address the server listens on"},
+	"SHUTDOWN_TIMEOUT":  {"shutdown-timeout", "time in-flight requests get to finish on SIGINT or SIGTERM"},
+	"STORE":             {"store", "document store, file (embedded docs.dat) or mysql"},
+	"ANALYZER":          {"analyzer", "analyzer of a new index, simple, standard, english or a chain charFilters|tokenizer|tokenFilters"},
+	"SCHEMA":            {"schema", "JSON schema of the document fields of a new index, plain text documents if empty"},
+	"MYSQL_USER":        {"mysql-user", "user of the mysql store"},
+	"MYSQL_PASSWORD":    {"mysql-password", "password of the mysql store"},
+	"MYSQL_HOST":        {"mysql-host", "host of the mysql store"},
+	"MYSQL_PORT":        {"mysql-port", "port of the mysql store"},
+	"MYSQL_DATABASE":    {"mysql-database", "database of the mysql store"},
+	"JWT_SECRET":        {"jwt-secret", "HS256 secret of bearer tokens, JWT are refused if empty"},
+	"LOG_FORMAT":        {"log-format", "format of the logs, text or json"},
+	"LOG_LEVEL":         {"log-level", "lowest level logged, debug, info, warn or error"},
+	"INITIAL_FILE_SIZE": {"initial-file-size", "bytes an index file is mapped with when it is created"},
+	"MAX_FILE_SIZE":     {"max-file-size", "bytes no index file grows past"},
+	"FLUSH_DOCS":        {"flush-docs", "documents of the buffer written as a new segment"},
+	"FLUSH_BYTES":       {"flush-bytes", "posting bytes of the buffer written as a new segment"},
+	"MERGE_FACTOR":      {"merge-factor", "segments of a size tier merged into one"},
+	"MERGE_FLOOR_BYTES": {"merge-floor-bytes", "bytes smaller segments are counted as when they are tiered"},
+}
+
+// flags of the settings of a command, registered on its flag set
+type Flags struct {
+	file *string
+	strs map[string]*string // by env var name
+	nums map[string]*uint64 // by env var name
+	keys *keysFlag
+}
+
+// a flag for every setting, the API keys of -auth-key replace the keys of the file
+func RegisterFlags(flags *flag.FlagSet) *Flags {
+	defaults := Default()
+	strs, nums := defaults.vars()
+	f := &Flags{
+		file: flags.String("config", "", "YAML or TOML config file, ZER0_CONFIG if empty"),
+		strs: make(map[string]*string),
+		nums: make(map[string]*uint64),
+		keys: &keysFlag{},
+	}
+	for name, field := range strs {
+		setting := flagSettings[name]
+		f.strs[name] = flags.String(setting.name, *field, setting.usage)
+	}
+	for name, field := range nums {
+		setting := flagSettings[name]
+		f.nums[name] = flags.Uint64(setting.name, *field, setting.usage)
+	}
+	flags.Var(f.keys, "auth-key", "API key of a user, key:user or key:user:role, repeat it for every key")
+	return f
+}
+
+// config of the file, env vars and the flags set on flags, after flags.Parse()
+func (f *Flags) Load(flags *flag.FlagSet) (Config, error) {
+	return load(*f.file, func(c *Config) {
+		strs, nums := c.vars()
+		names := make(map[string]string, len(flagSettings))
+		for name, setting := range flagSettings {
+			names[setting.name] = name
+		}
+		// a flag left at its default does not hide the file or the env vars
+		flags.Visit(func(fl *flag.Flag) {
+			name := names[fl.Name]
+			switch {
+			case fl.Name == "auth-key":
+				c.Auth.Keys = *f.keys
+			case strs[name] != nil && f.strs[name] != nil:
+				*strs[name] = *f.strs[name]
+			case nums[name] != nil && f.nums[name] != nil:
+				*nums[name] = *f.nums[name]
+			}
+		})
+	})
+}
+
+// API keys of -auth-key key:user[:role], in the order given
+type keysFlag []auth.Key
+
+func (k *keysFlag) String() string {
+	users := make([]string, len(*k))
+	for i, key := range *k {
+		users[i] = key.User
+	}
+	return strings.Join(users, ",")
+}
+
+func (k *keysFlag) Set(value string) error {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("%w, want key:user or key:user:role", ErrInvalidConfig)
+	}
+	key := auth.Key{Key: parts[0], User: parts[1]}
+	if len(parts) == 3 {
+		key.Role = parts[2]
+	}
+	*k = append(*k, key)
+	return nil
+}
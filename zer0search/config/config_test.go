@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.yaml")
+	os.WriteFile(yamlFile, []byte("dataDir: /var/lib/zer0\nstore: mysql\nmysql:\n  password: secret\nindex:\n  maxFileSize: 1073741824\n"), 0644)
+	tomlFile := filepath.Join(dir, "config.toml")
+	os.WriteFile(tomlFile, []byte("dataDir = \"/var/lib/zer0\"\nstore = \"mysql\"\n[mysql]\npassword = \"secret\"\n[index]\nmaxFileSize = 1073741824\n"), 0644)
+
+	testCase := []string{yamlFile, tomlFile}
+	for _, path := range testCase {
+		c, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load(%s) = %v want <nil>", path, err)
+		}
+		if c.DataDir != "/var/lib/zer0" || c.Store != "mysql" || c.MySQL.Password != "secret" || c.Index.MaxFileSize != 1073741824 {
+			t.Errorf("Load(%s) = %+v want the settings of the file", path, c)
+		}
+		// missing keys keep their default
+		if c.Listen != ":8080" || c.MySQL.User != "root" || c.Index.MergeFactor != 4 || c.Static != "/var/lib/zer0/static" {
+			t.Errorf("Load(%s) = %+v want defaults for missing keys", path, c)
+		}
+	}
+}
+
+func TestLoadEnvFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("listen: \":9000\"\nanalyzer: simple\n"), 0644)
+	t.Setenv("ZER0_CONFIG", path)
+	t.Setenv("ZER0_ANALYZER", "english")
+	t.Setenv("ZER0_FLUSH_DOCS", "50")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := RegisterFlags(flags)
+	if err := flags.Parse([]string{"-data", "/tmp/zer0", "-analyzer", "standard"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := f.Load(flags)
+	if err != nil {
+		t.Fatalf("Load() = %v want <nil>", err)
+	}
+	// file < env < flags, a flag left at its default does not hide the file
+	if c.Listen != ":9000" || c.Analyzer != "standard" || c.DataDir != "/tmp/zer0" || c.Index.FlushDocs != 50 {
+		t.Errorf("Load() = %+v want listen of the file, analyzer and data of the flags, flushDocs of the env", c)
+	}
+	if opts := c.IndexOptions(); opts.Dir != "/tmp/zer0" || opts.FlushDocs != 50 {
+		t.Errorf("IndexOptions() = %+v want dir /tmp/zer0, flushDocs 50", opts)
+	}
+}
+
+func TestFlagPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("shutdownTimeout: 10s\nmysql:\n  host: file-host\nindex:\n  mergeFactor: 5\n  flushBytes: 1000\nauth:\n  keys:\n    - {key: file-key, user: bob}\nlog:\n  level: warn\n"), 0644)
+	t.Setenv("ZER0_CONFIG", path)
+	t.Setenv("ZER0_MYSQL_HOST", "env-host")
+	t.Setenv("ZER0_MERGE_FACTOR", "6")
+	t.Setenv("ZER0_LOG_LEVEL", "error")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := RegisterFlags(flags)
+	// every setting of an env var has a flag
+	defaults := Default()
+	strs, nums := defaults.vars()
+	for name := range strs {
+		if flags.Lookup(flagSettings[name].name) == nil {
+			t.Errorf("RegisterFlags() has no flag of %s%s", envPrefix, name)
+		}
+	}
+	for name := range nums {
+		if flags.Lookup(flagSettings[name].name) == nil {
+			t.Errorf("RegisterFlags() has no flag of %s%s", envPrefix, name)
+		}
+	}
+	args := []string{"-mysql-host", "flag-host", "-merge-factor", "8", "-log-level", "debug", "-static", "/srv/www", "-auth-key", "k1:alice:admin", "-auth-key", "k2:carol"}
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	c, err := f.Load(flags)
+	if err != nil {
+		t.Fatalf("Load() = %v want <nil>", err)
+	}
+	if len(c.Auth.Keys) != 2 {
+		t.Fatalf("Load() keys = %v want the 2 keys of the flags over the key of the file", c.Auth.Keys)
+	}
+
+	testCase := []struct {
+		setting string
+		got     any
+		want    any
+	}{
+		{"mysql host of the flag over env and file", c.MySQL.Host, "flag-host"},
+		{"mergeFactor of the flag over env and file", c.Index.MergeFactor, uint64(8)},
+		{"log level of the flag over env and file", c.Log.Level, "debug"},
+		{"static of the flag over the default", c.Static, "/srv/www"},
+		{"shutdownTimeout of the file", c.ShutdownTimeout, "10s"},
+		{"flushBytes of the file", c.Index.FlushBytes, uint64(1000)},
+		{"role of a key", c.Auth.Keys[0].Role, "admin"},
+		{"user of a key", c.Auth.Keys[1].User, "carol"},
+	}
+	for _, test := range testCase {
+		if test.got != test.want {
+			t.Errorf("Load() %s = %v want %v", test.setting, test.got, test.want)
+		}
+	}
+
+	flags = flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	RegisterFlags(flags)
+	if err := flags.Parse([]string{"-auth-key", "k1"}); err == nil {
+		t.Errorf("Parse(-auth-key k1) = <nil> want error for a key without user")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	testCase := []struct {
+		name    string
+		content string
+		env     map[string]string
+	}{
+		{"unknown.yaml", "dataDirectory: /tmp\n", nil},
+		{"store.toml", "store = \"sqlite\"\n", nil},
+		{"merge.yaml", "index:\n  mergeFactor: 1\n", nil},
+		{"sizes.yaml", "index:\n  initialFileSize: 4096\n  maxFileSize: 1024\n", nil},
+		{"log.yaml", "log:\n  level: verbose\n", nil},
+		{"shutdown.yaml", "shutdownTimeout: 30\n", nil},
+		{"analyzer.yaml", "analyzer: html\n", nil},
+		{"chain.yaml", "analyzer: \"html_strip|unicode|missing\"\n", nil},
+		{"env.yaml", "", map[string]string{"ZER0_MAX_FILE_SIZE": "16Gb"}},
+		{"config.json", "{}", nil},
+	}
+	for _, test := range testCase {
+		path := filepath.Join(dir, test.name)
+		os.WriteFile(path, []byte(test.content), 0644)
+		for name, value := range test.env {
+			t.Setenv(name, value)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load(%s) = <nil> want error", test.name)
+		}
+	}
+	if _, err := Load(filepath.Join(dir, "config.json")); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Load(config.json) = %v want %v", err, ErrInvalidConfig)
+	}
+}
@@ -18,29 +18,52 @@ CREATE TABLE items (
 );
 **/
 
-func NewDocumentMysqlDb() (*sql.DB, error) {
-	dsn := user + ":" + password + "@tcp(" + ip + ":" + port + ")/" + dbName
+// connection settings of the document database
+type Config struct {
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+	Host     string `yaml:"host" toml:"host"`
+	Port     string `yaml:"port" toml:"port"`
+	Database string `yaml:"database" toml:"database"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		User:     "root",
+		Password: "",
+		Host:     "127.0.0.1",
+		Port:     "3306",
+		Database: "testDb",
+	}
+}
+
+// open the document database, stored rows are kept across restarts
+func NewDocumentMysqlDb(config Config) (*sql.DB, error) {
+	dsn := config.User + ":" + config.Password + "@tcp(" + config.Host + ":" + config.Port + ")/" + config.Database
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		slog.Error(" [db.go] [NewDbService()] database open error ", err)
+		slog.Error("[db.go] [NewDocumentMysqlDb()] database open error", "host", config.Host, "database", config.Database, "err", err)
 		return nil, err
 	}
 	if err := db.Ping(); err != nil {
-		slog.Error(" [db.go] [NewDbService()] database ping error ", err)
+		slog.Error("[db.go] [NewDocumentMysqlDb()] database ping error", "host", config.Host, "database", config.Database, "err", err)
 		return nil, err
 	}
+	return db, nil
+}
 
+// delete every document and reset AUTO_INCREMENT, used to start from an empty index
+func ResetDocumentTable(db *sql.DB) error {
 	// DELETE database table
 	if _, err := db.Exec(deleteTable + tableName); err != nil {
-		slog.Error(" [db.go] [NewDbService()] database table delete error ", err)
-		return nil, err
+		slog.Error("[db.go] [ResetDocumentTable()] database table delete error", "err", err)
+		return err
 	}
 
 	// RESET AUTO_INCREMENT
 	if _, err := db.Exec(resetTable); err != nil {
-		slog.Error(" [db.go] [NewDbService()] database reset AUTO_INCREMENT error ", err)
-		return nil, err
+		slog.Error("[db.go] [ResetDocumentTable()] database reset AUTO_INCREMENT error", "err", err)
+		return err
 	}
-
-	return db, nil
+	return nil
 }
@@ -1,14 +1,11 @@
 package db
 
 var (
-	user        = "root"
-	password    = ""
-	ip          = "127.0.0.1"
-	port        = "3306"
-	dbName      = "testDb"
 	tableName   = "items"
-	InsertStmt  = "INSERT INTO items (content) VALUES (?)"
+	InsertStmt  = "INSERT INTO items (id, content) VALUES (?, ?)"
 	QueryStmt   = "SELECT content FROM items WHERE id = ?"
+	DeleteStmt  = "DELETE FROM items WHERE id = ?"
+	LastIdStmt  = "SELECT COALESCE(MAX(id), 0) FROM items"
 	deleteTable = "DELETE FROM "
 	resetTable  = "ALTER TABLE " + "items" + " AUTO_INCREMENT = 1"
 
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"searchengine/auth"
+	"searchengine/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const userKey = "user"
+
+// authenticate every request with a, a request without valid credentials gets 401
+func Authenticate(a *auth.Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := a.Authenticate(ctx.Request)
+		if err != nil {
+			ctx.AbortWithStatusJSON(401, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+		ctx.Set(userKey, user)
+		ctx.Next()
+	}
+}
+
+// let only admins through, after Authenticate()
+func RequireAdmin(ctx *gin.Context) {
+	if !currentUser(ctx).IsAdmin() {
+		ctx.AbortWithStatusJSON(403, gin.H{
+			"error": "admin role required",
+		})
+		return
+	}
+	ctx.Next()
+}
+
+// user set by Authenticate(), a request it did not run on finds public documents and writes nothing
+func currentUser(ctx *gin.Context) auth.User {
+	if user, ok := ctx.Get(userKey); ok {
+		return user.(auth.User)
+	}
+	return auth.User{}
+}
+
+// owner and visibility of a document user indexes
+// visibility is public or private, empty is private for a named user and public when authentication is disabled
+func documentAccess(user auth.User, visibility string) services.Access {
+	private := visibility == "private" || (visibility == "" && user.Name != "")
+	return services.Access{Owner: user.Name, Private: private}
+}
+
+func forbidden(ctx *gin.Context) {
+	ctx.JSON(403, gin.H{
+		"error": "forbidden",
+	})
+}
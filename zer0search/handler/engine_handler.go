@@ -1,70 +1,442 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	pathpkg "path"
 	"path/filepath"
-	"searchengine/models"
+	"searchengine/importer"
+	"searchengine/query"
+	"searchengine/schema"
 	"searchengine/services"
-	"searchengine/utils"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 type EngineHandler struct {
-	engine *services.EngineService
+	engine    *services.EngineService
+	staticDir string // directory of index.html
 }
 
+// a plain text document or the fields of a JSON document, one of them is required
+// visibility is public or private, a document keeps it when it is updated
 type DocumentRequest struct {
-	Document string `json:"document" binding:"required"`
+	Document   string         `json:"document" binding:"required_without=Fields"`
+	Fields     map[string]any `json:"fields" binding:"required_without=Document"`
+	Visibility string         `json:"visibility" binding:"omitempty,oneof=public private"`
 }
 
-func NewEngineHandler(engine *services.EngineService) *EngineHandler {
+// path of a snapshot on the server, a new directory or a .tar.gz file
+type SnapshotRequest struct {
+	Path string `json:"path" binding:"required"`
+}
+
+// document is the query, zero values take the defaults below
+type SearchRequest struct {
+	Document    string `json:"document" binding:"required"`
+	Limit       int    `json:"limit" binding:"min=0,max=100"`
+	Offset      int    `json:"offset" binding:"min=0"`
+	SnippetSize int    `json:"snippetSize" binding:"min=0,max=200"`
+	PreTag      string `json:"preTag"`
+	PostTag     string `json:"postTag"`
+}
+
+var (
+	DefaultLimit       = 10
+	DefaultSnippetSize = 30 // tokens
+	DefaultPreTag      = "<em>"
+	DefaultPostTag     = "</em>"
+	BulkBatchSize      = 500 // documents of POST /bulk indexed at once
+	DefaultStatsTop    = 10  // terms of GET /stats
+	MaxStatsTop        = 1000
+)
+
+func NewEngineHandler(engine *services.EngineService, staticDir string) *EngineHandler {
 	return &EngineHandler{
-		engine: engine,
+		engine:    engine,
+		staticDir: staticDir,
 	}
 }
 
 func (e *EngineHandler) Index(ctx *gin.Context) {
+	user := currentUser(ctx)
+	if !user.CanWrite() {
+		forbidden(ctx)
+		return
+	}
 	var request DocumentRequest
 	if err := ctx.ShouldBindJSON(&request); err != nil {
 		ctx.JSON(422, gin.H{
-			"error" : "validation error",
+			"error": "validation error",
 		})
 		return
 	}
 
-	if err := e.engine.IndexDocument(request.Document); err != nil {
+	fields := request.Fields
+	if fields == nil {
+		fields = map[string]any{schema.DefaultField: request.Document}
+	}
+	access := documentAccess(user, request.Visibility)
+	docId, err := e.engine.IndexFields(ctx.Request.Context(), fields, access)
+	if errors.Is(err, schema.ErrInvalidDocument) {
+		ctx.JSON(422, gin.H{
+			"error": "validation error",
+			"msg":   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrClosed) {
+		unavailable(ctx)
+		return
+	}
+	if err != nil {
 		ctx.JSON(500, gin.H{
-			"error" : "failed to store document",
+			"error": "failed to store document",
 		})
 		return
 	}
 
 	ctx.JSON(200, gin.H{
-		"msg" : "document inserted",
+		"msg":     "document inserted",
+		"docId":   docId,
+		"private": access.Private,
 	})
 }
 
-func (e *EngineHandler) Search(ctx *gin.Context) {
+func (e *EngineHandler) Delete(ctx *gin.Context) {
+	docId, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(422, gin.H{
+			"error": "validation error",
+		})
+		return
+	}
+
+	err = e.engine.DeleteDocument(ctx.Request.Context(), docId, currentUser(ctx))
+	if errors.Is(err, services.ErrDocumentNotFound) {
+		ctx.JSON(404, gin.H{
+			"error": "document not found",
+		})
+		return
+	}
+	if errors.Is(err, services.ErrForbidden) {
+		forbidden(ctx)
+		return
+	}
+	if errors.Is(err, services.ErrClosed) {
+		unavailable(ctx)
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "failed to delete document",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"msg": "document deleted",
+	})
+}
+
+func (e *EngineHandler) Update(ctx *gin.Context) {
 	var request DocumentRequest
+	docId, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || ctx.ShouldBindJSON(&request) != nil {
+		ctx.JSON(422, gin.H{
+			"error": "validation error",
+		})
+		return
+	}
+
+	var newDocId int64
+	if request.Fields != nil {
+		newDocId, err = e.engine.UpdateFields(ctx.Request.Context(), docId, request.Fields, currentUser(ctx))
+	} else {
+		newDocId, err = e.engine.UpdateDocument(ctx.Request.Context(), docId, request.Document, currentUser(ctx))
+	}
+	if errors.Is(err, schema.ErrInvalidDocument) {
+		ctx.JSON(422, gin.H{
+			"error": "validation error",
+			"msg":   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrDocumentNotFound) {
+		ctx.JSON(404, gin.H{
+			"error": "document not found",
+		})
+		return
+	}
+	if errors.Is(err, services.ErrForbidden) {
+		forbidden(ctx)
+		return
+	}
+	if errors.Is(err, services.ErrClosed) {
+		unavailable(ctx)
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "failed to update document",
+		})
+		return
+	}
+
+	// the document is indexed again under a new docId
+	ctx.JSON(200, gin.H{
+		"msg":   "document updated",
+		"docId": newDocId,
+	})
+}
+
+func (e *EngineHandler) Search(ctx *gin.Context) {
+	var request SearchRequest
 	if err := ctx.ShouldBindJSON(&request); err != nil {
 		ctx.JSON(422, gin.H{
-			"error" : "validation error",
+			"error": "validation error",
+		})
+		return
+	}
+
+	opts := services.SearchOptions{
+		Limit:       request.Limit,
+		Offset:      request.Offset,
+		SnippetSize: request.SnippetSize,
+		PreTag:      request.PreTag,
+		PostTag:     request.PostTag,
+		User:        currentUser(ctx),
+	}
+	if opts.Limit == 0 {
+		opts.Limit = DefaultLimit
+	}
+	if opts.SnippetSize == 0 {
+		opts.SnippetSize = DefaultSnippetSize
+	}
+	if opts.PreTag == "" && opts.PostTag == "" {
+		opts.PreTag, opts.PostTag = DefaultPreTag, DefaultPostTag
+	}
+
+	result, err := e.engine.SearchDocument(ctx.Request.Context(), request.Document, opts)
+	var syntaxErr *query.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		ctx.JSON(422, gin.H{
+			"error":    "syntax error",
+			"msg":      syntaxErr.Msg,
+			"position": syntaxErr.Pos,
+		})
+		return
+	}
+	if errors.Is(err, services.ErrClosed) {
+		unavailable(ctx)
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "failed to search documents",
+		})
+		return
+	}
+
+	ctx.JSON(200, result)
+}
+
+/**
+POST /bulk?visibility=private, a document per line (NDJSON), as in POST /insert or the fields of the document
+every document gets the visibility of the query, as the visibility of POST /insert
+documents are indexed in batches of BulkBatchSize, the response streams a line per document
+	{"line": 1, "docId": 7}
+	{"line": 2, "error": "..."}
+and ends with the totals
+	{"indexed": 1, "failed": 1, "bytes": 64, "took": "2ms", "docsPerSec": 500}
+**/
+
+func (e *EngineHandler) Bulk(ctx *gin.Context) {
+	user := currentUser(ctx)
+	if !user.CanWrite() {
+		forbidden(ctx)
+		return
+	}
+	visibility := ctx.Query("visibility")
+	if visibility != "" && visibility != "public" && visibility != "private" {
+		ctx.JSON(422, gin.H{
+			"error": "validation error",
+			"msg":   "visibility must be public or private",
 		})
 		return
 	}
-	
-	var documents []models.Document
-	for index, doc := range e.engine.SearchDocument(request.Document) {
-		documents = append(documents, models.Document{
-			DocId: "Doc_" + strconv.Itoa(index),
-			Document: doc,
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Status(200)
+	encoder := json.NewEncoder(ctx.Writer)
+
+	im := importer.New(e.engine, BulkBatchSize)
+	im.Access = documentAccess(user, visibility)
+	im.Context = ctx.Request.Context()
+	im.OnResult = func(result importer.Result) {
+		line := gin.H{"line": result.Line}
+		if result.Err != nil {
+			line["error"] = result.Err.Error()
+		} else {
+			line["docId"] = result.DocId
+		}
+		encoder.Encode(line)
+		ctx.Writer.Flush()
+	}
+	err := im.ReadNDJSON(ctx.Request.Body, "")
+	im.Flush()
+
+	stats := im.Stats()
+	summary := gin.H{
+		"indexed":    stats.Documents,
+		"failed":     stats.Failed,
+		"bytes":      stats.Bytes,
+		"took":       stats.Elapsed.String(),
+		"docsPerSec": stats.DocsPerSec(),
+	}
+	if err != nil {
+		summary["error"] = err.Error()
+	}
+	encoder.Encode(summary)
+}
+
+func (e *EngineHandler) Compact(ctx *gin.Context) {
+	err := e.engine.Compact(ctx.Request.Context())
+	if errors.Is(err, services.ErrClosed) {
+		unavailable(ctx)
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "failed to compact index",
 		})
+		return
 	}
 
-	ctx.JSON(200, documents)
+	ctx.JSON(200, gin.H{
+		"msg": "index compacted",
+	})
 }
 
+func (e *EngineHandler) Snapshot(ctx *gin.Context) {
+	var request SnapshotRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil || !filepath.IsAbs(request.Path) {
+		ctx.JSON(422, gin.H{
+			"error": "validation error",
+			"msg":   "path must be an absolute path on the server",
+		})
+		return
+	}
+
+	info, err := e.engine.Snapshot(ctx.Request.Context(), request.Path)
+	if errors.Is(err, services.ErrSnapshotExists) {
+		ctx.JSON(409, gin.H{
+			"error": "snapshot path already exists",
+		})
+		return
+	}
+	if errors.Is(err, services.ErrSnapshotUnsupported) {
+		ctx.JSON(501, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrClosed) {
+		unavailable(ctx)
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "failed to take snapshot",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"msg":      "snapshot taken",
+		"path":     request.Path,
+		"snapshot": info,
+	})
+}
+
+// GET /stats?top=10, usage of the index and the terms of the most documents
+func (e *EngineHandler) Stats(ctx *gin.Context) {
+	top := DefaultStatsTop
+	if value := ctx.Query("top"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > MaxStatsTop {
+			ctx.JSON(422, gin.H{
+				"error": "validation error",
+				"msg":   "top must be between 0 and " + strconv.Itoa(MaxStatsTop),
+			})
+			return
+		}
+		top = n
+	}
+
+	stats, err := e.engine.Stats(ctx.Request.Context(), top)
+	if errors.Is(err, services.ErrClosed) {
+		unavailable(ctx)
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "failed to read index stats",
+		})
+		return
+	}
+
+	ctx.JSON(200, stats)
+}
+
+// GET /stats/terms/:term, every posting of a term as stored in the index
+func (e *EngineHandler) TermPostings(ctx *gin.Context) {
+	term := ctx.Param("term")
+	postings, err := e.engine.TermPostings(ctx.Request.Context(), term)
+	if errors.Is(err, services.ErrTermNotFound) {
+		ctx.JSON(404, gin.H{
+			"error": "term not found",
+		})
+		return
+	}
+	if errors.Is(err, services.ErrClosed) {
+		unavailable(ctx)
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "failed to read postings",
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"term":     term,
+		"postings": postings,
+	})
+}
+
+// a file of the static directory, index.html for any other GET path
 func (e *EngineHandler) FrontPage(ctx *gin.Context) {
-	ctx.File(filepath.Join(utils.Path, "static", "index.html"))
-}
\ No newline at end of file
+	if ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead {
+		ctx.JSON(404, gin.H{
+			"error": "not found",
+		})
+		return
+	}
+	// the cleaned absolute path never leaves staticDir
+	path := filepath.Join(e.staticDir, filepath.FromSlash(pathpkg.Clean("/"+ctx.Request.URL.Path)))
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		path = filepath.Join(e.staticDir, "index.html")
+	}
+	ctx.File(path)
+}
+
+// the engine is closed while the server shuts down
+func unavailable(ctx *gin.Context) {
+	ctx.JSON(503, gin.H{
+		"error": "server is shutting down",
+	})
+}
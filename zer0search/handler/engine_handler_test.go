@@ -0,0 +1,470 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"searchengine/auth"
+	memorymapper "searchengine/memory_mapper"
+	"searchengine/models"
+	"searchengine/repositories"
+	"searchengine/schema"
+	"searchengine/services"
+	"searchengine/tokenizer"
+	"searchengine/utils"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// router over index files and an embedded document store in an empty directory
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	return newOptionsRouter(t, memorymapper.DefaultOptions(t.TempDir()), auth.Config{})
+}
+
+// router over the index files of opts, authenticating requests with the keys of authConfig
+func newOptionsRouter(t *testing.T, opts memorymapper.Options, authConfig auth.Config) *gin.Engine {
+	t.Helper()
+	authenticator, err := auth.New(authConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(opts.Dir, "memory_mapper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := memorymapper.NewSegments(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	norms, err := memorymapper.NewNorms(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tombstones, err := memorymapper.NewTombstones(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := memorymapper.NewDocuments(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal, err := memorymapper.NewWAL(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	terms, err := memorymapper.NewTerms(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := memorymapper.NewAccess(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		segments.Close()
+		norms.Close()
+		tombstones.Close()
+		docs.Close()
+		wal.Close()
+		terms.Close()
+		access.Close()
+	})
+
+	indexRepo := repositories.NewIndexRepo(segments, norms, tombstones, wal, terms, access)
+	analyzer, err := tokenizer.Named("standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engineService := services.NewEngineService(indexRepo, repositories.NewFileDocumentRepo(docs), analyzer, schema.Default())
+	if err := engineService.Restore(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	go indexRepo.MergeLoop()
+	engineHandler := NewEngineHandler(engineService, filepath.Join(opts.Dir, "static"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID)
+	api := router.Group("/", Authenticate(authenticator))
+	api.POST("/insert", engineHandler.Index)
+	api.POST("/bulk", engineHandler.Bulk)
+	api.POST("/search", engineHandler.Search)
+	api.DELETE("/documents/:id", engineHandler.Delete)
+	api.PUT("/documents/:id", engineHandler.Update)
+	api.GET("/stats", RequireAdmin, engineHandler.Stats)
+	api.GET("/stats/terms/:term", RequireAdmin, engineHandler.TermPostings)
+	api.GET("/metrics", RequireAdmin, Metrics)
+	admin := api.Group("/admin", RequireAdmin)
+	admin.POST("/snapshot", engineHandler.Snapshot)
+	router.NoRoute(engineHandler.FrontPage)
+	return router
+}
+
+func post(router *gin.Engine, path, document string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(DocumentRequest{Document: document})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+	return w
+}
+
+// run with -race, writers and readers share the engine, flushes and background merges
+func TestConcurrentInsertSearch(t *testing.T) {
+	opts := memorymapper.DefaultOptions(t.TempDir())
+	opts.FlushDocs = 5
+	router := newOptionsRouter(t, opts, auth.Config{})
+	writers, readers, docs := 4, 4, 25
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < docs; i++ {
+				document := fmt.Sprintf("shared writer%d doc%d", w, i)
+				if resp := post(router, "/insert", document); resp.Code != 200 {
+					t.Errorf("POST /insert %s = %d want 200", document, resp.Code)
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; i < docs; i++ {
+				q := fmt.Sprintf("shared AND (writer%d OR doc%d)", r, i)
+				if resp := post(router, "/search", q); resp.Code != 200 {
+					t.Errorf("POST /search %s = %d want 200", q, resp.Code)
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	resp := post(router, "/search", "shared")
+	var result models.SearchResult
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+		t.Fatalf("POST /search shared = %s : %v", resp.Body.String(), err)
+	}
+	if result.Total != writers*docs {
+		t.Errorf("POST /search shared = %d documents want %d", result.Total, writers*docs)
+	}
+}
+
+func TestSearchSyntaxError(t *testing.T) {
+	router := newTestRouter(t)
+	if resp := post(router, "/search", "shared AND"); resp.Code != 422 {
+		t.Errorf("POST /search shared AND = %d want 422", resp.Code)
+	}
+	if resp := post(router, "/search", `"open phrase`); resp.Code != 422 {
+		t.Errorf(`POST /search "open phrase = %d want 422`, resp.Code)
+	}
+}
+
+func TestSearchHighlight(t *testing.T) {
+	router := newTestRouter(t)
+	post(router, "/insert", "Binary search finds an item in a sorted array")
+
+	body := `{"document": "sorted", "preTag": "[", "postTag": "]", "snippetSize": 3}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader([]byte(body))))
+	var result models.SearchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || len(result.Documents) != 1 {
+		t.Fatalf("POST /search %s = %s want 1 document", body, w.Body.String())
+	}
+	if got, want := result.Documents[0].Snippet, "…a [sorted] array"; got != want {
+		t.Errorf("POST /search snippet = %q want %q", got, want)
+	}
+	if result.Documents[0].DocId != 1 || result.Limit != DefaultLimit {
+		t.Errorf("POST /search docId, limit = %d, %d want 1, %d", result.Documents[0].DocId, result.Limit, DefaultLimit)
+	}
+
+	if resp := post(router, "/search", "sorted"); !bytes.Contains(resp.Body.Bytes(), []byte(`\u003cem\u003esorted`)) {
+		t.Errorf("POST /search sorted = %s want default <em> tags", resp.Body.String())
+	}
+}
+
+func TestInsertFields(t *testing.T) {
+	router := newTestRouter(t)
+
+	testCase := []struct {
+		body string
+		code int
+	}{
+		{`{"fields": {"document": "binary search"}}`, 200},
+		{`{"document": "sorted array"}`, 200},
+		{`{"fields": {"title": "binary search"}}`, 422},
+		{`{"fields": {"document": 3}}`, 422},
+		{`{}`, 422},
+	}
+	for _, test := range testCase {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/insert", bytes.NewReader([]byte(test.body))))
+		if w.Code != test.code {
+			t.Errorf("POST /insert %s = %d want %d", test.body, w.Code, test.code)
+		}
+	}
+
+	resp := post(router, "/search", "binary")
+	var result models.SearchResult
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil || len(result.Documents) != 1 {
+		t.Fatalf("POST /search binary = %s want 1 document", resp.Body.String())
+	}
+	if got := result.Documents[0].Fields["document"]; got != "binary search" {
+		t.Errorf("POST /search binary fields = %v want the stored document", result.Documents[0].Fields)
+	}
+}
+
+func TestBulk(t *testing.T) {
+	router := newTestRouter(t)
+
+	body := "{\"document\": \"binary search\"}\n{\"title\": \"x\"}\n\n{\"fields\": {\"document\": \"sorted array\"}}\n"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/bulk", bytes.NewReader([]byte(body))))
+	lines := bytes.Split(bytes.TrimSpace(w.Body.Bytes()), []byte("\n"))
+	if w.Code != 200 || len(lines) != 4 {
+		t.Fatalf("POST /bulk = %d %s want 200 and 4 lines", w.Code, w.Body.String())
+	}
+	want := []string{`{"docId":1,"line":1}`, `{"docId":2,"line":4}`}
+	if string(lines[0]) != want[0] || string(lines[2]) != want[1] || !bytes.Contains(lines[1], []byte(`"error"`)) {
+		t.Errorf("POST /bulk = %s want %v", w.Body.String(), want)
+	}
+	var summary struct {
+		Indexed int `json:"indexed"`
+		Failed  int `json:"failed"`
+	}
+	if err := json.Unmarshal(lines[3], &summary); err != nil || summary.Indexed != 2 || summary.Failed != 1 {
+		t.Errorf("POST /bulk summary = %s want 2 indexed, 1 failed", lines[3])
+	}
+
+	if resp := post(router, "/search", "array"); !bytes.Contains(resp.Body.Bytes(), []byte(`"docId":2`)) {
+		t.Errorf("POST /search array = %s want docId 2", resp.Body.String())
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	router := newTestRouter(t)
+	post(router, "/insert", "binary search")
+	dest := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+
+	testCase := []struct {
+		path string
+		code int
+	}{
+		{"relative/snapshot", 422},
+		{dest, 200},
+		{dest, 409},
+	}
+	for _, test := range testCase {
+		body, _ := json.Marshal(SnapshotRequest{Path: test.path})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/snapshot", bytes.NewReader(body)))
+		if w.Code != test.code {
+			t.Errorf("POST /admin/snapshot %s = %d %s want %d", test.path, w.Code, w.Body.String(), test.code)
+		}
+	}
+	if !utils.FileExists(dest) {
+		t.Errorf("POST /admin/snapshot did not write %s", dest)
+	}
+}
+
+func TestStats(t *testing.T) {
+	router := newTestRouter(t)
+	post(router, "/insert", "binary search")
+	post(router, "/insert", "binary tree")
+	post(router, "/insert", "linear search")
+	send(router, http.MethodDelete, "/documents/2", "", nil)
+
+	w := send(router, http.MethodGet, "/stats?top=2", "", nil)
+	var stats services.IndexStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); w.Code != 200 || err != nil {
+		t.Fatalf("GET /stats = %d %s want 200", w.Code, w.Body.String())
+	}
+	// tree is only in the deleted document
+	want := []services.TermStats{{Term: "search", DocFreq: 2}, {Term: "binary", DocFreq: 1}}
+	if stats.Documents != 2 || stats.Deleted != 1 || stats.Vocabulary != 3 || stats.Terms != 4 || stats.BufferDocs != 3 {
+		t.Errorf("GET /stats = %+v want 2 documents, 1 deleted, vocabulary 3, 4 terms, 3 buffered documents", stats)
+	}
+	if fmt.Sprint(stats.TopTerms) != fmt.Sprint(want) {
+		t.Errorf("GET /stats topTerms = %v want %v", stats.TopTerms, want)
+	}
+	if len(stats.Files) == 0 || stats.Files[0].Fill <= 0 || stats.MaxFileSize == 0 {
+		t.Errorf("GET /stats files = %v, maxFileSize %d want sizes against maxFileSize", stats.Files, stats.MaxFileSize)
+	}
+
+	w = send(router, http.MethodGet, "/stats/terms/binary", "", nil)
+	var result struct {
+		Postings []services.TermPosting `json:"postings"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != 200 || len(result.Postings) != 2 || result.Postings[0].Deleted || !result.Postings[1].Deleted || result.Postings[1].Segment != "buffer" {
+		t.Errorf("GET /stats/terms/binary = %d %s want docId 1 and deleted docId 2 in the buffer", w.Code, w.Body.String())
+	}
+
+	testCase := []struct {
+		path string
+		code int
+	}{
+		{"/stats/terms/missing", 404},
+		{"/stats?top=x", 422},
+		{"/stats?top=-1", 422},
+		{"/stats?top=0", 200},
+	}
+	for _, test := range testCase {
+		if w := send(router, http.MethodGet, test.path, "", nil); w.Code != test.code {
+			t.Errorf("GET %s = %d %s want %d", test.path, w.Code, w.Body.String(), test.code)
+		}
+	}
+}
+
+func TestFrontPage(t *testing.T) {
+	opts := memorymapper.DefaultOptions(t.TempDir())
+	router := newOptionsRouter(t, opts, auth.Config{})
+	static := filepath.Join(opts.Dir, "static")
+	os.MkdirAll(static, 0755)
+	os.WriteFile(filepath.Join(static, "index.html"), []byte("front page"), 0644)
+	os.WriteFile(filepath.Join(static, "app.js"), []byte("script"), 0644)
+	os.WriteFile(filepath.Join(opts.Dir, "secret"), []byte("secret"), 0644)
+
+	testCase := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/", 200, "front page"},
+		{http.MethodGet, "/app.js", 200, "script"},
+		{http.MethodGet, "/search/page", 200, "front page"},
+		{http.MethodGet, "/../secret", 400, ""},
+		{http.MethodPost, "/missing", 404, ""},
+	}
+	for _, test := range testCase {
+		w := send(router, test.method, test.path, "", nil)
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) {
+			t.Errorf("%s %s = %d %s want %d %s", test.method, test.path, w.Code, w.Body.String(), test.code, test.body)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	router := newTestRouter(t)
+	post(router, "/insert", "binary search")
+	searchBody, _ := json.Marshal(SearchRequest{Document: "binary"})
+	r := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(searchBody))
+	r.Header.Set(RequestIDHeader, "client-id-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if got := w.Header().Get(RequestIDHeader); w.Code != 200 || got != "client-id-1" {
+		t.Errorf("POST /search %s = %d %s want 200 and the request ID of the client", RequestIDHeader, w.Code, got)
+	}
+
+	w = send(router, http.MethodGet, "/metrics", "", nil)
+	if w.Code != 200 {
+		t.Fatalf("GET /metrics = %d want 200", w.Code)
+	}
+	// counters are shared by every test, only check they are served
+	for _, name := range []string{"zer0_documents_indexed_total", "zer0_index_duration_seconds_count", "zer0_search_duration_seconds_count"} {
+		if !strings.Contains(w.Body.String(), name) {
+			t.Errorf("GET /metrics = %s want %s", w.Body.String(), name)
+		}
+	}
+	if got := w.Header().Get(RequestIDHeader); len(got) != 16 {
+		t.Errorf("GET /metrics %s = %q want a generated request ID", RequestIDHeader, got)
+	}
+}
+
+// request as the user of key, body is sent as JSON
+func send(router *gin.Engine, method, path, key string, body any) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	r := httptest.NewRequest(method, path, bytes.NewReader(data))
+	if key != "" {
+		r.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthVisibility(t *testing.T) {
+	router := newOptionsRouter(t, memorymapper.DefaultOptions(t.TempDir()), auth.Config{Keys: []auth.Key{
+		{Key: "alice-key", User: "alice"},
+		{Key: "bob-key", User: "bob"},
+		{Key: "carol-key", User: "carol", Role: auth.RoleReader},
+		{Key: "root-key", User: "root", Role: auth.RoleAdmin},
+	}})
+
+	// docId 1 is private by default, docId 2 public
+	send(router, http.MethodPost, "/insert", "alice-key", DocumentRequest{Document: "secret plan"})
+	send(router, http.MethodPost, "/insert", "alice-key", DocumentRequest{Document: "public plan", Visibility: "public"})
+
+	testCase := []struct {
+		method string
+		path   string
+		key    string
+		body   any
+		code   int
+		total  int // documents found by a search
+	}{
+		{http.MethodPost, "/search", "", SearchRequest{Document: "plan"}, 401, 0},
+		{http.MethodPost, "/search", "wrong-key", SearchRequest{Document: "plan"}, 401, 0},
+		{http.MethodPost, "/search", "alice-key", SearchRequest{Document: "plan"}, 200, 2},
+		{http.MethodPost, "/search", "bob-key", SearchRequest{Document: "plan"}, 200, 1},
+		{http.MethodPost, "/search", "carol-key", SearchRequest{Document: "NOT secret"}, 200, 1},
+		{http.MethodPost, "/search", "root-key", SearchRequest{Document: "plan"}, 200, 2},
+		{http.MethodPost, "/insert", "carol-key", DocumentRequest{Document: "reader note"}, 403, 0},
+		{http.MethodPost, "/insert", "bob-key", DocumentRequest{Document: "note", Visibility: "hidden"}, 422, 0},
+		{http.MethodDelete, "/documents/1", "bob-key", nil, 404, 0},
+		{http.MethodDelete, "/documents/2", "bob-key", nil, 403, 0},
+		{http.MethodPut, "/documents/2", "bob-key", DocumentRequest{Document: "bob plan"}, 403, 0},
+		{http.MethodPost, "/admin/snapshot", "alice-key", SnapshotRequest{Path: filepath.Join(t.TempDir(), "s")}, 403, 0},
+		// an update keeps the owner and the visibility, docId 1 becomes docId 3
+		{http.MethodPut, "/documents/1", "alice-key", DocumentRequest{Document: "secret plan v2"}, 200, 0},
+		{http.MethodPost, "/search", "bob-key", SearchRequest{Document: "secret"}, 200, 0},
+		{http.MethodPost, "/search", "alice-key", SearchRequest{Document: "secret"}, 200, 1},
+		{http.MethodDelete, "/documents/3", "root-key", nil, 200, 0},
+	}
+	for _, test := range testCase {
+		w := send(router, test.method, test.path, test.key, test.body)
+		if w.Code != test.code {
+			t.Errorf("%s %s as %q = %d %s want %d", test.method, test.path, test.key, w.Code, w.Body.String(), test.code)
+			continue
+		}
+		if test.path == "/search" && w.Code == 200 {
+			var result struct {
+				Total int `json:"total"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &result)
+			if result.Total != test.total {
+				t.Errorf("%s %s as %q = %d documents want %d", test.method, test.path, test.key, result.Total, test.total)
+			}
+		}
+	}
+}
+
+func TestHugeDocId(t *testing.T) {
+	router := newTestRouter(t)
+	post(router, "/insert", "binary search")
+
+	// 2^61+1 times the size of a norm wraps around to the offset of docId 1
+	path := "/documents/2305843009213693953"
+	if w := send(router, http.MethodDelete, path, "", nil); w.Code != 404 {
+		t.Errorf("DELETE %s = %d %s want 404", path, w.Code, w.Body.String())
+	}
+	if w := send(router, http.MethodPut, path, "", DocumentRequest{Document: "binary tree"}); w.Code != 404 {
+		t.Errorf("PUT %s = %d %s want 404", path, w.Code, w.Body.String())
+	}
+
+	var result models.SearchResult
+	resp := post(router, "/search", "binary")
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil || result.Total != 1 {
+		t.Errorf("POST /search binary = %s want 1 document", resp.Body.String())
+	}
+}
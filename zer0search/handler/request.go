@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"log/slog"
+	"searchengine/logging"
+	"searchengine/metrics"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// give every request an ID, the one of X-Request-ID when the client sends a valid one
+// the ID is sent back in X-Request-ID and stored in the request context, records logged with it carry it
+func RequestID(ctx *gin.Context) {
+	id := ctx.GetHeader(RequestIDHeader)
+	if !logging.ValidRequestID(id) {
+		id = logging.NewRequestID()
+	}
+	ctx.Header(RequestIDHeader, id)
+	ctx.Request = ctx.Request.WithContext(logging.WithRequestID(ctx.Request.Context(), id))
+	ctx.Next()
+}
+
+// log every request once it is served, after RequestID()
+func Logger(ctx *gin.Context) {
+	start := time.Now()
+	ctx.Next()
+	level := slog.LevelInfo
+	if ctx.Writer.Status() >= 500 {
+		level = slog.LevelError
+	}
+	slog.Log(ctx.Request.Context(), level, "[request.go] [Logger()] request served",
+		"method", ctx.Request.Method,
+		"path", ctx.Request.URL.Path,
+		"status", ctx.Writer.Status(),
+		"latency", time.Since(start).String(),
+		"client", ctx.ClientIP(),
+		"bytes", max(ctx.Writer.Size(), 0),
+	)
+}
+
+// GET /metrics, in the Prometheus text format
+var Metrics = gin.WrapH(metrics.Handler())
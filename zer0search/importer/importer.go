@@ -0,0 +1,224 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"searchengine/schema"
+	"searchengine/services"
+	"strings"
+	"time"
+)
+
+// writes a batch of documents, implemented by services.EngineService
+type Indexer interface {
+	IndexBatch(ctx context.Context, batch []map[string]any, access services.Access) []services.BatchItem
+}
+
+// one imported document
+type Result struct {
+	Source string // file of the document, empty for a request body
+	Line   int    // line of a document read from NDJSON, position in a JSON list, 0 otherwise
+	DocId  int64  // 0 when Err is set
+	Err    error
+}
+
+type Stats struct {
+	Files     int
+	Documents int // indexed documents
+	Failed    int
+	Bytes     int64
+	Elapsed   time.Duration
+}
+
+func (s Stats) DocsPerSec() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Documents) / s.Elapsed.Seconds()
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("indexed %d documents, %d failed, from %d files, %.2f MB in %s (%.0f docs/s, %.2f MB/s)",
+		s.Documents, s.Failed, s.Files, float64(s.Bytes)/(1<<20), s.Elapsed.Round(time.Millisecond),
+		s.DocsPerSec(), float64(s.Bytes)/(1<<20)/max(s.Elapsed.Seconds(), 1e-9))
+}
+
+/**
+collects documents into batches of BatchSize and indexes a batch at once
+	- .txt and .md files are one document, their text is stored in Field
+	- .json files hold a document or a list of documents
+	- .ndjson and .jsonl files, and a bulk request body, hold a document per line
+a document is an object of fields, or {"fields": {...}} as in POST /insert
+
+OnResult is called for every document once its batch is written
+**/
+
+type Importer struct {
+	indexer   Indexer
+	BatchSize int
+	Field     string          // field of the text of .txt and .md files
+	Access    services.Access // owner and visibility of every document
+	Context   context.Context // of the request importing, batches log with its request ID
+	OnResult  func(Result)
+	batch     []map[string]any
+	pending   []Result // source and line of every document of batch
+	stats     Stats
+	start     time.Time
+}
+
+func New(indexer Indexer, batchSize int) *Importer {
+	return &Importer{
+		indexer:   indexer,
+		BatchSize: max(batchSize, 1),
+		Field:     schema.DefaultField,
+		OnResult:  func(Result) {},
+		Context:   context.Background(),
+		start:     time.Now(),
+	}
+}
+
+// queue a document, the batch is written when it is full
+func (im *Importer) Add(fields map[string]any, source string, line int) {
+	im.batch = append(im.batch, documentFields(fields))
+	im.pending = append(im.pending, Result{Source: source, Line: line})
+	if len(im.batch) >= im.BatchSize {
+		im.Flush()
+	}
+}
+
+// report a document which could not be read
+func (im *Importer) Fail(source string, line int, err error) {
+	im.stats.Failed++
+	im.OnResult(Result{Source: source, Line: line, Err: err})
+}
+
+// write the queued documents
+func (im *Importer) Flush() {
+	if len(im.batch) == 0 {
+		return
+	}
+	items := im.indexer.IndexBatch(im.Context, im.batch, im.Access)
+	for i, item := range items {
+		result := im.pending[i]
+		result.DocId, result.Err = item.DocId, item.Err
+		if item.Err != nil {
+			im.stats.Failed++
+		} else {
+			im.stats.Documents++
+		}
+		im.OnResult(result)
+	}
+	im.batch, im.pending = im.batch[:0], im.pending[:0]
+}
+
+// counts so far, Flush() first to count the queued documents
+func (im *Importer) Stats() Stats {
+	stats := im.stats
+	stats.Elapsed = time.Since(im.start)
+	return stats
+}
+
+// a document per line, empty lines are skipped
+// a line which is not a JSON object fails alone, a read error stops
+func (im *Importer) ReadNDJSON(r io.Reader, source string) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		im.stats.Bytes += int64(len(scanner.Bytes())) + 1
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(text), &fields); err != nil {
+			im.Fail(source, line, fmt.Errorf("%w : %w", schema.ErrInvalidDocument, err))
+			continue
+		}
+		im.Add(fields, source, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("line %d : %w", line+1, err)
+	}
+	return nil
+}
+
+// largest line of NDJSON
+var MaxLineSize = 16 * 1024 * 1024
+
+// import every text, Markdown and JSON file under dir, other files are skipped
+// a file which can not be read fails alone
+func (im *Importer) ImportDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".txt", ".md", ".markdown":
+			im.stats.Files++
+			data, err := os.ReadFile(path)
+			if err != nil {
+				im.Fail(path, 0, err)
+				return nil
+			}
+			im.stats.Bytes += int64(len(data))
+			im.Add(map[string]any{im.Field: string(data)}, path, 0)
+		case ".json":
+			im.stats.Files++
+			im.importJSON(path)
+		case ".ndjson", ".jsonl":
+			im.stats.Files++
+			file, err := os.Open(path)
+			if err != nil {
+				im.Fail(path, 0, err)
+				return nil
+			}
+			defer file.Close()
+			if err := im.ReadNDJSON(file, path); err != nil {
+				im.Fail(path, 0, err)
+			}
+		}
+		return nil
+	})
+}
+
+// a JSON file holds a document or a list of documents
+func (im *Importer) importJSON(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		im.Fail(path, 0, err)
+		return
+	}
+	im.stats.Bytes += int64(len(data))
+	var document map[string]any
+	if err := json.Unmarshal(data, &document); err == nil {
+		im.Add(document, path, 0)
+		return
+	}
+	var documents []map[string]any
+	if err := json.Unmarshal(data, &documents); err != nil {
+		im.Fail(path, 0, fmt.Errorf("%w : not a JSON object or list of objects", schema.ErrInvalidDocument))
+		return
+	}
+	for i, document := range documents {
+		im.Add(document, path, i+1)
+	}
+}
+
+// {"fields": {...}} holds the fields of a document, any other object is the fields
+func documentFields(document map[string]any) map[string]any {
+	if fields, ok := document["fields"].(map[string]any); ok && len(document) == 1 {
+		return fields
+	}
+	return document
+}
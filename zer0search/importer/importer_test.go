@@ -0,0 +1,113 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"searchengine/schema"
+	"searchengine/services"
+	"strings"
+	"testing"
+)
+
+// indexes every document with a "document" field
+type fakeIndexer struct {
+	batches [][]map[string]any
+	docId   int64
+}
+
+func (f *fakeIndexer) IndexBatch(_ context.Context, batch []map[string]any, _ services.Access) []services.BatchItem {
+	f.batches = append(f.batches, append([]map[string]any(nil), batch...))
+	items := make([]services.BatchItem, len(batch))
+	for i, fields := range batch {
+		if _, ok := fields[schema.DefaultField]; !ok {
+			items[i].Err = schema.ErrInvalidDocument
+			continue
+		}
+		f.docId++
+		items[i].DocId = f.docId
+	}
+	return items
+}
+
+func TestReadNDJSON(t *testing.T) {
+	indexer := &fakeIndexer{}
+	im := New(indexer, 2)
+	results := make([]Result, 0)
+	im.OnResult = func(result Result) { results = append(results, result) }
+
+	body := `{"document": "a"}
+
+{"fields": {"document": "b"}}
+not json
+{"title": "c"}
+{"document": "d"}`
+	if err := im.ReadNDJSON(strings.NewReader(body), ""); err != nil {
+		t.Fatalf("ReadNDJSON() = %v want <nil>", err)
+	}
+	im.Flush()
+
+	if len(indexer.batches) != 2 || len(indexer.batches[0]) != 2 || len(indexer.batches[1]) != 2 {
+		t.Errorf("IndexBatch() batches = %v want 2 batches of 2", indexer.batches)
+	}
+	lines := make([]int, 0)
+	for _, result := range results {
+		lines = append(lines, result.Line)
+	}
+	// the invalid line is reported when it is read, the others when their batch is written
+	if want := []int{1, 3, 4, 5, 6}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("OnResult() lines = %v want %v", lines, want)
+	}
+	if !errors.Is(results[2].Err, schema.ErrInvalidDocument) || results[4].DocId != 3 {
+		t.Errorf("OnResult() = %v", results)
+	}
+	if stats := im.Stats(); stats.Documents != 3 || stats.Failed != 2 || stats.Bytes != int64(len(body))+1 {
+		t.Errorf("Stats() = %+v want 3 documents, 2 failed, %d bytes", stats, len(body)+1)
+	}
+}
+
+func TestImportDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":          "plain text",
+		"notes/b.md":     "# markdown",
+		"c.json":         `{"document": "json"}`,
+		"d.json":         `[{"document": "first"}, {"document": "second"}]`,
+		"e.ndjson":       "{\"document\": \"line\"}\n{\"document\": \"line 2\"}\n",
+		"f.json":         `"not a document"`,
+		"image.png":      "skipped",
+		"notes/g.jsonl":  `{"document": "jsonl"}`,
+		"notes/h.MD":     "upper case extension",
+		"notes/i.ndjson": "{",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	indexer := &fakeIndexer{}
+	im := New(indexer, 100)
+	failed := make([]string, 0)
+	im.OnResult = func(result Result) {
+		if result.Err != nil {
+			failed = append(failed, filepath.Base(result.Source))
+		}
+	}
+	if err := im.ImportDir(dir); err != nil {
+		t.Fatalf("ImportDir() = %v want <nil>", err)
+	}
+	im.Flush()
+
+	stats := im.Stats()
+	if stats.Files != 9 || stats.Documents != 9 || stats.Failed != 2 {
+		t.Errorf("Stats() = %+v want 9 files, 9 documents, 2 failed", stats)
+	}
+	if !reflect.DeepEqual(failed, []string{"f.json", "i.ndjson"}) {
+		t.Errorf("OnResult() failed = %v want [f.json i.ndjson]", failed)
+	}
+}
@@ -0,0 +1,120 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+/**
+every record logged with a context carrying a request ID gets a request_id attribute
+1. handler.RequestID() stores the ID of a request in its context
+2. the context is handed down to EngineService and the repositories
+3. slog.ErrorContext(ctx, ...) and the like add the ID, slog.Error() logs without it
+**/
+
+// format and lowest level of the logs
+type Config struct {
+	Format string `yaml:"format" toml:"format"` // text or json
+	Level  string `yaml:"level" toml:"level"`   // debug, info, warn or error
+}
+
+const RequestIDKey = "request_id"
+
+var ErrInvalidConfig = errors.New("invalid log config")
+
+func DefaultConfig() Config {
+	return Config{
+		Format: "text",
+		Level:  "info",
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Format != "text" && c.Format != "json" {
+		return fmt.Errorf("%w : unknown log format %q, use text or json", ErrInvalidConfig, c.Format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return fmt.Errorf("%w : unknown log level %q, use debug, info, warn or error", ErrInvalidConfig, c.Level)
+	}
+	return nil
+}
+
+// logger writing to w in the format of c
+func New(c Config, w io.Writer) (*slog.Logger, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	var level slog.Level
+	level.UnmarshalText([]byte(c.Level))
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if c.Format == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(NewHandler(handler)), nil
+}
+
+// contextHandler adds the request ID of the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func NewHandler(h slog.Handler) slog.Handler {
+	return contextHandler{Handler: h}
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+type requestIDKey struct{}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// request ID stored in ctx, empty if there is none
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// random 16 hex digits
+func NewRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// a request ID sent by a client is kept when it is short and printable, so it shows in the logs as is
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	return !strings.ContainsFunc(id, func(r rune) bool {
+		return r <= ' ' || r > '~'
+	})
+}
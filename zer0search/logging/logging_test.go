@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(Config{Format: "json", Level: "info"}, &buf)
+	if err != nil {
+		t.Fatalf("New() = %v want <nil>", err)
+	}
+	ctx := WithRequestID(context.Background(), "abc123")
+	logger.With("component", "test").ErrorContext(ctx, "failed", "err", "boom")
+	logger.InfoContext(context.Background(), "no request")
+	logger.DebugContext(ctx, "below level")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("logged %q want 2 records", buf.String())
+	}
+	var first, second map[string]any
+	json.Unmarshal(lines[0], &first)
+	json.Unmarshal(lines[1], &second)
+	if first[RequestIDKey] != "abc123" || first["component"] != "test" || first["err"] != "boom" {
+		t.Errorf("ErrorContext() = %v want request_id abc123, component and err", first)
+	}
+	if _, ok := second[RequestIDKey]; ok {
+		t.Errorf("InfoContext() = %v want no request_id", second)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	testCase := []struct {
+		id   string
+		want bool
+	}{
+		{"abc-123", true},
+		{NewRequestID(), true},
+		{"", false},
+		{"with space", false},
+		{"line\nbreak", false},
+		{string(bytes.Repeat([]byte("a"), 65)), false},
+	}
+	for _, test := range testCase {
+		if got := ValidRequestID(test.id); got != test.want {
+			t.Errorf("ValidRequestID(%q) = %v want %v", test.id, got, test.want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	testCase := []struct {
+		config Config
+		valid  bool
+	}{
+		{DefaultConfig(), true},
+		{Config{Format: "json", Level: "debug"}, true},
+		{Config{Format: "xml", Level: "info"}, false},
+		{Config{Format: "text", Level: "verbose"}, false},
+	}
+	for _, test := range testCase {
+		if err := test.config.Validate(); (err == nil) != test.valid {
+			t.Errorf("Validate(%+v) = %v want valid %v", test.config, err, test.valid)
+		}
+	}
+}
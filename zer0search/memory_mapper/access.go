@@ -0,0 +1,191 @@
+package memorymapper
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tysonmote/gommap"
+)
+
+// access.index keeps the owner and the visibility of every document, at the offset of its docId
+// [header][owner 0][check 0][visibility 0][owner 1][check 1][visibility 1]...
+// [header][uint64][uint64][uint64]...
+// owner and check are the Key of the owner's name, 0 for a document without owner
+// version 1 records have no check hash, they are rewritten with a check of 0 when the file is opened
+// a document indexed before access.index has no record, it is public and has no owner
+// len field of the header is the number of records, extra field is the number of private documents
+type Access struct {
+	mu      sync.RWMutex // Get() holds RLock, Set() and remapping hold Lock
+	file    *os.File
+	mmap    gommap.MMap // mmap
+	len     uint64      // current size
+	records uint64      // number of documents with a record
+	private uint64      // number of private documents
+	maxSize uint64      // size the file never grows past
+	closed  bool        // flag to check if the access.index is closed
+}
+
+const (
+	visibilityNone    uint64 = iota // no record
+	visibilityPublic                // every user finds the document
+	visibilityPrivate               // only the owner and admins find the document
+)
+
+// open access.index, an existing file is reopened and its counts restored from the header
+func NewAccess(opts Options) (*Access, error) {
+	path := opts.path(accessIndexFile)
+	file, mmap, size, err := mapFile(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	version, err := loadHeader(mmap, accessMagic, accessVersion, size)
+	if err != nil {
+		mmap.UnsafeUnmap()
+		file.Close()
+		return nil, err
+	}
+	if version == 1 {
+		err := upgradeAccess(path, mmap, size)
+		mmap.UnsafeUnmap()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		return NewAccess(opts)
+	}
+	return &Access{
+		file:    file,
+		mmap:    mmap,
+		len:     max(size, headerSize),
+		records: getField(mmap, lenField),
+		private: getField(mmap, extraField),
+		maxSize: opts.MaxFileSize,
+	}, nil
+}
+
+// version 1 stored [owner][visibility], write every record with a check of 0 to access.index.tmp
+// and rename it over access.index, an owner without check matches by hash alone
+func upgradeAccess(path string, mmap gommap.MMap, size uint64) error {
+	records := (size - headerSize) / accessEntrySizeV1
+	data := make([]byte, headerSize+records*accessEntrySize)
+	copy(data[:headerSize], mmap[:headerSize])
+	putField(data, versionField, accessVersion)
+	for j := uint64(0); j < records; j++ {
+		from := headerSize + j*accessEntrySizeV1
+		to := headerSize + j*accessEntrySize
+		copy(data[to:to+byteSize], mmap[from:from+byteSize])
+		copy(data[to+2*byteSize:to+accessEntrySize], mmap[from+byteSize:from+accessEntrySizeV1])
+	}
+	if err := writeFile(path+tmpSuffix, data); err != nil {
+		return err
+	}
+	if err := os.Rename(path+tmpSuffix, path); err != nil {
+		os.Remove(path + tmpSuffix)
+		return err
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	slog.Info("[access.go] [upgradeAccess()] access.index upgraded to check hashes", "records", getField(mmap, lenField))
+	return nil
+}
+
+// store the owner and the visibility of docId
+func (a *Access) Set(docId uint64, owner Key, private bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return errors.New("access.index file is closed")
+	}
+	offset, ok := entryOffset(docId, accessEntrySize, a.maxSize)
+	if !ok {
+		return ErrMaxFileSize
+	}
+	if offset+accessEntrySize > uint64(len(a.mmap)) {
+		mmap, err := growFile(a.file, a.mmap, offset+accessEntrySize, a.maxSize)
+		if err != nil {
+			if mmap == nil {
+				a.file.Close()
+				a.closed = true
+			}
+			return err
+		}
+		a.mmap = mmap
+	}
+	visibility := visibilityPublic
+	if private {
+		visibility = visibilityPrivate
+	}
+	prev := uint64(visibilityNone)
+	if offset+accessEntrySize <= a.len {
+		prev = encoder.Uint64(a.mmap[offset+2*byteSize : offset+accessEntrySize])
+	}
+	if prev == visibilityNone {
+		a.records++
+	}
+	if prev == visibilityPrivate {
+		a.private--
+	}
+	if private {
+		a.private++
+	}
+	encoder.PutUint64(a.mmap[offset:offset+byteSize], owner.Hash)
+	encoder.PutUint64(a.mmap[offset+byteSize:offset+2*byteSize], owner.Check)
+	encoder.PutUint64(a.mmap[offset+2*byteSize:offset+accessEntrySize], visibility)
+	putField(a.mmap, lenField, a.records)
+	putField(a.mmap, extraField, a.private)
+	a.len = max(a.len, offset+accessEntrySize)
+	return nil
+}
+
+// owner of docId and if it is private, a zero Key and false without a record
+func (a *Access) Get(docId uint64) (Key, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	offset, ok := entryOffset(docId, accessEntrySize, a.len)
+	if a.closed || !ok {
+		return Key{}, false
+	}
+	owner := Key{
+		Hash:  encoder.Uint64(a.mmap[offset : offset+byteSize]),
+		Check: encoder.Uint64(a.mmap[offset+byteSize : offset+2*byteSize]),
+	}
+	return owner, encoder.Uint64(a.mmap[offset+2*byteSize:offset+accessEntrySize]) == visibilityPrivate
+}
+
+// number of documents with a record and of private documents
+func (a *Access) Stats() (uint64, uint64) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.records, a.private
+}
+
+// write the owners set since the last sync to disk
+func (a *Access) Sync() error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return errors.New("access.index file is closed")
+	}
+	return syncFile(a.file, a.mmap)
+}
+
+// close the access.index
+func (a *Access) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	slog.Debug("[access.go] [Close()] closing access.index")
+	if a.closed {
+		return errors.New("file is closed")
+	}
+	if err := closeFile(a.file, a.mmap, a.len); err != nil {
+		return err
+	}
+	a.closed = true
+	a.mmap = nil
+	a.file = nil
+	return nil
+}
@@ -0,0 +1,88 @@
+package memorymapper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAccessReopen(t *testing.T) {
+	opts := testOptions(t)
+
+	access, err := NewAccess(opts)
+	if err != nil {
+		t.Fatalf("NewAccess(opts) = %v want <nil>", err)
+	}
+	access.Set(2, Key{Hash: 7, Check: 70}, true)
+	access.Set(3, Key{Hash: 7, Check: 70}, false)
+	access.Set(100000, Key{Hash: 9, Check: 90}, true)
+	// a record is replaced
+	access.Set(3, Key{Hash: 8, Check: 80}, true)
+	if err := access.Close(); err != nil {
+		t.Fatalf("Close() = %v want <nil>", err)
+	}
+
+	access, err = NewAccess(opts)
+	if err != nil {
+		t.Fatalf("NewAccess(opts) = %v want <nil>", err)
+	}
+	defer access.Close()
+	if err := access.Set(1<<60+2, Key{Hash: 9}, false); err != ErrMaxFileSize {
+		t.Errorf("Set(1<<60+2) = %v want %v", err, ErrMaxFileSize)
+	}
+	if records, private := access.Stats(); records != 3 || private != 3 {
+		t.Errorf("Stats() = %d, %d want 3, 3", records, private)
+	}
+	testCase := []struct {
+		docId   uint64
+		owner   Key
+		private bool
+	}{
+		{2, Key{Hash: 7, Check: 70}, true},
+		{3, Key{Hash: 8, Check: 80}, true},
+		{100000, Key{Hash: 9, Check: 90}, true},
+		{1, Key{}, false},
+		{200000, Key{}, false},
+		// the offset of docId 2 once multiplied without a bound check
+		{1<<60 + 2, Key{}, false},
+	}
+	for _, test := range testCase {
+		if owner, private := access.Get(test.docId); owner != test.owner || private != test.private {
+			t.Errorf("Get(%d) = %v, %v want %v, %v", test.docId, owner, private, test.owner, test.private)
+		}
+	}
+}
+
+func TestAccessUpgrade(t *testing.T) {
+	opts := testOptions(t)
+
+	// version 1 : [owner][visibility] records without check hash
+	data := make([]byte, headerSize+2*accessEntrySizeV1)
+	values := []uint64{accessMagic, 1, 2, 1, 7, visibilityPrivate, 0, visibilityPublic}
+	for i, value := range values {
+		encoder.PutUint64(data[uint64(i)*byteSize:], value)
+	}
+	if err := os.WriteFile(filepath.Join(opts.Dir, accessIndexFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	access, err := NewAccess(opts)
+	if err != nil {
+		t.Fatalf("NewAccess(opts) = %v want <nil>", err)
+	}
+	defer access.Close()
+	if records, private := access.Stats(); records != 2 || private != 1 {
+		t.Errorf("Stats() = %d, %d want 2, 1", records, private)
+	}
+	if owner, private := access.Get(0); owner != (Key{Hash: 7}) || !private {
+		t.Errorf("Get(0) = %v, %v want {7 0}, true", owner, private)
+	}
+	if owner, private := access.Get(1); owner != (Key{}) || private {
+		t.Errorf("Get(1) = %v, %v want {0 0}, false", owner, private)
+	}
+	// records written after the upgrade keep their check hash
+	access.Set(2, Key{Hash: 8, Check: 80}, false)
+	if owner, _ := access.Get(2); owner != (Key{Hash: 8, Check: 80}) {
+		t.Errorf("Get(2) = %v want {8 80}", owner)
+	}
+}
@@ -0,0 +1,109 @@
+package memorymapper
+
+import (
+	"fmt"
+	"sync"
+)
+
+// postings of the documents indexed since the last flush, kept in memory
+// Segments.Flush() writes them as a new segment once Segments.Full() reports the buffer as full
+// the buffer is lost on a crash, the documents after the last flushed docId are indexed again from the document store
+type Buffer struct {
+	mu       sync.RWMutex // Search() holds RLock, Add() and flushing hold Lock
+	postings map[Key][]PostingEntry
+	docs     uint64 // number of buffered documents
+	bytes    uint64 // size of the postings once compressed
+	maxDocId uint64 // largest buffered docId
+}
+
+func NewBuffer() *Buffer {
+	return &Buffer{postings: make(map[Key][]PostingEntry)}
+}
+
+// add entries, sorted by docId, to the posting list of key
+// docIds must be after the last buffered docId of key
+func (b *Buffer) Add(key Key, entries ...PostingEntry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := b.postings[key]
+	prev := uint64(0)
+	if len(list) > 0 {
+		prev = list[len(list)-1].DocId
+	}
+	// check every entry first, a rejected batch leaves the buffer and its counters as they were
+	last := prev
+	for _, entry := range entries {
+		if entry.DocId <= last {
+			return fmt.Errorf("docId %d is not after the last docId %d of the word", entry.DocId, last)
+		}
+		last = entry.DocId
+	}
+	for _, entry := range entries {
+		b.bytes += varintEntrySize(entry, prev)
+		prev = entry.DocId
+		// docIds increase across words of a batch too, a larger docId is a new document
+		if entry.DocId > b.maxDocId {
+			b.maxDocId = entry.DocId
+			b.docs++
+		}
+	}
+	b.postings[key] = append(list, entries...)
+	return nil
+}
+
+// buffered entries of key
+func (b *Buffer) Search(key Key) []PostingEntry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]PostingEntry{}, b.postings[key]...)
+}
+
+// buffered entries of key with a docId in sorted docIds
+func (b *Buffer) Seek(key Key, docIds []uint64) []PostingEntry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return filterEntries(b.postings[key], docIds)
+}
+
+// number of buffered docIds of key
+func (b *Buffer) DocFreq(key Key) uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return uint64(len(b.postings[key]))
+}
+
+// check if key has buffered docIds
+func (b *Buffer) HasWord(key Key) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok := b.postings[key]
+	return ok
+}
+
+// add every buffered word to seen
+func (b *Buffer) Words(seen map[Key]struct{}) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for key := range b.postings {
+		seen[key] = struct{}{}
+	}
+}
+
+// number of buffered documents and the size of their postings
+func (b *Buffer) Stats() (uint64, uint64) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.docs, b.bytes
+}
+
+// drop every buffered entry
+func (b *Buffer) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reset()
+}
+
+func (b *Buffer) reset() {
+	b.postings = make(map[Key][]PostingEntry)
+	b.docs, b.bytes = 0, 0
+}
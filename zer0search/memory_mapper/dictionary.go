@@ -5,135 +5,285 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
-	"path/filepath"
 	"searchengine/utils"
+	"sync"
 
 	"github.com/tysonmote/gommap"
 )
 
+// dictionary.index is an open addressing hash table keyed by the hash of a word
+// [header][slot 0][slot 1]...[slot capacity-1]
+// a slot with postingOffset 0 is empty, a stored slice never starts inside the posting.index header
+// a segment sizes the table for its words under dictMaxLoad, it is not written again
+// a slot keeps a second hash of its word, a lookup matches both, so words with the same hash do not share postings
+// they are chained along the probe sequence, each in its own slot
+// version 2 slots have no check hash, their words match by hash alone until Segments.Upgrade() rewrites them
 type Dictionary struct {
-	file   *os.File
-	mmap   gommap.MMap // mmap
-	len    uint64      // current size
-	closed bool        // flag to check if the directory.index is closed
+	mu        sync.RWMutex // Search() and Walk() hold RLock, Close() holds Lock
+	path      string
+	file      *os.File
+	mmap      gommap.MMap // mmap
+	len       uint64      // current size, header + slots
+	count     uint64      // number of words stored
+	capacity  uint64      // number of slots, power of two
+	entrySize uint64      // size of a slot, dictEntrySize or hashEntrySize of version 2
+	opts      Options     // file sizes the table starts at and grows within
+	closed    bool        // flag to check if the directory.index is closed
 }
 
-func NewDictionary() (*Dictionary, error) {
-	os.Remove(filepath.Join(utils.Path, dictIndexFile))
-	dict := &Dictionary{}
-	file, err := os.OpenFile(filepath.Join(utils.Path, dictIndexFile), os.O_CREATE|os.O_RDWR, 0644)
-	if err != nil {
+// a word of the index, Hash places it in the table and Check tells apart words with the same Hash
+type Key struct {
+	Hash  uint64
+	Check uint64
+}
+
+// key of word, its hashes of the two seeds of utils
+func WordKey(word string) Key {
+	hasher := utils.NewHash()
+	hasher.WriteString(word)
+	checker := utils.NewCheckHash()
+	checker.WriteString(word)
+	return Key{Hash: hasher.Sum(), Check: checker.Sum()}
+}
+
+// open the dictionary.index at path, its words are restored from the header
+// a segment writes its table at once, an older file is upgraded in place
+func openDictionary(path string, opts Options) (*Dictionary, error) {
+	dict := &Dictionary{opts: opts}
+	if err := dict.open(path); err != nil {
 		return nil, err
 	}
-	dict.closed = false
-	info, err := file.Stat()
+	return dict, nil
+}
+
+func (d *Dictionary) open(path string) error {
+	file, mmap, size, err := mapFile(path, d.opts)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	size := info.Size()
-	dict.len = uint64(size)
-	// allocate capacity
-	if err := file.Truncate(int64(MaxFileSize)); err != nil {
-		return nil, err
+	d.path = path
+	d.file = file
+	d.mmap = mmap
+	d.closed = false
+	if err := d.load(size); err != nil {
+		mmap.UnsafeUnmap()
+		file.Close()
+		d.closed = true
+		return err
 	}
-	dict.file = file
-	mmap, err := gommap.Map(
-		dict.file.Fd(),
-		gommap.PROT_READ|gommap.PROT_WRITE,
-		gommap.MAP_SHARED,
-	)
+	return nil
+}
+
+// restore count and capacity from the header, upgrade an append only (version 1) file
+func (d *Dictionary) load(size uint64) error {
+	version, err := loadHeader(d.mmap, dictMagic, dictVersion, size)
 	if err != nil {
-		file.Close()
-		return nil, err
+		return err
 	}
-	dict.mmap = mmap
-	return dict, nil
+	d.entrySize = dictEntrySize
+	if version < 3 {
+		d.entrySize = hashEntrySize
+	}
+	if size == 0 {
+		d.count = 0
+		d.capacity = dictCapacity(0, d.opts.InitialFileSize)
+		d.len = headerSize + d.capacity*d.entrySize
+		putField(d.mmap, extraField, d.capacity)
+		return nil
+	}
+	if version == 1 {
+		return d.upgrade()
+	}
+	d.count = getField(d.mmap, lenField)
+	d.capacity = getField(d.mmap, extraField)
+	d.len = headerSize + d.capacity*d.entrySize
+	if d.capacity == 0 || d.capacity&(d.capacity-1) != 0 || d.len > uint64(len(d.mmap)) || d.count > d.capacity {
+		return fmt.Errorf("dictionary.index has invalid capacity %d for %d words", d.capacity, d.count)
+	}
+	return nil
+}
+
+// version 1 stored entries one after another, [header][entry]...
+// read them and insert again as a version 2 hash table, the words are unknown so the slots have no check hash
+func (d *Dictionary) upgrade() error {
+	end := getField(d.mmap, lenField)
+	if end < headerSize || end > uint64(len(d.mmap)) || (end-headerSize)%hashEntrySize != 0 {
+		return fmt.Errorf("dictionary.index has invalid len %d", end)
+	}
+	entries := make([]uint64, 0, (end-headerSize)/byteSize)
+	for offset := headerSize; offset < end; offset += byteSize {
+		entries = append(entries, encoder.Uint64(d.mmap[offset:offset+byteSize]))
+	}
+
+	d.capacity = dictCapacity(uint64(len(entries))/3, d.opts.InitialFileSize)
+	d.len = headerSize + d.capacity*d.entrySize
+	d.count = 0
+	mmap, err := growFile(d.file, d.mmap, d.len, d.opts.MaxFileSize)
+	if err != nil {
+		return err
+	}
+	d.mmap = mmap
+	clear(d.mmap[headerSize:d.len])
+	putField(d.mmap, versionField, 2)
+	putField(d.mmap, lenField, 0)
+	putField(d.mmap, extraField, d.capacity)
+	for j := 0; j+2 < len(entries); j += 3 {
+		if err := d.append(Key{Hash: entries[j]}, entries[j+1], entries[j+2]); err != nil {
+			return err
+		}
+	}
+	slog.Info("[dictionary.go] [upgrade()] dictionary.index upgraded to hash table", "words", d.count)
+	return nil
+}
+
+// smallest power of two number of slots holding words under dictMaxLoad
+// and at least filling initialSize
+func dictCapacity(words, initialSize uint64) uint64 {
+	capacity := uint64(1)
+	for headerSize+2*capacity*dictEntrySize <= initialSize || words*100 > capacity*dictMaxLoad {
+		capacity *= 2
+	}
+	return capacity
 }
 
 // search in dictionary.index
-// [wordHash][postingOffset][postingLength]
-// [uint64][uint64][uint64]
-// [8][8][8] -> 24bytes
+// [wordHash][check][postingOffset][postingLength]
+// [uint64][uint64][uint64][uint64]
+// [8][8][8][8] -> 32bytes
+// probe from slot (wordHash % capacity) until the word or an empty slot is found
+// a slot of the same hash and another check is a colliding word, the probe goes on
 // returns offsetOfWord, postingOffset, postingLen
-func (d *Dictionary) Search(wordHash uint64) (bool, uint64, uint64, uint64, error) {
+func (d *Dictionary) Search(key Key) (bool, uint64, uint64, uint64, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	if d.closed {
 		return false, uint64(0), uint64(0), uint64(0), errors.New("dictionary.index file is closed")
 	}
-	for j := uint64(0); j+dictEntrySize <= d.len; j += dictEntrySize {
-		offset := j
-		storedHash := encoder.Uint64(d.mmap[offset : offset+byteSize])
-		offset += byteSize
-		postingOffset := encoder.Uint64(d.mmap[offset : offset+byteSize])
-		offset += byteSize
-		positionLength := encoder.Uint64(d.mmap[offset : offset+byteSize])
-		if storedHash == wordHash {
-			return true, uint64(j), postingOffset, positionLength, nil
-		}
+	offset, found := probe(d.mmap, d.capacity, d.entrySize, key)
+	if !found {
+		return false, uint64(0), uint64(0), uint64(0), nil
 	}
-	return false, uint64(0), uint64(0), uint64(0), nil
+	_, postingOffset, postingLen := d.read(offset)
+	return true, offset, postingOffset, postingLen, nil
 }
 
-// append in dictionary.index
-func (d *Dictionary) Append(hash, postingOffset, postingLen uint64) error {
-	if d.closed {
-		return errors.New("file is closed")
+// find the slot of key in table of slots of entrySize, or the first empty slot where it would be stored
+// a version 2 slot has no check hash, the hash alone matches
+func probe(table []byte, capacity, entrySize uint64, key Key) (uint64, bool) {
+	mask := capacity - 1
+	slot := key.Hash & mask
+	for i := uint64(0); i < capacity; i++ {
+		offset := headerSize + slot*entrySize
+		stored, postingOffset, _ := readSlot(table, offset, entrySize)
+		if postingOffset == 0 {
+			return offset, false
+		}
+		if stored.Hash == key.Hash && (entrySize == hashEntrySize || stored.Check == key.Check) {
+			return offset, true
+		}
+		slot = (slot + 1) & mask
 	}
-	if d.IsFilled(dictEntrySize) {
-		return errors.New("max filesize reached")
+	return 0, false
+}
+
+// store key in the first empty slot of its probe sequence, the table must have room for it
+func (d *Dictionary) append(key Key, postingOffset, postingLen uint64) error {
+	offset, found := probe(d.mmap, d.capacity, d.entrySize, key)
+	if found || offset == 0 {
+		return errors.New("word is already stored")
 	}
-	offset := d.len
-	encoder.PutUint64(d.mmap[offset:offset+byteSize], hash)
-	offset += byteSize
-	encoder.PutUint64(d.mmap[offset:offset+byteSize], postingOffset)
-	offset += byteSize
-	encoder.PutUint64(d.mmap[offset:offset+byteSize], postingLen)
-	offset += byteSize
-	d.len += dictEntrySize
+	d.write(offset, key, postingOffset, postingLen)
+	d.count++
+	putField(d.mmap, lenField, d.count)
 	return nil
 }
 
-// update postingOffset and postingLen stored at offset
-func (d *Dictionary) Update(offset, postingOffset, postingLen uint64) error {
+// walk every word of dictionary.index in slot order, offset is the slot of the word
+// stops at the first error returned by fn, fn must not call back into the dictionary
+func (d *Dictionary) Walk(fn func(offset uint64, key Key, postingOffset, postingLen uint64) error) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.walk(fn)
+}
+
+func (d *Dictionary) walk(fn func(offset uint64, key Key, postingOffset, postingLen uint64) error) error {
 	if d.closed {
-		return errors.New("file is closed")
+		return errors.New("dictionary.index file is closed")
 	}
-	if offset+dictEntrySize > d.len {
-		return errors.New("[error] : SGMNT_FLT")
+	for offset := headerSize; offset+d.entrySize <= d.len; offset += d.entrySize {
+		key, postingOffset, postingLen := d.read(offset)
+		if postingOffset == 0 {
+			continue
+		}
+		if err := fn(offset, key, postingOffset, postingLen); err != nil {
+			return err
+		}
 	}
-	initialOffset := offset + byteSize
-	encoder.PutUint64(d.mmap[initialOffset:initialOffset+byteSize], postingOffset)
-	initialOffset += byteSize
-	encoder.PutUint64(d.mmap[initialOffset:initialOffset+byteSize], postingLen)
 	return nil
 }
 
-// check if there is enough space with size
-func (d *Dictionary) IsFilled(size uint64) bool {
-	return d.len+size > MaxFileSize
+// number of words stored in dictionary.index
+func (d *Dictionary) Count() uint64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.count
+}
+
+// check if the slots keep the check hash of their word, a version 2 table matches words by hash alone
+func (d *Dictionary) Checked() bool {
+	return d.entrySize == dictEntrySize
+}
+
+// read the slot stored at offset
+func (d *Dictionary) read(offset uint64) (Key, uint64, uint64) {
+	return readSlot(d.mmap, offset, d.entrySize)
+}
+
+// write the slot stored at offset
+func (d *Dictionary) write(offset uint64, key Key, postingOffset, postingLen uint64) {
+	putSlot(d.mmap, offset, d.entrySize, key, postingOffset, postingLen)
+}
+
+// read a slot of entrySize at offset of table, the check hash of a version 2 slot is 0
+func readSlot(table []byte, offset, entrySize uint64) (Key, uint64, uint64) {
+	key := Key{Hash: encoder.Uint64(table[offset : offset+byteSize])}
+	offset += byteSize
+	if entrySize == dictEntrySize {
+		key.Check = encoder.Uint64(table[offset : offset+byteSize])
+		offset += byteSize
+	}
+	postingOffset := encoder.Uint64(table[offset : offset+byteSize])
+	offset += byteSize
+	postingLen := encoder.Uint64(table[offset : offset+byteSize])
+	return key, postingOffset, postingLen
+}
+
+// write a slot of entrySize at offset of table
+func putSlot(table []byte, offset, entrySize uint64, key Key, postingOffset, postingLen uint64) {
+	encoder.PutUint64(table[offset:offset+byteSize], key.Hash)
+	offset += byteSize
+	if entrySize == dictEntrySize {
+		encoder.PutUint64(table[offset:offset+byteSize], key.Check)
+		offset += byteSize
+	}
+	encoder.PutUint64(table[offset:offset+byteSize], postingOffset)
+	offset += byteSize
+	encoder.PutUint64(table[offset:offset+byteSize], postingLen)
 }
 
 // close the dictionary.index
 func (d *Dictionary) Close() error {
-	slog.Info("[INSIDE] dictionary.go -> Close()")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.close()
+}
+
+func (d *Dictionary) close() error {
+	slog.Debug("[dictionary.go] [Close()] closing dictionary.index", "path", d.path)
 	if d.closed {
 		return errors.New("file is closed")
 	}
-	if err := d.mmap.Sync(gommap.MS_SYNC); err != nil {
-		return err
-	}
-	if err := d.file.Sync(); err != nil {
-		return err
-	}
-	if err := d.file.Truncate(int64(d.len)); err != nil {
-		return err
-	}
-	if err := d.file.Sync(); err != nil {
-		return err
-	}
-	if err := d.mmap.UnsafeUnmap(); err != nil {
-		return err
-	}
-	if err := d.file.Close(); err != nil {
+	if err := closeFile(d.file, d.mmap, d.len); err != nil {
 		return err
 	}
 	d.closed = true
@@ -144,13 +294,14 @@ func (d *Dictionary) Close() error {
 
 // debug information
 func (d *Dictionary) Debug() {
-	for j := uint64(0); j+dictEntrySize <= d.len; j += dictEntrySize {
-		offset := j
-		storedHash := encoder.Uint64(d.mmap[offset : offset+byteSize])
-		offset += byteSize
-		postingOffset := encoder.Uint64(d.mmap[offset : offset+byteSize])
-		offset += byteSize
-		positionLength := encoder.Uint64(d.mmap[offset : offset+byteSize])
-		fmt.Println("offset: ", j, "shoredHash: ", storedHash, "postingOffset: ", postingOffset, "postingLen: ", positionLength)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	fmt.Println(" [debug] words: ", d.count, "slots: ", d.capacity)
+	for offset := headerSize; offset+d.entrySize <= d.len; offset += d.entrySize {
+		key, postingOffset, postingLen := d.read(offset)
+		if postingOffset == 0 {
+			continue
+		}
+		fmt.Println("offset: ", offset, "shoredHash: ", key.Hash, "check: ", key.Check, "postingOffset: ", postingOffset, "postingLen: ", postingLen)
 	}
 }
@@ -1,2 +1,136 @@
 package memorymapper
 
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// options with an empty directory for the index files
+func testOptions(t *testing.T) Options {
+	t.Helper()
+	opts := DefaultOptions(t.TempDir())
+	if err := os.MkdirAll(filepath.Join(opts.Dir, "memory_mapper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+// dictionary.index of keys in a table of capacity slots, as writeSegment() writes it
+// key i points at posting offset 100+i
+func testDictionary(t *testing.T, capacity uint64, keys []Key) *Dictionary {
+	t.Helper()
+	table := make([]byte, headerSize+capacity*dictEntrySize)
+	putField(table, magicField, dictMagic)
+	putField(table, versionField, dictVersion)
+	putField(table, lenField, uint64(len(keys)))
+	putField(table, extraField, capacity)
+	for i, key := range keys {
+		slot, found := probe(table, capacity, dictEntrySize, key)
+		if found {
+			t.Fatalf("probe(%v) = found want an empty slot", key)
+		}
+		putSlot(table, slot, dictEntrySize, key, uint64(100+i), 1)
+	}
+	path := filepath.Join(t.TempDir(), filepath.Base(dictIndexFile))
+	if err := os.WriteFile(path, table, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dict, err := openDictionary(path, DefaultOptions(t.TempDir()))
+	if err != nil {
+		t.Fatalf("openDictionary(%s) = %v want <nil>", path, err)
+	}
+	t.Cleanup(func() { dict.Close() })
+	return dict
+}
+
+func TestDictionaryBadMagic(t *testing.T) {
+	opts := testOptions(t)
+
+	path := filepath.Join(opts.Dir, dictIndexFile)
+	if err := os.WriteFile(path, make([]byte, headerSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openDictionary(path, opts); err == nil {
+		t.Errorf("openDictionary(%s) = <nil> want error for wrong magic", path)
+	}
+}
+
+func TestDictionaryProbe(t *testing.T) {
+	// every hash lands on the same slot, so they are stored by linear probing
+	capacity := uint64(16)
+	hashes := []uint64{5, 5 + capacity, 5 + 2*capacity, 5 + 3*capacity}
+	keys := make([]Key, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = Key{Hash: hash}
+	}
+	dict := testDictionary(t, capacity, keys)
+
+	for i, hash := range hashes {
+		found, offset, postingOffset, _, err := dict.Search(Key{Hash: hash})
+		if err != nil || !found || postingOffset != uint64(100+i) {
+			t.Errorf("Search(%d) = %v, %d, %v want true, %d, <nil>", hash, found, postingOffset, err, 100+i)
+		}
+		if want := headerSize + (5+uint64(i))*dictEntrySize; offset != want {
+			t.Errorf("Search(%d) offset = %d want %d", hash, offset, want)
+		}
+	}
+	if found, _, _, _, _ := dict.Search(Key{Hash: 5 + 4*capacity}); found {
+		t.Errorf("Search(%d) = true want false", 5+4*capacity)
+	}
+}
+
+func TestDictionaryCollision(t *testing.T) {
+	// words of the same hash are told apart by their check hash, each keeps its own slot
+	dict := testDictionary(t, 16, []Key{{Hash: 7, Check: 1}, {Hash: 7, Check: 2}})
+
+	testCase := []struct {
+		key           Key
+		found         bool
+		postingOffset uint64
+	}{
+		{Key{Hash: 7, Check: 1}, true, 100},
+		{Key{Hash: 7, Check: 2}, true, 101},
+		{Key{Hash: 7, Check: 3}, false, 0},
+		{Key{Hash: 8, Check: 1}, false, 0},
+	}
+	for _, test := range testCase {
+		found, _, postingOffset, _, err := dict.Search(test.key)
+		if err != nil || found != test.found || postingOffset != test.postingOffset {
+			t.Errorf("Search(%v) = %v, %d, %v want %v, %d, <nil>", test.key, found, postingOffset, err, test.found, test.postingOffset)
+		}
+	}
+	if dict.Count() != 2 {
+		t.Errorf("Count() = %d want 2", dict.Count())
+	}
+}
+
+func TestDictionaryUpgrade(t *testing.T) {
+	opts := testOptions(t)
+
+	// version 1 : entries stored one after another
+	data := make([]byte, headerSize+2*hashEntrySize)
+	values := []uint64{dictMagic, 1, headerSize + 2*hashEntrySize, 0, 11, 100, 1, 22, 200, 3}
+	for i, value := range values {
+		encoder.PutUint64(data[uint64(i)*byteSize:], value)
+	}
+	path := filepath.Join(opts.Dir, dictIndexFile)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dict, err := openDictionary(path, opts)
+	if err != nil {
+		t.Fatalf("openDictionary(%s) = %v want <nil>", path, err)
+	}
+	defer dict.Close()
+
+	if dict.Count() != 2 || dict.Checked() {
+		t.Errorf("Count(), Checked() = %d, %v want 2, false", dict.Count(), dict.Checked())
+	}
+	// the words are unknown, any check hash matches until the segment is upgraded
+	found, _, postingOffset, postingLen, err := dict.Search(Key{Hash: 22, Check: 7})
+	if err != nil || !found || postingOffset != 200 || postingLen != 3 {
+		t.Errorf("Search(22) = %v, %d, %d, %v want true, 200, 3, <nil>", found, postingOffset, postingLen, err)
+	}
+}
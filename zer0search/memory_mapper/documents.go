@@ -0,0 +1,248 @@
+package memorymapper
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/tysonmote/gommap"
+)
+
+// embedded document store, an append only log of documents and an offset index by docId
+// docs.dat : [header][docId][len][bytes]...[docId][len][bytes]...
+// docs.idx : [header][offset of docId 0][offset of docId 1]...
+// docs.dat header len is the end of written data, extra is the bytes of deleted documents
+// docs.idx header len is the number of stored documents, extra is the largest stored docId
+// offset 0 in docs.idx means docId is not stored, a record never starts inside the header
+type Documents struct {
+	mu       sync.RWMutex // Get() holds RLock, writes and remapping hold Lock
+	dataFile *os.File
+	data     gommap.MMap // mmap of docs.dat
+	dataLen  uint64      // end of written data
+	dead     uint64      // bytes of deleted documents
+	idxFile  *os.File
+	idx      gommap.MMap // mmap of docs.idx
+	idxLen   uint64      // current size of docs.idx
+	count    uint64      // number of stored documents
+	last     uint64      // largest stored docId
+	maxSize  uint64      // size neither file grows past
+	closed   bool        // flag to check if the store is closed
+}
+
+var ErrDocumentNotFound = errors.New("document not found")
+
+// open docs.dat and docs.idx, existing files are reopened and their state restored from the headers
+func NewDocuments(opts Options) (*Documents, error) {
+	dataFile, data, dataSize, err := mapFile(opts.path(docsDataFile), opts)
+	if err != nil {
+		return nil, err
+	}
+	idxFile, idx, idxSize, err := mapFile(opts.path(docsIndexFile), opts)
+	if err != nil {
+		data.UnsafeUnmap()
+		dataFile.Close()
+		return nil, err
+	}
+	d := &Documents{
+		dataFile: dataFile,
+		data:     data,
+		idxFile:  idxFile,
+		idx:      idx,
+		maxSize:  opts.MaxFileSize,
+	}
+	if err := d.load(dataSize, idxSize); err != nil {
+		data.UnsafeUnmap()
+		dataFile.Close()
+		idx.UnsafeUnmap()
+		idxFile.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Documents) load(dataSize, idxSize uint64) error {
+	if _, err := loadHeader(d.data, docsMagic, docsVersion, dataSize); err != nil {
+		return err
+	}
+	if _, err := loadHeader(d.idx, docsIdxMagic, docsVersion, idxSize); err != nil {
+		return err
+	}
+	d.dataLen = max(getField(d.data, lenField), headerSize)
+	d.dead = getField(d.data, extraField)
+	d.idxLen = max(idxSize, headerSize)
+	d.count = getField(d.idx, lenField)
+	d.last = getField(d.idx, extraField)
+	if (dataSize != 0 && d.dataLen > dataSize) || d.dead > d.dataLen {
+		return fmt.Errorf("docs.dat has invalid len %d", d.dataLen)
+	}
+	if d.last != 0 && headerSize+(d.last+1)*byteSize > d.idxLen {
+		return fmt.Errorf("docs.idx is too small for docId %d", d.last)
+	}
+	return nil
+}
+
+// append document to docs.dat and store its offset in docs.idx
+// the record is written before the offset, a crash in between leaves only an unreachable record
+func (d *Documents) Append(docId uint64, document string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return errors.New("document store is closed")
+	}
+	if docId == 0 {
+		return errors.New("docId 0 can not be stored")
+	}
+	idxOffset := headerSize + docId*byteSize
+	if idxOffset+byteSize > uint64(len(d.idx)) {
+		idx, err := growFile(d.idxFile, d.idx, idxOffset+byteSize, d.maxSize)
+		d.idx = idx
+		if err != nil {
+			return d.failed(err)
+		}
+	}
+	if idxOffset+byteSize <= d.idxLen && encoder.Uint64(d.idx[idxOffset:idxOffset+byteSize]) != 0 {
+		return fmt.Errorf("docId %d is already stored", docId)
+	}
+
+	size := 2*byteSize + uint64(len(document))
+	if d.dataLen+size > uint64(len(d.data)) {
+		data, err := growFile(d.dataFile, d.data, d.dataLen+size, d.maxSize)
+		d.data = data
+		if err != nil {
+			return d.failed(err)
+		}
+	}
+	offset := d.dataLen
+	encoder.PutUint64(d.data[offset:offset+byteSize], docId)
+	encoder.PutUint64(d.data[offset+byteSize:offset+2*byteSize], uint64(len(document)))
+	copy(d.data[offset+2*byteSize:offset+size], document)
+	d.dataLen += size
+	putField(d.data, lenField, d.dataLen)
+
+	encoder.PutUint64(d.idx[idxOffset:idxOffset+byteSize], offset)
+	d.count++
+	d.last = max(d.last, docId)
+	putField(d.idx, lenField, d.count)
+	putField(d.idx, extraField, d.last)
+	d.idxLen = max(d.idxLen, idxOffset+byteSize)
+	return nil
+}
+
+// a failed growFile() leaves no mapping when it could not map the file again, the store is closed
+func (d *Documents) failed(err error) error {
+	if d.data == nil || d.idx == nil {
+		d.close()
+	}
+	return err
+}
+
+// document stored under docId
+func (d *Documents) Get(docId uint64) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return "", errors.New("document store is closed")
+	}
+	offset, size, err := d.record(docId)
+	if err != nil {
+		return "", err
+	}
+	return string(d.data[offset+2*byteSize : offset+size]), nil
+}
+
+// offset and size of the record of docId in docs.dat
+func (d *Documents) record(docId uint64) (uint64, uint64, error) {
+	idxOffset := headerSize + docId*byteSize
+	if docId == 0 || idxOffset+byteSize > d.idxLen {
+		return 0, 0, ErrDocumentNotFound
+	}
+	offset := encoder.Uint64(d.idx[idxOffset : idxOffset+byteSize])
+	if offset == 0 {
+		return 0, 0, ErrDocumentNotFound
+	}
+	if offset < headerSize || offset+2*byteSize > d.dataLen {
+		return 0, 0, fmt.Errorf("docId %d has offset %d out of docs.dat", docId, offset)
+	}
+	storedId := encoder.Uint64(d.data[offset : offset+byteSize])
+	size := 2*byteSize + encoder.Uint64(d.data[offset+byteSize:offset+2*byteSize])
+	if storedId != docId || offset+size > d.dataLen {
+		return 0, 0, fmt.Errorf("docId %d has invalid record at offset %d", docId, offset)
+	}
+	return offset, size, nil
+}
+
+// remove docId from docs.idx, its record in docs.dat is dead
+// returns false if docId is not stored
+func (d *Documents) Delete(docId uint64) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false, errors.New("document store is closed")
+	}
+	_, size, err := d.record(docId)
+	if errors.Is(err, ErrDocumentNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	idxOffset := headerSize + docId*byteSize
+	encoder.PutUint64(d.idx[idxOffset:idxOffset+byteSize], 0)
+	d.count--
+	d.dead += size
+	putField(d.idx, lenField, d.count)
+	putField(d.data, extraField, d.dead)
+	return true, nil
+}
+
+// number of stored documents and the largest docId stored
+func (d *Documents) Stats() (uint64, uint64) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.count, d.last
+}
+
+// write the documents appended and deleted since the last sync to disk
+func (d *Documents) Sync() error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return errors.New("document store is closed")
+	}
+	return errors.Join(
+		syncFile(d.dataFile, d.data),
+		syncFile(d.idxFile, d.idx),
+	)
+}
+
+// close docs.dat and docs.idx
+func (d *Documents) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	slog.Debug("[documents.go] [Close()] closing docs.dat and docs.idx")
+	if d.closed {
+		return errors.New("file is closed")
+	}
+	return d.close()
+}
+
+func (d *Documents) close() error {
+	d.closed = true
+	err := errors.Join(
+		closeMapped(d.dataFile, d.data, d.dataLen),
+		closeMapped(d.idxFile, d.idx, d.idxLen),
+	)
+	d.data, d.idx = nil, nil
+	d.dataFile, d.idxFile = nil, nil
+	return err
+}
+
+// close a file whose mapping may already be gone after a failed growFile()
+func closeMapped(file *os.File, mmap gommap.MMap, len uint64) error {
+	if mmap == nil {
+		return file.Close()
+	}
+	return closeFile(file, mmap, len)
+}
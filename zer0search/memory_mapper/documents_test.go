@@ -0,0 +1,60 @@
+package memorymapper
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDocumentsReopen(t *testing.T) {
+	opts := testOptions(t)
+	opts.InitialFileSize = 4096
+
+	docs, err := NewDocuments(opts)
+	if err != nil {
+		t.Fatalf("NewDocuments(opts) = %v want <nil>", err)
+	}
+	// larger than opts.InitialFileSize, docs.dat grows
+	long := strings.Repeat("word ", 2000)
+	want := map[uint64]string{1: "first document", 2: long, 5: "fifth document"}
+	for docId, document := range want {
+		if err := docs.Append(docId, document); err != nil {
+			t.Fatalf("Append(%d) = %v want <nil>", docId, err)
+		}
+	}
+	if err := docs.Append(1, "again"); err == nil {
+		t.Errorf("Append(1) = <nil> want error for a stored docId")
+	}
+	if deleted, err := docs.Delete(2); !deleted || err != nil {
+		t.Fatalf("Delete(2) = %v, %v want true, <nil>", deleted, err)
+	}
+	delete(want, 2)
+	if err := docs.Sync(); err != nil {
+		t.Fatalf("Sync() = %v want <nil>", err)
+	}
+	if err := docs.Close(); err != nil {
+		t.Fatalf("Close() = %v want <nil>", err)
+	}
+
+	docs, err = NewDocuments(opts)
+	if err != nil {
+		t.Fatalf("NewDocuments(opts) = %v want <nil>", err)
+	}
+	defer docs.Close()
+	if count, last := docs.Stats(); count != 2 || last != 5 {
+		t.Errorf("Stats() = %d, %d want 2, 5", count, last)
+	}
+	for docId, document := range want {
+		if got, err := docs.Get(docId); err != nil || got != document {
+			t.Errorf("Get(%d) = %q, %v want %q, <nil>", docId, got, err, document)
+		}
+	}
+	for _, docId := range []uint64{0, 2, 3, 100} {
+		if _, err := docs.Get(docId); !errors.Is(err, ErrDocumentNotFound) {
+			t.Errorf("Get(%d) = %v want %v", docId, err, ErrDocumentNotFound)
+		}
+	}
+	if deleted, err := docs.Delete(2); deleted || err != nil {
+		t.Errorf("Delete(2) = %v, %v want false, <nil>", deleted, err)
+	}
+}
@@ -0,0 +1,69 @@
+package memorymapper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/tysonmote/gommap"
+)
+
+// header stored at the beginning of every index file
+// [magic][version][len][extra]
+// [uint64][uint64][uint64][uint64]
+// [8][8][8][8] -> 32bytes
+// posting.index : len is the end of written data, so a reopened file knows where to continue
+// dictionary.index : len is the number of words, extra is the number of slots
+const (
+	magicField = iota
+	versionField
+	lenField
+	extraField
+)
+
+// read the header of an existing file or write a fresh one,
+// size is the file size before it was mapped
+// versions older than version are accepted, the caller upgrades them
+// returns the stored version
+func loadHeader(mmap gommap.MMap, magic, version, size uint64) (uint64, error) {
+	if size == 0 {
+		putField(mmap, magicField, magic)
+		putField(mmap, versionField, version)
+		putField(mmap, lenField, 0)
+		putField(mmap, extraField, 0)
+		return version, nil
+	}
+	if size < headerSize {
+		return 0, errors.New("index file is too small to hold a header")
+	}
+	if storedMagic := getField(mmap, magicField); storedMagic != magic {
+		return 0, fmt.Errorf("index file has wrong magic %x", storedMagic)
+	}
+	storedVersion := getField(mmap, versionField)
+	if storedVersion == 0 || storedVersion > version {
+		return 0, fmt.Errorf("index file has unsupported version %d", storedVersion)
+	}
+	return storedVersion, nil
+}
+
+func getField(mmap gommap.MMap, field uint64) uint64 {
+	return encoder.Uint64(mmap[field*byteSize : (field+1)*byteSize])
+}
+
+func putField(mmap gommap.MMap, field uint64, value uint64) {
+	encoder.PutUint64(mmap[field*byteSize:(field+1)*byteSize], value)
+}
+
+// remove the segments, dictionary.index, posting.index, norms.index, tombstones.index, terms.index, access.index, index.wal,
+// the analyzer config, the schema and the embedded document store, used to start from an empty index
+func RemoveIndexFiles(opts Options) error {
+	if err := os.RemoveAll(opts.path(segmentsDir)); err != nil {
+		return err
+	}
+	for _, name := range []string{dictIndexFile, postingIndexFile, normsIndexFile, tombstonesIndexFile, termsIndexFile, accessIndexFile, walFile, AnalyzerFile, SchemaFile, docsDataFile, docsIndexFile} {
+		if err := os.Remove(opts.path(name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
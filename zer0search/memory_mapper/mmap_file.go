@@ -0,0 +1,132 @@
+package memorymapper
+
+import (
+	"os"
+
+	"github.com/tysonmote/gommap"
+)
+
+// mapped files start at Options.InitialFileSize and grow on demand
+// growing unmaps the file, so every read and write of a mapping holds its lock
+// and no slice of the mapping is returned to a caller
+
+// open path and map it with at least opts.InitialFileSize bytes
+// returns size of the file before it was mapped, 0 for a new file
+func mapFile(path string, opts Options) (*os.File, gommap.MMap, uint64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, 0, err
+	}
+	size := uint64(info.Size())
+	if size > opts.MaxFileSize {
+		file.Close()
+		return nil, nil, 0, ErrMaxFileSize
+	}
+	// allocate capacity
+	mmap, err := mapSize(file, max(size, opts.InitialFileSize))
+	if err != nil {
+		file.Close()
+		return nil, nil, 0, err
+	}
+	return file, mmap, size, nil
+}
+
+// truncate file to size and map all of it
+func mapSize(file *os.File, size uint64) (gommap.MMap, error) {
+	if err := file.Truncate(int64(size)); err != nil {
+		return nil, err
+	}
+	return gommap.Map(
+		file.Fd(),
+		gommap.PROT_READ|gommap.PROT_WRITE,
+		gommap.MAP_SHARED,
+	)
+}
+
+// remap file so it holds at least need bytes
+// the size is doubled, by at most maxGrowStep at a time, and never passes maxSize
+func growFile(file *os.File, mmap gommap.MMap, need, maxSize uint64) (gommap.MMap, error) {
+	size := uint64(len(mmap))
+	if need <= size {
+		return mmap, nil
+	}
+	if need > maxSize {
+		return mmap, ErrMaxFileSize
+	}
+	newSize := min(max(size+min(size, maxGrowStep), need), maxSize)
+	if err := mmap.Sync(gommap.MS_SYNC); err != nil {
+		return mmap, err
+	}
+	if err := mmap.UnsafeUnmap(); err != nil {
+		return mmap, err
+	}
+	return mapSize(file, newSize)
+}
+
+// write the dirty pages of the mapping and the size of the file to disk
+func syncFile(file *os.File, mmap gommap.MMap) error {
+	if err := mmap.Sync(gommap.MS_SYNC); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// sync the mapping, cut the file to len and unmap it
+func closeFile(file *os.File, mmap gommap.MMap, len uint64) error {
+	if err := syncFile(file, mmap); err != nil {
+		return err
+	}
+	if err := file.Truncate(int64(len)); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := mmap.UnsafeUnmap(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// write data to a new file at path and fsync it
+func writeFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	return file.Close()
+}
+
+// fsync a directory so renames inside it are durable
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// offset of entry index of size bytes after the header, false if the entry ends past limit
+// checked before multiplying, so a huge index does not wrap around to an entry at the start of the file
+func entryOffset(index, size, limit uint64) (uint64, bool) {
+	if limit < headerSize || index >= (limit-headerSize)/size {
+		return 0, false
+	}
+	return headerSize + index*size, true
+}
@@ -0,0 +1,129 @@
+package memorymapper
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/tysonmote/gommap"
+)
+
+// norms.index stores the number of tokens of every document, used for ranking
+// [header][docId 0][docId 1]...
+// [header][uint64][uint64]...
+// len field of the header is the number of documents, extra field is the sum of their lengths
+// a document with length 0 is not stored
+type Norms struct {
+	mu      sync.RWMutex // Get() and Stats() hold RLock, Set() and remapping hold Lock
+	file    *os.File
+	mmap    gommap.MMap // mmap
+	len     uint64      // current size
+	docs    uint64      // number of documents with a length
+	total   uint64      // sum of all document lengths
+	maxSize uint64      // size the file never grows past
+	closed  bool        // flag to check if the norms.index is closed
+}
+
+// open norms.index, an existing file is reopened and its stats restored from the header
+func NewNorms(opts Options) (*Norms, error) {
+	file, mmap, size, err := mapFile(opts.path(normsIndexFile), opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := loadHeader(mmap, normsMagic, normsVersion, size); err != nil {
+		mmap.UnsafeUnmap()
+		file.Close()
+		return nil, err
+	}
+	return &Norms{
+		file:    file,
+		mmap:    mmap,
+		len:     max(size, headerSize),
+		docs:    getField(mmap, lenField),
+		total:   getField(mmap, extraField),
+		maxSize: opts.MaxFileSize,
+	}, nil
+}
+
+// store the length of docId
+func (n *Norms) Set(docId, length uint64) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return errors.New("norms.index file is closed")
+	}
+	offset, ok := entryOffset(docId, byteSize, n.maxSize)
+	if !ok {
+		return ErrMaxFileSize
+	}
+	if offset+byteSize > uint64(len(n.mmap)) {
+		mmap, err := growFile(n.file, n.mmap, offset+byteSize, n.maxSize)
+		if err != nil {
+			if mmap == nil {
+				n.file.Close()
+				n.closed = true
+			}
+			return err
+		}
+		n.mmap = mmap
+	}
+	prev := encoder.Uint64(n.mmap[offset : offset+byteSize])
+	switch {
+	case prev == 0 && length != 0:
+		n.docs++
+	case prev != 0 && length == 0:
+		n.docs--
+	}
+	n.total = n.total - prev + length
+	encoder.PutUint64(n.mmap[offset:offset+byteSize], length)
+	putField(n.mmap, lenField, n.docs)
+	putField(n.mmap, extraField, n.total)
+	n.len = max(n.len, offset+byteSize)
+	return nil
+}
+
+// length of docId, 0 if it is not stored
+func (n *Norms) Get(docId uint64) uint64 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	offset, ok := entryOffset(docId, byteSize, n.len)
+	if n.closed || !ok {
+		return 0
+	}
+	return encoder.Uint64(n.mmap[offset : offset+byteSize])
+}
+
+// number of documents and sum of their lengths
+func (n *Norms) Stats() (uint64, uint64) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.docs, n.total
+}
+
+// write the lengths set since the last sync to disk
+func (n *Norms) Sync() error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return errors.New("norms.index file is closed")
+	}
+	return syncFile(n.file, n.mmap)
+}
+
+// close the norms.index
+func (n *Norms) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	slog.Debug("[norms.go] [Close()] closing norms.index")
+	if n.closed {
+		return errors.New("file is closed")
+	}
+	if err := closeFile(n.file, n.mmap, n.len); err != nil {
+		return err
+	}
+	n.closed = true
+	n.mmap = nil
+	n.file = nil
+	return nil
+}
@@ -0,0 +1,32 @@
+package memorymapper
+
+import "path/filepath"
+
+// where the index files are kept and how large they grow, given to every constructor of the package
+// the caller fills it from its config, DefaultOptions() holds the values used when nothing is configured
+type Options struct {
+	Dir             string // data directory, the index files are under Dir/memory_mapper
+	InitialFileSize uint64 // size a new mapped file starts at
+	MaxFileSize     uint64 // size no mapped file grows past
+	FlushDocs       uint64 // documents buffered before they are flushed as a segment
+	FlushBytes      uint64 // compressed postings buffered before they are flushed
+	MergeFactor     uint64 // segments of one tier merged at once
+	MergeFloorBytes uint64 // segments up to this size are in the lowest tier
+}
+
+func DefaultOptions(dir string) Options {
+	return Options{
+		Dir:             dir,
+		InitialFileSize: 1048576,     // 1Mb
+		MaxFileSize:     17179869184, // 16Gb
+		FlushDocs:       10000,
+		FlushBytes:      67108864, // 64Mb
+		MergeFactor:     4,
+		MergeFloorBytes: 1048576, // 1Mb
+	}
+}
+
+// path of an index file, name is one of the /memory_mapper/... names of variables.go
+func (o Options) path(name string) string {
+	return filepath.Join(o.Dir, name)
+}
@@ -5,152 +5,325 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
-	"path/filepath"
-	"searchengine/utils"
+	"sync"
 
 	"github.com/tysonmote/gommap"
 )
 
 type Posting struct {
-	file   *os.File
-	mmap   gommap.MMap // mmap
-	len    uint64      // current size
-	closed bool        // flag to check if the posting.index is closed
+	mu      sync.RWMutex // Search() holds RLock, writes and remapping hold Lock
+	file    *os.File
+	mmap    gommap.MMap // mmap
+	len     uint64      // current size
+	version uint64      // format version of the file
+	maxSize uint64      // size the file never grows past
+	closed  bool        // flag to check if the posting.index is closed
 }
 
-func NewPosting() (*Posting, error) {
-	os.Remove(filepath.Join(utils.Path, postingIndexFile))
-	slog.Info(" [NewPosting] Path -> " + filepath.Join(utils.Path, postingIndexFile))
-	dict := &Posting{}
-	file, err := os.OpenFile(filepath.Join(utils.Path, postingIndexFile), os.O_CREATE|os.O_RDWR, 0644)
-	if err != nil {
+// docId stored in a posting list, how many times the word appears in it and at which token positions
+type PostingEntry struct {
+	DocId     uint64
+	Freq      uint64
+	Positions []uint64
+}
+
+// open the posting.index at path, an existing file is reopened and its len restored from the header
+func openPosting(path string, opts Options) (*Posting, error) {
+	post := &Posting{maxSize: opts.MaxFileSize}
+	if err := post.open(path, opts); err != nil {
 		return nil, err
 	}
-	dict.closed = false
-	info, err := file.Stat()
+	return post, nil
+}
+
+func (p *Posting) open(path string, opts Options) error {
+	file, mmap, size, err := mapFile(path, opts)
 	if err != nil {
-		return nil, err
-	}
-	size := info.Size()
-	dict.len = uint64(size)
-	if size > int64(MaxFileSize) {
-		return nil, errors.New("max file size reached")
+		return err
 	}
-	// allocate capacity
-	if err := file.Truncate(int64(MaxFileSize)); err != nil {
-		return nil, err
+	p.version, err = loadHeader(mmap, postingMagic, postingVersion, size)
+	if err == nil {
+		p.len = max(getField(mmap, lenField), headerSize)
+		if size != 0 && p.len > size {
+			err = fmt.Errorf("posting.index has invalid len %d", p.len)
+		}
 	}
-	dict.file = file
-	mmap, err := gommap.Map(
-		dict.file.Fd(),
-		gommap.PROT_READ|gommap.PROT_WRITE,
-		gommap.MAP_SHARED,
-	)
 	if err != nil {
+		mmap.UnsafeUnmap()
 		file.Close()
-		return nil, err
+		return err
 	}
-	dict.mmap = mmap
-	return dict, nil
+	p.file = file
+	p.mmap = mmap
+	p.closed = false
+	return nil
 }
 
 // search in posting.index
-// [len][slice]
-// [uint64][uint64]
-// [8][8 * len]
-// returns offset, docIds
-func (p *Posting) Search(offset uint64, len uint64) ([]uint64, error) {
+// [len][bytes][docId][freq][positionsLen][position]...[docId][freq][positionsLen][position]...
+// [uint64][uint64][uint64][uint64][uint64][uint64 * positionsLen]...
+// bytes is the size of all entries after it
+// version 1 stored [len][docId]..., read with freq 1
+// version 2 stored [len][docId][freq]..., read without positions
+// version 4 compresses the entries, see posting_codec.go
+// returns docIds with their term frequency and positions
+func (p *Posting) Search(offset uint64, len uint64) ([]PostingEntry, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.search(offset, len)
+}
+
+func (p *Posting) search(offset uint64, len uint64) ([]PostingEntry, error) {
 	if p.closed {
-		return []uint64{}, errors.New("posting.index file is closed")
+		return []PostingEntry{}, errors.New("posting.index file is closed")
 	}
-	storedLen := encoder.Uint64(p.mmap[offset : offset+byteSize])
-	if storedLen != len {
-		return []uint64{}, errors.New("length size didn't match, maybe stored a wrong offset")
+	totalByte, err := p.sliceSize(offset, len)
+	if err != nil {
+		return []PostingEntry{}, err
 	}
-	totalByte := (len * byteSize) + byteSize // lenSize for len, (len * lenSize) for slice
-	if offset+totalByte > MaxFileSize {
-		return []uint64{}, errors.New(" [INFO]posting.index does not have enough space")
+	if p.version >= 4 {
+		return p.searchCompressed(offset, len, totalByte)
 	}
-	docIds := make([]uint64, 0, len)
+	end := offset + totalByte
+	entries := make([]PostingEntry, 0, len)
+	offset += p.sliceHeaderSize()
 	for i := 0; i < int(len); i++ {
+		entry := PostingEntry{
+			DocId: encoder.Uint64(p.mmap[offset : offset+byteSize]),
+			Freq:  1,
+		}
 		offset += byteSize
-		x := encoder.Uint64(p.mmap[offset : offset+byteSize])
-		docIds = append(docIds, x)
+		if p.version >= 2 {
+			entry.Freq = encoder.Uint64(p.mmap[offset : offset+byteSize])
+			offset += byteSize
+		}
+		if p.version >= 3 {
+			positionsLen := encoder.Uint64(p.mmap[offset : offset+byteSize])
+			offset += byteSize
+			if offset+positionsLen*byteSize > end {
+				return []PostingEntry{}, errors.New("positions are out of the slice")
+			}
+			entry.Positions = make([]uint64, positionsLen)
+			for j := range entry.Positions {
+				entry.Positions[j] = encoder.Uint64(p.mmap[offset : offset+byteSize])
+				offset += byteSize
+			}
+		}
+		entries = append(entries, entry)
 	}
-	return docIds, nil
+	return entries, nil
 }
 
-// append in posting.index
-func (p *Posting) Append(docId uint64, sizeInclude bool) (uint64, error) {
+// decode every entry of a compressed slice
+func (p *Posting) searchCompressed(offset, len, totalByte uint64) ([]PostingEntry, error) {
+	c, err := p.cursor(offset, len, totalByte)
+	if err != nil {
+		return []PostingEntry{}, err
+	}
+	entries := make([]PostingEntry, 0, len)
+	for {
+		if err := c.next(); err != nil {
+			return []PostingEntry{}, err
+		}
+		if !c.valid {
+			return entries, nil
+		}
+		entries = append(entries, c.entry)
+	}
+}
+
+// entries of the slice at offset with a docId in docIds, docIds must be sorted
+// a compressed slice jumps over the blocks between two docIds with its skip pointers
+func (p *Posting) Seek(offset uint64, len uint64, docIds []uint64) ([]PostingEntry, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.version < 4 {
+		entries, err := p.search(offset, len)
+		if err != nil {
+			return entries, err
+		}
+		return filterEntries(entries, docIds), nil
+	}
 	if p.closed {
-		return 0, errors.New("posting.index file is closed")
+		return []PostingEntry{}, errors.New("posting.index file is closed")
 	}
-	initialOffset := p.len
-	totalByte := byteSize
-	if sizeInclude {
-		totalByte = byteSize + byteSize
+	totalByte, err := p.sliceSize(offset, len)
+	if err != nil {
+		return []PostingEntry{}, err
+	}
+	c, err := p.cursor(offset, len, totalByte)
+	if err != nil {
+		return []PostingEntry{}, err
 	}
-	if p.IsFilled(totalByte) {
-		return 0, errors.New("posting.index file is reached to maximum size")
+	entries := make([]PostingEntry, 0)
+	for _, docId := range docIds {
+		if err := c.advance(docId); err != nil {
+			return []PostingEntry{}, err
+		}
+		if !c.valid {
+			break
+		}
+		if c.entry.DocId == docId {
+			entries = append(entries, c.entry)
+		}
 	}
-	offset := initialOffset
-	if sizeInclude {
-		encoder.PutUint64(p.mmap[offset:offset+byteSize], uint64(1))
-		offset += byteSize
+	return entries, nil
+}
+
+// entries with a docId in sorted docIds
+func filterEntries(entries []PostingEntry, docIds []uint64) []PostingEntry {
+	result := make([]PostingEntry, 0, min(len(entries), len(docIds)))
+	j := 0
+	for _, entry := range entries {
+		for j < len(docIds) && docIds[j] < entry.DocId {
+			j++
+		}
+		if j < len(docIds) && docIds[j] == entry.DocId {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// bytes of the slice stored at offset, checked against the file
+func (p *Posting) sliceSize(offset, len uint64) (uint64, error) {
+	if offset < headerSize || offset+p.sliceHeaderSize() > p.len {
+		return 0, errors.New("offset is out of posting.index")
+	}
+	storedLen := encoder.Uint64(p.mmap[offset : offset+byteSize])
+	if storedLen != len {
+		return 0, errors.New("length size didn't match, maybe stored a wrong offset")
+	}
+	var totalByte uint64
+	switch p.version {
+	case 1:
+		totalByte = byteSize + len*byteSize
+	case 2:
+		totalByte = byteSize + len*2*byteSize
+	default:
+		totalByte = 2*byteSize + encoder.Uint64(p.mmap[offset+byteSize:offset+2*byteSize])
+	}
+	if offset+totalByte > p.len {
+		return 0, errors.New(" [INFO]posting.index does not have enough space")
+	}
+	return totalByte, nil
+}
+
+// [len] before version 3, [len][bytes] in version 3, [len][bytes][lastDocId][skips] after
+func (p *Posting) sliceHeaderSize() uint64 {
+	switch {
+	case p.version < 3:
+		return byteSize
+	case p.version == 3:
+		return 2 * byteSize
+	}
+	return 4 * byteSize
+}
+
+// append a new slice holding entries in posting.index, entries must be sorted by docId
+func (p *Posting) Append(entries ...PostingEntry) (uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.writable(); err != nil {
+		return 0, err
+	}
+	return p.appendEntries(entries)
+}
+
+// write a new compressed slice holding entries at the end of posting.index, entries must be sorted by docId
+func (p *Posting) appendEntries(entries []PostingEntry) (uint64, error) {
+	skips := make([]skipPointer, 0, uint64(len(entries))/SkipInterval)
+	dataByte, prev := uint64(0), uint64(0)
+	for i, entry := range entries {
+		if i > 0 && uint64(i)%SkipInterval == 0 {
+			skips = append(skips, skipPointer{prevDocId: prev, index: uint64(i), dataOffset: dataByte})
+		}
+		dataByte += varintEntrySize(entry, prev)
+		prev = entry.DocId
+	}
+	skipsByte := uint64(len(skips)) * skipEntrySize
+	totalByte := 4*byteSize + skipsByte + dataByte
+	if err := p.reserve(totalByte); err != nil {
+		return 0, err
+	}
+	initialOffset := p.len
+	buf := p.mmap[initialOffset : initialOffset+totalByte]
+	putSliceHeader(buf, uint64(len(entries)), totalByte-2*byteSize, prev, uint64(len(skips)))
+	at := 4 * byteSize
+	for _, skip := range skips {
+		putSkip(buf[at:], skip)
+		at += skipEntrySize
+	}
+	prev = 0
+	for _, entry := range entries {
+		at += putVarintEntry(buf[at:], entry, prev)
+		prev = entry.DocId
 	}
-	encoder.PutUint64(p.mmap[offset:offset+byteSize], docId)
 	p.len += totalByte
+	putField(p.mmap, lenField, p.len)
 	return initialOffset, nil
 }
 
-// Meaning we have to append some docId in the slice located at offset
-// But thats a probem ...
-// So we will copy the slice to the end and append the docId
-func (p *Posting) Update(offset, size, docId uint64) (uint64, error) {
+// [len][bytes][lastDocId][skips] of a compressed slice
+func putSliceHeader(buf []byte, len, bytes, lastDocId, skips uint64) {
+	encoder.PutUint64(buf[0:byteSize], len)
+	encoder.PutUint64(buf[byteSize:2*byteSize], bytes)
+	encoder.PutUint64(buf[2*byteSize:3*byteSize], lastDocId)
+	encoder.PutUint64(buf[3*byteSize:4*byteSize], skips)
+}
+
+func putSkip(buf []byte, skip skipPointer) {
+	encoder.PutUint64(buf[0:byteSize], skip.prevDocId)
+	encoder.PutUint64(buf[byteSize:2*byteSize], skip.index)
+	encoder.PutUint64(buf[2*byteSize:skipEntrySize], skip.dataOffset)
+}
+
+// only the current version is written, older files are rewritten by Segments.Upgrade()
+func (p *Posting) writable() error {
 	if p.closed {
-		return 0, errors.New("file is closed")
+		return errors.New("posting.index file is closed")
 	}
-	initialOffset := p.len
-	totalByte := byteSize + size*byteSize
-	if p.IsFilled(totalByte + byteSize) { // mmap[offset: offset + totalbyte] -> for old slice, lenSize for new docId
-		return 0, errors.New("file is reached to maximum size")
+	if p.version != postingVersion {
+		return fmt.Errorf("posting.index version %d is read only, compact it first", p.version)
 	}
-	copy(p.mmap[initialOffset:initialOffset+totalByte], p.mmap[offset:offset+totalByte])
-	encoder.PutUint64(p.mmap[initialOffset:initialOffset+byteSize], size+uint64(1))
-	p.len += totalByte
-	if _, err := p.Append(docId, false); err != nil {
-		return 0, err
+	return nil
+}
+
+// grow the mapping so size more bytes fit after len
+func (p *Posting) reserve(size uint64) error {
+	if p.IsFilled(size) {
+		return ErrMaxFileSize
 	}
-	return initialOffset, nil
+	mmap, err := growFile(p.file, p.mmap, p.len+size, p.maxSize)
+	if err != nil {
+		if mmap == nil {
+			p.file.Close()
+			p.closed = true
+		}
+		return err
+	}
+	p.mmap = mmap
+	return nil
 }
 
 // check if there is enough space with size
 func (p *Posting) IsFilled(size uint64) bool {
-	return p.len+size > MaxFileSize
+	return p.len+size > p.maxSize
 }
 
 // close the posting.index
 func (p *Posting) Close() error {
-	slog.Info("[INSIDE] posting.go -> Close()")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.close()
+}
+
+func (p *Posting) close() error {
+	slog.Debug("[posting.go] [Close()] closing posting.index")
 	if p.closed {
 		return errors.New("file is closed")
 	}
-	if err := p.mmap.Sync(gommap.MS_SYNC); err != nil {
-		return err
-	}
-	if err := p.file.Sync(); err != nil {
-		return err
-	}
-	if err := p.file.Truncate(int64(p.len)); err != nil {
-		return err
-	}
-	if err := p.file.Sync(); err != nil {
-		return err
-	}
-	if err := p.mmap.UnsafeUnmap(); err != nil {
-		return err
-	}
-	if err := p.file.Close(); err != nil {
+	if err := closeFile(p.file, p.mmap, p.len); err != nil {
 		return err
 	}
 	p.closed = true
@@ -159,15 +332,38 @@ func (p *Posting) Close() error {
 	return nil
 }
 
+// format version of posting.index
+func (p *Posting) Version() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.version
+}
+
+// check if posting.index was written by an older version and must be compacted before writing
+func (p *Posting) NeedsUpgrade() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.version != postingVersion
+}
+
 // Print slice for debug
 func (p *Posting) Print(offset uint64) uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.print(offset)
+}
+
+func (p *Posting) print(offset uint64) uint64 {
 	sz := encoder.Uint64(p.mmap[offset : offset+byteSize])
 	fmt.Println(" [debug] first slice size: ", sz)
-	fmt.Print(" [debug] first slice size: ")
-	for i := 0; i < int(sz); i++ {
-		offset += byteSize
-		x := encoder.Uint64(p.mmap[offset : offset+byteSize])
-		fmt.Print(x, " ")
+	entries, err := p.search(offset, sz)
+	if err != nil {
+		fmt.Println(" [debug] ", err)
+		return sz
+	}
+	fmt.Print(" [debug] first slice: ")
+	for _, entry := range entries {
+		fmt.Print(entry.DocId, entry.Positions, " ")
 	}
 	fmt.Println()
 	return sz
@@ -176,17 +372,19 @@ func (p *Posting) Print(offset uint64) uint64 {
 // debug information
 // customize to your need
 func (p *Posting) Debug(offset uint64) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	fmt.Println(" [debug] bytes written: ", p.len)
-	fmt.Println(" [debug] bytes : ", p.len/8)
-
-	sz := p.Print(uint64(offset))
+	fmt.Println(" [debug] bytes mapped: ", len(p.mmap))
 
-	offset += byteSize
-	offset += (byteSize * sz)
+	sz := p.print(uint64(offset))
+	totalByte, _ := p.sliceSize(offset, sz)
 
-	fmt.Println(offset)
+	fmt.Println(offset + totalByte)
 }
 
 func (p *Posting) Len() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return p.len
 }
@@ -0,0 +1,180 @@
+package memorymapper
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+/**
+compressed posting list, version 4 of posting.index
+
+[len][bytes][lastDocId][skips][prevDocId][index][dataOffset]...[entry]...
+[uint64][uint64][uint64][uint64][uint64][uint64][uint64]...[varints]...
+bytes is the size of everything after it, as in version 3
+lastDocId is the docId of the last entry
+
+entry : [docId - previous docId][freq][positionsLen][position - previous position]...
+every value is a uvarint, docIds and positions increase so the deltas stay small
+
+a skip pointer is written every SkipInterval entries, it points at entry index,
+prevDocId is the docId before that entry, dataOffset its offset after the skip pointers
+Seek() decodes from the last skip pointer below a docId instead of from the first entry
+**/
+
+var errCorruptEntry = errors.New("posting entry is corrupt")
+
+type skipPointer struct {
+	prevDocId  uint64
+	index      uint64
+	dataOffset uint64
+}
+
+// bytes of entry encoded after prev
+func varintEntrySize(entry PostingEntry, prev uint64) uint64 {
+	size := uvarintSize(entry.DocId-prev) + uvarintSize(entry.Freq) + uvarintSize(uint64(len(entry.Positions)))
+	last := uint64(0)
+	for _, position := range entry.Positions {
+		size += uvarintSize(position - last)
+		last = position
+	}
+	return size
+}
+
+// write entry encoded after prev at the beginning of buf, returns bytes written
+func putVarintEntry(buf []byte, entry PostingEntry, prev uint64) uint64 {
+	n := binary.PutUvarint(buf, entry.DocId-prev)
+	n += binary.PutUvarint(buf[n:], entry.Freq)
+	n += binary.PutUvarint(buf[n:], uint64(len(entry.Positions)))
+	last := uint64(0)
+	for _, position := range entry.Positions {
+		n += binary.PutUvarint(buf[n:], position-last)
+		last = position
+	}
+	return uint64(n)
+}
+
+// read the entry encoded after prev at the beginning of buf, returns bytes read
+func readVarintEntry(buf []byte, prev uint64) (PostingEntry, uint64, error) {
+	var offset uint64
+	next := func() (uint64, error) {
+		value, n := binary.Uvarint(buf[offset:])
+		if n <= 0 {
+			return 0, errCorruptEntry
+		}
+		offset += uint64(n)
+		return value, nil
+	}
+	delta, err := next()
+	if err != nil {
+		return PostingEntry{}, 0, err
+	}
+	freq, err := next()
+	if err != nil {
+		return PostingEntry{}, 0, err
+	}
+	positionsLen, err := next()
+	if err != nil {
+		return PostingEntry{}, 0, err
+	}
+	// a position takes at least a byte
+	if positionsLen > uint64(len(buf))-offset {
+		return PostingEntry{}, 0, errCorruptEntry
+	}
+	entry := PostingEntry{DocId: prev + delta, Freq: freq, Positions: make([]uint64, positionsLen)}
+	last := uint64(0)
+	for j := range entry.Positions {
+		delta, err := next()
+		if err != nil {
+			return PostingEntry{}, 0, err
+		}
+		last += delta
+		entry.Positions[j] = last
+	}
+	return entry, offset, nil
+}
+
+func uvarintSize(value uint64) uint64 {
+	size := uint64(1)
+	for value >= 0x80 {
+		value >>= 7
+		size++
+	}
+	return size
+}
+
+// reads the entries of a compressed slice one by one, advance() jumps with the skip pointers
+type postingCursor struct {
+	data  []byte // entries of the slice
+	skips []skipPointer
+	len   uint64       // entries in the slice
+	index uint64       // entries read so far
+	pos   uint64       // offset of the next entry in data
+	entry PostingEntry // last entry read
+	valid bool         // false before the first entry and after the last one
+}
+
+// cursor over the compressed slice at offset, totalByte is its checked size
+func (p *Posting) cursor(offset, len, totalByte uint64) (*postingCursor, error) {
+	skips := encoder.Uint64(p.mmap[offset+3*byteSize : offset+4*byteSize])
+	dataStart := offset + 4*byteSize
+	if skips > (totalByte-4*byteSize)/skipEntrySize {
+		return nil, errors.New("skip pointers are out of the slice")
+	}
+	c := &postingCursor{
+		data:  p.mmap[dataStart+skips*skipEntrySize : offset+totalByte],
+		skips: make([]skipPointer, skips),
+		len:   len,
+	}
+	for k := range c.skips {
+		at := dataStart + uint64(k)*skipEntrySize
+		c.skips[k] = skipPointer{
+			prevDocId:  encoder.Uint64(p.mmap[at : at+byteSize]),
+			index:      encoder.Uint64(p.mmap[at+byteSize : at+2*byteSize]),
+			dataOffset: encoder.Uint64(p.mmap[at+2*byteSize : at+skipEntrySize]),
+		}
+	}
+	return c, nil
+}
+
+// read the next entry, valid is false after the last one
+func (c *postingCursor) next() error {
+	if c.index == c.len || c.pos >= uint64(len(c.data)) {
+		c.valid = false
+		if c.index != c.len {
+			return errors.New("entries are out of the slice")
+		}
+		return nil
+	}
+	entry, n, err := readVarintEntry(c.data[c.pos:], c.entry.DocId)
+	if err != nil {
+		c.valid = false
+		return err
+	}
+	c.entry, c.pos, c.valid = entry, c.pos+n, true
+	c.index++
+	return nil
+}
+
+// move to the first entry with a docId >= target, valid is false if there is none
+// blocks before the last skip pointer below target are not decoded
+func (c *postingCursor) advance(target uint64) error {
+	if c.valid && c.entry.DocId >= target {
+		return nil
+	}
+	k := sort.Search(len(c.skips), func(k int) bool { return c.skips[k].prevDocId >= target }) - 1
+	if k >= 0 && c.skips[k].index >= c.index {
+		skip := c.skips[k]
+		if skip.dataOffset > uint64(len(c.data)) || skip.index > c.len {
+			c.valid = false
+			return errors.New("skip pointer is out of the slice")
+		}
+		c.pos, c.index = skip.dataOffset, skip.index
+		c.entry = PostingEntry{DocId: skip.prevDocId}
+	}
+	for {
+		if err := c.next(); err != nil || !c.valid || c.entry.DocId >= target {
+			return err
+		}
+	}
+}
@@ -1 +1,191 @@
 package memorymapper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPostingReopen(t *testing.T) {
+	opts := testOptions(t)
+	path := filepath.Join(opts.Dir, postingIndexFile)
+
+	post, err := openPosting(path, opts)
+	if err != nil {
+		t.Fatalf("openPosting(%s) = %v want <nil>", path, err)
+	}
+	offset, err := post.Append(PostingEntry{DocId: 1, Freq: 1}, PostingEntry{DocId: 2, Freq: 2, Positions: []uint64{3, 9}})
+	if err != nil {
+		t.Fatalf("Append() = %v want <nil>", err)
+	}
+	if err := post.Close(); err != nil {
+		t.Fatalf("Close() = %v want <nil>", err)
+	}
+
+	post, err = openPosting(path, opts)
+	if err != nil {
+		t.Fatalf("openPosting(%s) = %v want <nil>", path, err)
+	}
+	defer post.Close()
+
+	entries, err := post.Search(offset, 2)
+	if err != nil {
+		t.Fatalf("Search() = %v want <nil>", err)
+	}
+	want := []PostingEntry{{DocId: 1, Freq: 1, Positions: []uint64{}}, {DocId: 2, Freq: 2, Positions: []uint64{3, 9}}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Search() = %v want %v", entries, want)
+	}
+
+	// new slices continue after the restored len
+	next, err := post.Append(PostingEntry{DocId: 3, Freq: 1})
+	if err != nil {
+		t.Fatalf("Append() = %v want <nil>", err)
+	}
+	// [len][bytes][lastDocId][skips] + [1][1][0] + [1][2][2][3][6], one byte varints
+	if want := offset + 4*byteSize + 8; next != want {
+		t.Errorf("Append() = %d want %d", next, want)
+	}
+}
+
+func TestPostingGrow(t *testing.T) {
+	opts := testOptions(t)
+	opts.InitialFileSize = 4096
+	path := filepath.Join(opts.Dir, postingIndexFile)
+
+	post, err := openPosting(path, opts)
+	if err != nil {
+		t.Fatalf("openPosting(%s) = %v want <nil>", path, err)
+	}
+	defer post.Close()
+
+	offsets := make([]uint64, 0)
+	for docId := uint64(1); docId <= 200; docId++ {
+		offset, err := post.Append(PostingEntry{DocId: docId, Freq: 1, Positions: []uint64{docId}})
+		if err != nil {
+			t.Fatalf("Append(%d) = %v want <nil>", docId, err)
+		}
+		offsets = append(offsets, offset)
+	}
+	if post.Len() <= opts.InitialFileSize {
+		t.Errorf("Len() = %d want > %d", post.Len(), opts.InitialFileSize)
+	}
+	for i, offset := range offsets {
+		entries, err := post.Search(offset, 1)
+		if err != nil || len(entries) != 1 || entries[0].DocId != uint64(i+1) {
+			t.Errorf("Search(%d) = %v, %v want docId %d", offset, entries, err, i+1)
+		}
+	}
+}
+
+func TestPostingUpgrade(t *testing.T) {
+	opts := testOptions(t)
+
+	// version 1 : [len][docId]...
+	data := make([]byte, headerSize+3*byteSize)
+	values := []uint64{postingMagic, 1, headerSize + 3*byteSize, 0, 2, 7, 9}
+	for i, value := range values {
+		encoder.PutUint64(data[uint64(i)*byteSize:], value)
+	}
+	path := filepath.Join(opts.Dir, postingIndexFile)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	post, err := openPosting(path, opts)
+	if err != nil {
+		t.Fatalf("openPosting(%s) = %v want <nil>", path, err)
+	}
+	defer post.Close()
+	if !post.NeedsUpgrade() {
+		t.Fatalf("NeedsUpgrade() = false want true")
+	}
+	if _, err := post.Append(PostingEntry{DocId: 10, Freq: 1}); err == nil {
+		t.Errorf("Append() = <nil> want error for version 1")
+	}
+
+	// rewritten by Segments.Upgrade(), see TestSegmentsAdopt
+	entries, err := post.Search(headerSize, 2)
+	want := []PostingEntry{{DocId: 7, Freq: 1}, {DocId: 9, Freq: 1}}
+	if err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("Search() = %v, %v want %v", entries, err, want)
+	}
+}
+
+func TestPostingSeek(t *testing.T) {
+	opts := testOptions(t)
+	defer func(interval uint64) { SkipInterval = interval }(SkipInterval)
+	SkipInterval = 4
+
+	path := filepath.Join(opts.Dir, postingIndexFile)
+	post, err := openPosting(path, opts)
+	if err != nil {
+		t.Fatalf("openPosting(%s) = %v want <nil>", path, err)
+	}
+	defer post.Close()
+
+	// docIds 3, 6, ..., 150, a skip pointer every 4 entries
+	list := []PostingEntry{{DocId: 3, Freq: 1, Positions: []uint64{1}}}
+	for i := uint64(2); i <= 50; i++ {
+		list = append(list, PostingEntry{DocId: 3 * i, Freq: 2, Positions: []uint64{i, 200 * i}})
+	}
+	offset, err := post.Append(list...)
+	if err != nil {
+		t.Fatalf("Append() = %v want <nil>", err)
+	}
+
+	entries, err := post.Search(offset, 50)
+	if err != nil || len(entries) != 50 {
+		t.Fatalf("Search() = %d entries, %v want 50", len(entries), err)
+	}
+	for i, entry := range entries {
+		if n := uint64(i) + 1; entry.DocId != 3*n || (n > 1 && !reflect.DeepEqual(entry.Positions, []uint64{n, 200 * n})) {
+			t.Errorf("Search()[%d] = %v want docId %d", i, entry, 3*n)
+		}
+	}
+
+	testCase := []struct {
+		docIds []uint64
+		want   []uint64
+	}{
+		{[]uint64{}, []uint64{}},
+		{[]uint64{1, 2, 3}, []uint64{3}},
+		{[]uint64{4, 60, 61, 63, 100, 148, 150}, []uint64{60, 63, 150}},
+		{[]uint64{150, 151}, []uint64{150}},
+		{[]uint64{200}, []uint64{}},
+	}
+	for _, test := range testCase {
+		entries, err := post.Seek(offset, 50, test.docIds)
+		got := make([]uint64, 0, len(entries))
+		for _, entry := range entries {
+			got = append(got, entry.DocId)
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Seek(%v) = %v, %v want %v", test.docIds, got, err, test.want)
+		}
+	}
+}
+
+func TestPostingCodec(t *testing.T) {
+	entries := []PostingEntry{
+		{DocId: 1, Freq: 1, Positions: []uint64{0}},
+		{DocId: 300, Freq: 3, Positions: []uint64{2, 130, 1 << 40}},
+		{DocId: 1 << 50, Freq: 0, Positions: []uint64{}},
+	}
+	buf := make([]byte, 64)
+	prev := uint64(0)
+	for _, entry := range entries {
+		n := putVarintEntry(buf, entry, prev)
+		if size := varintEntrySize(entry, prev); size != n {
+			t.Errorf("varintEntrySize(%v) = %d want %d", entry, size, n)
+		}
+		got, read, err := readVarintEntry(buf[:n], prev)
+		if err != nil || read != n || !reflect.DeepEqual(got, entry) {
+			t.Errorf("readVarintEntry() = %v, %d, %v want %v, %d", got, read, err, entry, n)
+		}
+		if _, _, err := readVarintEntry(buf[:n-1], prev); err == nil {
+			t.Errorf("readVarintEntry(truncated %v) = <nil> want error", entry)
+		}
+		prev = entry.DocId
+	}
+}
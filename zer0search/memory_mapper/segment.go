@@ -0,0 +1,206 @@
+package memorymapper
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// a segment is a directory holding its own dictionary.index and posting.index
+// for the documents of a range of docIds, written once by writeSegment() and only read after
+type Segment struct {
+	Info SegmentInfo
+	dict *Dictionary
+	post *Posting
+}
+
+// segment as listed in segments.json
+type SegmentInfo struct {
+	Name     string `json:"name"`
+	MinDocId uint64 `json:"minDocId"` // smallest docId of the segment
+	MaxDocId uint64 `json:"maxDocId"` // largest docId of the segment
+	Words    uint64 `json:"words"`    // words of dictionary.index
+	Bytes    uint64 `json:"bytes"`    // size of posting.index
+}
+
+func openSegment(dir string, info SegmentInfo, opts Options) (*Segment, error) {
+	dict, err := openDictionary(filepath.Join(dir, filepath.Base(dictIndexFile)), opts)
+	if err != nil {
+		return nil, fmt.Errorf("segment %s : %w", info.Name, err)
+	}
+	post, err := openPosting(filepath.Join(dir, filepath.Base(postingIndexFile)), opts)
+	if err != nil {
+		dict.Close()
+		return nil, fmt.Errorf("segment %s : %w", info.Name, err)
+	}
+	return &Segment{Info: info, dict: dict, post: post}, nil
+}
+
+// entries of key
+func (s *Segment) Search(key Key) ([]PostingEntry, error) {
+	found, _, postingOffset, postingLen, err := s.dict.Search(key)
+	if err != nil || !found {
+		return []PostingEntry{}, err
+	}
+	return s.post.Search(postingOffset, postingLen)
+}
+
+// entries of key with a docId in sorted docIds
+func (s *Segment) Seek(key Key, docIds []uint64) ([]PostingEntry, error) {
+	found, _, postingOffset, postingLen, err := s.dict.Search(key)
+	if err != nil || !found {
+		return []PostingEntry{}, err
+	}
+	return s.post.Seek(postingOffset, postingLen, docIds)
+}
+
+// number of docIds of key
+func (s *Segment) DocFreq(key Key) uint64 {
+	found, _, _, postingLen, err := s.dict.Search(key)
+	if err != nil || !found {
+		return 0
+	}
+	return postingLen
+}
+
+// call fn with the entries of every word of the segment, stops at the first error
+func (s *Segment) Walk(fn func(key Key, entries []PostingEntry) error) error {
+	keys, err := s.keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		entries, err := s.Search(key)
+		if err != nil {
+			return fmt.Errorf("segment %s, word %d : %w", s.Info.Name, key.Hash, err)
+		}
+		if err := fn(key, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// every word of the segment, the check hashes are 0 in a segment that is not Checked()
+func (s *Segment) keys() ([]Key, error) {
+	keys := make([]Key, 0, s.dict.Count())
+	err := s.dict.Walk(func(_ uint64, key Key, _, _ uint64) error {
+		keys = append(keys, key)
+		return nil
+	})
+	return keys, err
+}
+
+// format version of the segment's posting.index
+func (s *Segment) Version() uint64 {
+	return s.post.Version()
+}
+
+// check if the segment's dictionary.index keeps the check hash of every word
+func (s *Segment) Checked() bool {
+	return s.dict.Checked()
+}
+
+// bytes of data of dictionary.index and posting.index, the open files are mapped past them
+func (s *Segment) sizes() (uint64, uint64) {
+	s.dict.mu.RLock()
+	defer s.dict.mu.RUnlock()
+	return s.dict.len, s.post.Len()
+}
+
+func (s *Segment) close() error {
+	return errors.Join(s.dict.Close(), s.post.Close())
+}
+
+/**
+1. Create dir, then posting.index in it
+2. For every key in order, append its entries to posting.index and insert it in a table sized for every key
+3. Close posting.index, it is fsynced and cut to its len
+4. Write dictionary.index from the table and fsync it and dir
+
+a key without entries is left out, dir is removed on error
+returns the info of the segment, named after dir
+**/
+
+func writeSegment(dir string, opts Options, keys []Key, entries func(key Key) ([]PostingEntry, error)) (SegmentInfo, error) {
+	info := SegmentInfo{Name: filepath.Base(dir)}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return info, err
+	}
+	post, err := openPosting(filepath.Join(dir, filepath.Base(postingIndexFile)), opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		return info, err
+	}
+	abort := func(err error) (SegmentInfo, error) {
+		post.Close()
+		os.RemoveAll(dir)
+		return info, err
+	}
+
+	capacity := segmentCapacity(uint64(len(keys)))
+	table := make([]byte, headerSize+capacity*dictEntrySize)
+	putField(table, magicField, dictMagic)
+	putField(table, versionField, dictVersion)
+	putField(table, extraField, capacity)
+	slices.SortFunc(keys, compareKeys)
+	for _, key := range keys {
+		list, err := entries(key)
+		if err != nil {
+			return abort(err)
+		}
+		if len(list) == 0 {
+			continue
+		}
+		postingOffset, err := post.Append(list...)
+		if err != nil {
+			return abort(err)
+		}
+		slot, found := probe(table, capacity, dictEntrySize, key)
+		if found {
+			return abort(fmt.Errorf("word %d is written twice", key.Hash))
+		}
+		putSlot(table, slot, dictEntrySize, key, postingOffset, uint64(len(list)))
+		info.Words++
+		if info.MinDocId == 0 || list[0].DocId < info.MinDocId {
+			info.MinDocId = list[0].DocId
+		}
+		info.MaxDocId = max(info.MaxDocId, list[len(list)-1].DocId)
+	}
+	putField(table, lenField, info.Words)
+	info.Bytes = post.Len()
+	if err := post.Close(); err != nil {
+		os.RemoveAll(dir)
+		return info, err
+	}
+	if err := writeFile(filepath.Join(dir, filepath.Base(dictIndexFile)), table); err != nil {
+		os.RemoveAll(dir)
+		return info, err
+	}
+	if err := syncDir(dir); err != nil {
+		os.RemoveAll(dir)
+		return info, err
+	}
+	return info, nil
+}
+
+// smallest power of two number of slots holding words under dictMaxLoad
+// a segment never grows, so unlike dictCapacity() it does not fill Options.InitialFileSize
+func segmentCapacity(words uint64) uint64 {
+	capacity := uint64(1)
+	for words*100 > capacity*dictMaxLoad {
+		capacity *= 2
+	}
+	return capacity
+}
+
+// order of keys by hash, then by check hash
+func compareKeys(a, b Key) int {
+	if c := cmp.Compare(a.Hash, b.Hash); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Check, b.Check)
+}
@@ -0,0 +1,652 @@
+package memorymapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"searchengine/utils"
+	"slices"
+	"sync"
+)
+
+/**
+the index is a list of immutable segments, searches read every segment and concatenate their entries
+new documents go to a Buffer, Flush() writes it as a new segment, Merge() combines small segments
+
+segments/segments.json lists the live segments, oldest first
+	{"generation": 7, "flushed": 1200, "segments": [{"name": "seg_00000004", "minDocId": 1, "maxDocId": 900, ...}, ...]}
+generation names the next segment, flushed is the largest docId written to a segment
+segments hold increasing ranges of docIds, so the entries of a word stay sorted across them
+
+segments.json is replaced by writing segments.json.tmp, fsync and rename, the rename is the commit point of a flush or a merge
+a segment directory not listed in segments.json is left by an interrupted flush or merge and removed on open
+**/
+
+var errSegmentsClosed = errors.New("segments are closed")
+
+type manifest struct {
+	Generation uint64        `json:"generation"`
+	Flushed    uint64        `json:"flushed"`
+	Segments   []SegmentInfo `json:"segments"`
+}
+
+type Segments struct {
+	mu       sync.RWMutex // searches hold RLock, flushing and swapping merged segments hold Lock
+	mergeMu  sync.Mutex   // one merge at a time, segments of a running merge are only removed by it
+	dir      string
+	opts     Options
+	manifest manifest
+	segments []*Segment    // in the order of manifest.Segments
+	merges   chan struct{} // signaled by Flush(), MergeLoop() waits on it
+	closed   bool
+}
+
+// open the segments listed in segments.json
+// an index written before segments becomes the first segment, see adopt()
+func NewSegments(opts Options) (*Segments, error) {
+	if err := recoverCompaction(opts); err != nil {
+		return nil, err
+	}
+	dir := opts.path(segmentsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Segments{dir: dir, opts: opts, merges: make(chan struct{}, 1)}
+	if err := s.load(); err != nil {
+		for _, seg := range s.segments {
+			seg.close()
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Segments) load() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return s.adopt()
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &s.manifest); err != nil {
+		return fmt.Errorf("%s : %w", manifestFile, err)
+	}
+	if err := s.removeUnlisted(); err != nil {
+		return err
+	}
+	for _, info := range s.manifest.Segments {
+		seg, err := openSegment(filepath.Join(s.dir, info.Name), info, s.opts)
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, seg)
+	}
+	return nil
+}
+
+// remove segment directories and files of segments/ not listed in segments.json
+func (s *Segments) removeUnlisted() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == manifestFile || slices.ContainsFunc(s.manifest.Segments, func(info SegmentInfo) bool { return info.Name == name }) {
+			continue
+		}
+		slog.Info("[segments.go] [removeUnlisted()] removing unlisted segment file", "name", name)
+		if err := os.RemoveAll(filepath.Join(s.dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+an index written before segments keeps one dictionary.index and posting.index pair in memory_mapper/
+1. Move posting.index, then dictionary.index into segments/seg_00000000
+2. Walk the segment for its range of docIds, every stored docId is flushed
+3. Write segments.json
+a crash before 3 finds the files in seg_00000000 and continues, an older format is rewritten by Upgrade()
+**/
+
+func (s *Segments) adopt() error {
+	first := filepath.Join(s.dir, segmentName(0))
+	for _, name := range []string{postingIndexFile, dictIndexFile} {
+		from := s.opts.path(name)
+		if !utils.FileExists(from) {
+			continue
+		}
+		if err := os.MkdirAll(first, 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(from, filepath.Join(first, filepath.Base(name))); err != nil {
+			return err
+		}
+		if err := syncDir(filepath.Dir(from)); err != nil {
+			return err
+		}
+	}
+	next := manifest{Segments: []SegmentInfo{}}
+	if utils.FileExists(filepath.Join(first, filepath.Base(dictIndexFile))) {
+		seg, err := openSegment(first, SegmentInfo{Name: segmentName(0)}, s.opts)
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, seg)
+		if err := seg.Walk(func(_ Key, entries []PostingEntry) error {
+			seg.Info.Words++
+			for _, entry := range entries {
+				if seg.Info.MinDocId == 0 || entry.DocId < seg.Info.MinDocId {
+					seg.Info.MinDocId = entry.DocId
+				}
+				seg.Info.MaxDocId = max(seg.Info.MaxDocId, entry.DocId)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		seg.Info.Bytes = seg.post.Len()
+		next = manifest{Generation: 1, Flushed: seg.Info.MaxDocId, Segments: []SegmentInfo{seg.Info}}
+		slog.Info("[segments.go] [adopt()] index adopted as the first segment", "words", seg.Info.Words, "maxDocId", seg.Info.MaxDocId)
+	}
+	if err := s.writeManifest(next); err != nil {
+		return err
+	}
+	s.manifest = next
+	return nil
+}
+
+// replace segments.json with m
+func (s *Segments) writeManifest(m manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, manifestFile)
+	if err := writeFile(path+tmpSuffix, data); err != nil {
+		return err
+	}
+	if err := os.Rename(path+tmpSuffix, path); err != nil {
+		os.Remove(path + tmpSuffix)
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+func segmentName(generation uint64) string {
+	return fmt.Sprintf("%s%08d", segmentPrefix, generation)
+}
+
+/**
+1. Write the postings of b as a new segment, named after the generation
+2. List it in segments.json with the largest buffered docId as flushed (commit point)
+3. Search it from now on and empty b
+4. Wake MergeLoop()
+
+b is locked during the flush, an empty b writes nothing
+**/
+
+func (s *Segments) Flush(b *Buffer) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSegmentsClosed
+	}
+	if len(b.postings) == 0 {
+		return nil
+	}
+	keys := make([]Key, 0, len(b.postings))
+	for key := range b.postings {
+		keys = append(keys, key)
+	}
+	name := segmentName(s.manifest.Generation)
+	dir := filepath.Join(s.dir, name)
+	info, err := writeSegment(dir, s.opts, keys, func(key Key) ([]PostingEntry, error) {
+		return b.postings[key], nil
+	})
+	if err != nil {
+		return err
+	}
+	seg, err := openSegment(dir, info, s.opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	next := manifest{
+		Generation: s.manifest.Generation + 1,
+		Flushed:    max(s.manifest.Flushed, b.maxDocId),
+		Segments:   append(slices.Clone(s.manifest.Segments), info),
+	}
+	// an unlisted segment is removed on open
+	if err := s.writeManifest(next); err != nil {
+		seg.close()
+		return err
+	}
+	s.manifest = next
+	s.segments = append(s.segments, seg)
+	b.reset()
+	slog.Info("[segments.go] [Flush()] segment flushed", "segment", name, "words", info.Words, "bytes", info.Bytes)
+	select {
+	case s.merges <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// largest docId written to a segment, documents after it are only in the buffer
+func (s *Segments) Flushed() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.manifest.Flushed
+}
+
+// check if b holds enough documents or bytes to be flushed
+func (s *Segments) Full(b *Buffer) bool {
+	docs, bytes := b.Stats()
+	return docs >= s.opts.FlushDocs || bytes >= s.opts.FlushBytes
+}
+
+// live segments, oldest first
+func (s *Segments) Infos() []SegmentInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.manifest.Segments)
+}
+
+// entries of key in every segment, sorted by docId
+func (s *Segments) Search(key Key) ([]PostingEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return []PostingEntry{}, errSegmentsClosed
+	}
+	entries := make([]PostingEntry, 0)
+	for _, seg := range s.segments {
+		list, err := seg.Search(key)
+		if err != nil {
+			return []PostingEntry{}, err
+		}
+		entries = append(entries, list...)
+	}
+	return entries, nil
+}
+
+// entries of key with a docId in sorted docIds, a segment is only read for the docIds of its range
+func (s *Segments) Seek(key Key, docIds []uint64) ([]PostingEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return []PostingEntry{}, errSegmentsClosed
+	}
+	entries := make([]PostingEntry, 0)
+	for _, seg := range s.segments {
+		from, _ := slices.BinarySearch(docIds, seg.Info.MinDocId)
+		to, found := slices.BinarySearch(docIds, seg.Info.MaxDocId)
+		if found {
+			to++
+		}
+		if from == to {
+			continue
+		}
+		list, err := seg.Seek(key, docIds[from:to])
+		if err != nil {
+			return []PostingEntry{}, err
+		}
+		entries = append(entries, list...)
+	}
+	return entries, nil
+}
+
+// number of docIds of key in every segment, deleted docIds count until a merge drops them
+func (s *Segments) DocFreq(key Key) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	freq := uint64(0)
+	for _, seg := range s.segments {
+		freq += seg.DocFreq(key)
+	}
+	return freq
+}
+
+// check if key is stored in a segment
+func (s *Segments) HasWord(key Key) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, seg := range s.segments {
+		if seg.DocFreq(key) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// add every word of every segment to seen
+func (s *Segments) Words(seen map[Key]struct{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, seg := range s.segments {
+		keys, err := seg.keys()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			seen[key] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// call fn with the entries of every word of every segment, stops at the first error
+// fn must not call back into the segments
+func (s *Segments) Walk(fn func(info SegmentInfo, key Key, entries []PostingEntry) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errSegmentsClosed
+	}
+	for _, seg := range s.segments {
+		if err := seg.Walk(func(key Key, entries []PostingEntry) error {
+			return fn(seg.Info, key, entries)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+tiered merge policy, the tier of a segment is how many times Options.MergeFactor fits between Options.MergeFloorBytes and its size
+1. Find the oldest run of MergeFactor adjacent segments of one tier
+2. Write their entries without deleted docIds into a new segment, searches continue on the old ones
+3. Swap the run for the new segment in segments.json (commit point) and in the searched list
+4. Close and remove the old segments
+
+returns false when no run needs merging
+**/
+
+func (s *Segments) Merge(tombstones *Tombstones) (bool, error) {
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return false, errSegmentsClosed
+	}
+	start, end, ok := mergeRun(s.manifest.Segments, s.opts)
+	run := slices.Clone(s.segments[start:end])
+	s.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	return true, s.merge(run, tombstones, nil)
+}
+
+func mergeRun(infos []SegmentInfo, opts Options) (int, int, bool) {
+	factor := int(opts.MergeFactor)
+	for start := 0; start+factor <= len(infos); start++ {
+		tier := sizeTier(infos[start].Bytes, opts)
+		end := start + 1
+		for end < len(infos) && end-start < factor && sizeTier(infos[end].Bytes, opts) == tier {
+			end++
+		}
+		if end-start == factor {
+			return start, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+func sizeTier(bytes uint64, opts Options) int {
+	tier := 0
+	for size := opts.MergeFloorBytes; bytes > size; size *= opts.MergeFactor {
+		tier++
+	}
+	return tier
+}
+
+// merge every segment into one, every deleted docId is dropped
+func (s *Segments) ForceMerge(tombstones *Tombstones) error {
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return errSegmentsClosed
+	}
+	run := slices.Clone(s.segments)
+	s.mu.RUnlock()
+	if len(run) == 0 {
+		return nil
+	}
+	return s.merge(run, tombstones, nil)
+}
+
+// segments written by an older version are read only, rewrite each of them in the current format
+// a dictionary.index without check hashes gets the keys of its words from the words of terms
+func (s *Segments) Upgrade(tombstones *Tombstones, terms *Terms) error {
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+	s.mu.RLock()
+	old := make([]*Segment, 0)
+	for _, seg := range s.segments {
+		if seg.Version() != postingVersion || !seg.Checked() {
+			old = append(old, seg)
+		}
+	}
+	s.mu.RUnlock()
+	for _, seg := range old {
+		slog.Info("[segments.go] [Upgrade()] upgrading segment", "segment", seg.Info.Name, "version", seg.Version(), "checked", seg.Checked())
+		if err := s.merge([]*Segment{seg}, tombstones, terms); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// every word of the segments of run
+// a segment that is not Checked() only knows the hashes of its words, their keys are the keys of the words of terms
+// with the same hash, words of one hash stay merged in such a segment so each of them gets every entry of the hash
+// a hash of no word of terms only holds deleted docIds and is dropped
+func runKeys(run []*Segment, terms *Terms) ([]Key, error) {
+	seen := make(map[Key]struct{})
+	unchecked := make(map[uint64]bool)
+	for _, seg := range run {
+		keys, err := seg.keys()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if seg.Checked() {
+				seen[key] = struct{}{}
+			} else {
+				unchecked[key.Hash] = false
+			}
+		}
+	}
+	if len(unchecked) > 0 {
+		if terms == nil {
+			return nil, errors.New("segment without check hashes, it needs Upgrade()")
+		}
+		if err := terms.Walk("", func(term string) bool {
+			key := WordKey(term)
+			if _, ok := unchecked[key.Hash]; ok {
+				unchecked[key.Hash] = true
+				seen[key] = struct{}{}
+			}
+			return true
+		}); err != nil {
+			return nil, err
+		}
+		dropped := 0
+		for _, found := range unchecked {
+			if !found {
+				dropped++
+			}
+		}
+		if dropped > 0 {
+			slog.Info("[segments.go] [runKeys()] words without a term dropped", "words", dropped)
+		}
+	}
+	keys := make([]Key, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// replace the adjacent segments of run by one segment of their live entries, the caller holds mergeMu
+// a run without live entries is removed, terms is only needed by a run of a segment that is not Checked()
+func (s *Segments) merge(run []*Segment, tombstones *Tombstones, terms *Terms) error {
+	keys, err := runKeys(run, terms)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	name := segmentName(s.manifest.Generation)
+	s.manifest.Generation++
+	s.mu.Unlock()
+	dir := filepath.Join(s.dir, name)
+	dropped := 0
+	info, err := writeSegment(dir, s.opts, keys, func(key Key) ([]PostingEntry, error) {
+		entries := make([]PostingEntry, 0)
+		for _, seg := range run {
+			list, err := seg.Search(key)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range list {
+				if tombstones.IsDeleted(entry.DocId) {
+					dropped++
+					continue
+				}
+				entries = append(entries, entry)
+			}
+		}
+		return entries, nil
+	})
+	if err != nil {
+		return err
+	}
+	merged := make([]*Segment, 0, 1)
+	if info.Words > 0 {
+		seg, err := openSegment(dir, info, s.opts)
+		if err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+		merged = append(merged, seg)
+	} else {
+		os.RemoveAll(dir)
+	}
+	infos := make([]SegmentInfo, len(merged))
+	for i, seg := range merged {
+		infos[i] = seg.Info
+	}
+
+	s.mu.Lock()
+	start := slices.Index(s.segments, run[0])
+	if s.closed || start < 0 {
+		s.mu.Unlock()
+		for _, seg := range merged {
+			seg.close()
+		}
+		return errSegmentsClosed
+	}
+	next := manifest{
+		Generation: s.manifest.Generation,
+		Flushed:    s.manifest.Flushed,
+		Segments:   slices.Concat(s.manifest.Segments[:start], infos, s.manifest.Segments[start+len(run):]),
+	}
+	if err := s.writeManifest(next); err != nil {
+		s.mu.Unlock()
+		for _, seg := range merged {
+			seg.close()
+		}
+		return err
+	}
+	s.manifest = next
+	s.segments = slices.Concat(s.segments[:start], merged, s.segments[start+len(run):])
+	s.mu.Unlock()
+
+	// no search holds the old segments once they are swapped
+	for _, seg := range run {
+		if err := seg.close(); err != nil {
+			slog.Error("[segments.go] [merge()] ", "segment", seg.Info.Name, "err", err)
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, seg.Info.Name)); err != nil {
+			slog.Error("[segments.go] [merge()] ", "segment", seg.Info.Name, "err", err)
+		}
+	}
+	slog.Info("[segments.go] [merge()] segments merged", "segments", len(run), "segment", name, "words", info.Words, "bytes", info.Bytes, "deletedPostings", dropped)
+	return nil
+}
+
+// merge segments in the background after every flush, returns once the segments are closed
+func (s *Segments) MergeLoop(tombstones *Tombstones) {
+	for range s.merges {
+		for {
+			merged, err := s.Merge(tombstones)
+			if err != nil {
+				if !errors.Is(err, errSegmentsClosed) {
+					slog.Error("[segments.go] [MergeLoop()] ", "err", err)
+				}
+				break
+			}
+			if !merged {
+				break
+			}
+		}
+	}
+}
+
+// close every segment, waits for a running merge
+func (s *Segments) Close() error {
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slog.Debug("[segments.go] [Close()] closing segments", "segments", len(s.segments))
+	if s.closed {
+		return errors.New("file is closed")
+	}
+	s.closed = true
+	close(s.merges)
+	errs := make([]error, 0)
+	for _, seg := range s.segments {
+		errs = append(errs, seg.close())
+	}
+	return errors.Join(errs...)
+}
+
+/**
+an older version compacted dictionary.index and posting.index in place through .compact copies,
+finish or discard a compaction interrupted by a crash before the pair is adopted
+	- dictionary.index.compact exists : not committed, remove both copies
+	- only posting.index.compact exists : committed, rename it over posting.index
+**/
+
+func recoverCompaction(opts Options) error {
+	dictPath := opts.path(dictIndexFile)
+	postPath := opts.path(postingIndexFile)
+	if utils.FileExists(dictPath + compactSuffix) {
+		os.Remove(postPath + compactSuffix)
+		return os.Remove(dictPath + compactSuffix)
+	}
+	if utils.FileExists(postPath + compactSuffix) {
+		slog.Info("[segments.go] [recoverCompaction()] finishing interrupted compaction")
+		if err := os.Rename(postPath+compactSuffix, postPath); err != nil {
+			return err
+		}
+		return syncDir(filepath.Dir(postPath))
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package memorymapper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"searchengine/utils"
+	"testing"
+)
+
+func openSegments(t *testing.T, opts Options) *Segments {
+	t.Helper()
+	s, err := NewSegments(opts)
+	if err != nil {
+		t.Fatalf("NewSegments(opts) = %v want <nil>", err)
+	}
+	return s
+}
+
+// key of word n of the tests
+func testKey(n uint64) Key {
+	return Key{Hash: n, Check: n}
+}
+
+// docIds of the entries of word n in every segment
+func segmentDocIds(t *testing.T, s *Segments, n uint64) []uint64 {
+	t.Helper()
+	entries, err := s.Search(testKey(n))
+	if err != nil {
+		t.Fatalf("Search(%d) = %v want <nil>", n, err)
+	}
+	docIds := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		docIds = append(docIds, entry.DocId)
+	}
+	return docIds
+}
+
+// flush docIds from..to as one segment, word 1 is in every document, word 2 in the even ones
+func flushDocs(t *testing.T, s *Segments, from, to uint64) {
+	t.Helper()
+	b := NewBuffer()
+	for docId := from; docId <= to; docId++ {
+		if err := b.Add(testKey(1), PostingEntry{DocId: docId, Freq: 1, Positions: []uint64{0}}); err != nil {
+			t.Fatalf("Add(1, %d) = %v want <nil>", docId, err)
+		}
+		if docId%2 == 0 {
+			b.Add(testKey(2), PostingEntry{DocId: docId, Freq: 1, Positions: []uint64{1}})
+		}
+	}
+	if err := s.Flush(b); err != nil {
+		t.Fatalf("Flush() = %v want <nil>", err)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	opts := testOptions(t)
+	s := openSegments(t, opts)
+
+	b := NewBuffer()
+	b.Add(testKey(1), PostingEntry{DocId: 1, Freq: 2, Positions: []uint64{0, 3}}, PostingEntry{DocId: 2, Freq: 1, Positions: []uint64{1}})
+	if err := b.Add(testKey(1), PostingEntry{DocId: 2, Freq: 1}); err == nil {
+		t.Errorf("Add(1, 2) = <nil> want error for a docId not after the last one")
+	}
+	b.Add(testKey(2), PostingEntry{DocId: 2, Freq: 1, Positions: []uint64{0}})
+	// same hash as word 2, another word
+	b.Add(Key{Hash: 2, Check: 3}, PostingEntry{DocId: 1, Freq: 1, Positions: []uint64{2}})
+	docs, bytes := b.Stats()
+	if docs != 2 {
+		t.Errorf("Stats() = %d documents want 2", docs)
+	}
+	// a rejected batch counts none of its entries
+	if err := b.Add(testKey(3), PostingEntry{DocId: 5, Freq: 1}, PostingEntry{DocId: 4, Freq: 1}); err == nil {
+		t.Errorf("Add(3, 5, 4) = <nil> want error for docIds out of order")
+	}
+	if gotDocs, gotBytes := b.Stats(); gotDocs != docs || gotBytes != bytes || b.HasWord(testKey(3)) {
+		t.Errorf("Stats() = %d, %d after a rejected Add() want %d, %d", gotDocs, gotBytes, docs, bytes)
+	}
+	if err := s.Flush(b); err != nil {
+		t.Fatalf("Flush() = %v want <nil>", err)
+	}
+	if b.HasWord(testKey(1)) || s.Flushed() != 2 || len(s.Infos()) != 1 {
+		t.Errorf("Flush() left buffer %v, flushed %d, %d segments want empty, 2, 1", b.HasWord(testKey(1)), s.Flushed(), len(s.Infos()))
+	}
+	// an empty buffer writes no segment
+	if err := s.Flush(b); err != nil || len(s.Infos()) != 1 {
+		t.Errorf("Flush() = %v, %d segments want <nil>, 1", err, len(s.Infos()))
+	}
+	s.Close()
+
+	s = openSegments(t, opts)
+	defer s.Close()
+	entries, err := s.Search(testKey(1))
+	want := []PostingEntry{{DocId: 1, Freq: 2, Positions: []uint64{0, 3}}, {DocId: 2, Freq: 1, Positions: []uint64{1}}}
+	if err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("Search(1) = %v, %v want %v", entries, err, want)
+	}
+	if got, _ := s.Seek(testKey(1), []uint64{2, 5}); len(got) != 1 || got[0].DocId != 2 {
+		t.Errorf("Seek(1, [2 5]) = %v want docId 2", got)
+	}
+	if s.DocFreq(testKey(2)) != 1 || !s.HasWord(testKey(2)) || s.HasWord(testKey(3)) {
+		t.Errorf("DocFreq(2), HasWord(2), HasWord(3) = %d, %v, %v want 1, true, false", s.DocFreq(testKey(2)), s.HasWord(testKey(2)), s.HasWord(testKey(3)))
+	}
+	if got, _ := s.Search(Key{Hash: 2, Check: 3}); len(got) != 1 || got[0].DocId != 1 {
+		t.Errorf("Search(2, 3) = %v want docId 1, apart from word 2", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	opts := testOptions(t)
+	s := openSegments(t, opts)
+	defer s.Close()
+	tombstones, err := NewTombstones(opts)
+	if err != nil {
+		t.Fatalf("NewTombstones(opts) = %v want <nil>", err)
+	}
+	defer tombstones.Close()
+
+	for i := uint64(0); i < opts.MergeFactor-1; i++ {
+		flushDocs(t, s, 10*i+1, 10*i+10)
+	}
+	if merged, err := s.Merge(tombstones); merged || err != nil {
+		t.Fatalf("Merge() = %v, %v want false, <nil> below opts.MergeFactor segments", merged, err)
+	}
+	flushDocs(t, s, 10*opts.MergeFactor-9, 10*opts.MergeFactor)
+	tombstones.Delete(5)
+
+	if merged, err := s.Merge(tombstones); !merged || err != nil {
+		t.Fatalf("Merge() = %v, %v want true, <nil>", merged, err)
+	}
+	infos := s.Infos()
+	if len(infos) != 1 || infos[0].MinDocId != 1 || infos[0].MaxDocId != 10*opts.MergeFactor {
+		t.Fatalf("Infos() = %v want one segment of docIds 1-%d", infos, 10*opts.MergeFactor)
+	}
+	docIds := segmentDocIds(t, s, 1)
+	if uint64(len(docIds)) != 10*opts.MergeFactor-1 || docIds[3] != 4 || docIds[4] != 6 {
+		t.Errorf("Search(1) = %v want every docId but 5", docIds)
+	}
+	entries, _ := os.ReadDir(s.dir)
+	if len(entries) != 2 {
+		t.Errorf("segments/ holds %d files want segments.json and the merged segment", len(entries))
+	}
+	if merged, _ := s.Merge(tombstones); merged {
+		t.Errorf("Merge() = true want false for a single segment")
+	}
+}
+
+func TestMergeTombstones(t *testing.T) {
+	opts := testOptions(t)
+	s := openSegments(t, opts)
+	defer s.Close()
+	tombstones, err := NewTombstones(opts)
+	if err != nil {
+		t.Fatalf("NewTombstones(opts) = %v want <nil>", err)
+	}
+	defer tombstones.Close()
+
+	// word 1 -> [1 2 3], word 2 -> [2], delete docId 2
+	flushDocs(t, s, 1, 3)
+	if deleted, err := tombstones.Delete(2); !deleted || err != nil {
+		t.Fatalf("Delete(2) = %v, %v want true, <nil>", deleted, err)
+	}
+	if deleted, _ := tombstones.Delete(2); deleted {
+		t.Errorf("Delete(2) = true want false for a deleted docId")
+	}
+
+	if err := s.ForceMerge(tombstones); err != nil {
+		t.Fatalf("ForceMerge() = %v want <nil>", err)
+	}
+	if s.HasWord(testKey(2)) {
+		t.Errorf("HasWord(2) = true want false, word without live docIds")
+	}
+	if got := segmentDocIds(t, s, 1); !reflect.DeepEqual(got, []uint64{1, 3}) {
+		t.Errorf("Search(1) = %v want [1 3]", got)
+	}
+
+	// a segment without live docIds is removed
+	tombstones.Delete(1)
+	tombstones.Delete(3)
+	if err := s.ForceMerge(tombstones); err != nil || len(s.Infos()) != 0 {
+		t.Errorf("ForceMerge() = %v, %d segments want <nil>, 0", err, len(s.Infos()))
+	}
+}
+
+func TestSegmentsUnlisted(t *testing.T) {
+	opts := testOptions(t)
+	s := openSegments(t, opts)
+	flushDocs(t, s, 1, 2)
+	s.Close()
+
+	// left by a flush or a merge interrupted before segments.json was written
+	leftover := filepath.Join(opts.Dir, segmentsDir, segmentName(7))
+	os.MkdirAll(leftover, 0755)
+	os.WriteFile(filepath.Join(opts.Dir, segmentsDir, manifestFile+tmpSuffix), []byte("partial"), 0644)
+
+	s = openSegments(t, opts)
+	defer s.Close()
+	if utils.FileExists(leftover) || utils.FileExists(filepath.Join(opts.Dir, segmentsDir, manifestFile+tmpSuffix)) {
+		t.Errorf("NewSegments(opts) kept unlisted files")
+	}
+	if got := segmentDocIds(t, s, 1); len(got) != 2 {
+		t.Errorf("Search(1) = %v want [1 2]", got)
+	}
+}
+
+func TestSegmentsAdopt(t *testing.T) {
+	opts := testOptions(t)
+
+	// an index written before segments, posting.index in version 1 : [len][docId]...
+	data := make([]byte, headerSize+3*byteSize)
+	values := []uint64{postingMagic, 1, headerSize + 3*byteSize, 0, 2, 7, 9}
+	for i, value := range values {
+		encoder.PutUint64(data[uint64(i)*byteSize:], value)
+	}
+	if err := os.WriteFile(filepath.Join(opts.Dir, postingIndexFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// dictionary.index in version 1 : [hash][postingOffset][postingLen]..., the second word is missing from terms.index
+	word := WordKey("seven")
+	data = make([]byte, headerSize+2*hashEntrySize)
+	values = []uint64{dictMagic, 1, headerSize + 2*hashEntrySize, 0, word.Hash, headerSize, 2, 42, headerSize, 2}
+	for i, value := range values {
+		encoder.PutUint64(data[uint64(i)*byteSize:], value)
+	}
+	if err := os.WriteFile(filepath.Join(opts.Dir, dictIndexFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	terms, err := NewTerms(opts)
+	if err != nil {
+		t.Fatalf("NewTerms(opts) = %v want <nil>", err)
+	}
+	defer terms.Close()
+	terms.Add("seven")
+
+	s := openSegments(t, opts)
+	defer s.Close()
+	if utils.FileExists(filepath.Join(opts.Dir, dictIndexFile)) || utils.FileExists(filepath.Join(opts.Dir, postingIndexFile)) {
+		t.Errorf("NewSegments(opts) left the old index files in place")
+	}
+	infos := s.Infos()
+	if len(infos) != 1 || infos[0].MinDocId != 7 || infos[0].MaxDocId != 9 || s.Flushed() != 9 {
+		t.Fatalf("Infos(), Flushed() = %v, %d want one segment of docIds 7-9, 9", infos, s.Flushed())
+	}
+
+	tombstones, err := NewTombstones(opts)
+	if err != nil {
+		t.Fatalf("NewTombstones(opts) = %v want <nil>", err)
+	}
+	defer tombstones.Close()
+	if err := s.Upgrade(tombstones, terms); err != nil {
+		t.Fatalf("Upgrade() = %v want <nil>", err)
+	}
+	if seg := s.segments[0]; seg.Version() != postingVersion || !seg.Checked() || seg.Info.Words != 1 {
+		t.Errorf("Version(), Checked(), Words = %d, %v, %d want %d, true, 1", seg.Version(), seg.Checked(), seg.Info.Words, postingVersion)
+	}
+	entries, err := s.Search(word)
+	want := []PostingEntry{{DocId: 7, Freq: 1, Positions: []uint64{}}, {DocId: 9, Freq: 1, Positions: []uint64{}}}
+	if err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("Search(seven) = %v, %v want %v", entries, err, want)
+	}
+	if s.HasWord(Key{Hash: word.Hash, Check: word.Check + 1}) {
+		t.Errorf("HasWord() = true want false for another check hash")
+	}
+}
+
+func TestRecoverCompaction(t *testing.T) {
+	opts := testOptions(t)
+
+	dictPath := filepath.Join(opts.Dir, dictIndexFile)
+	postPath := filepath.Join(opts.Dir, postingIndexFile)
+
+	// not committed, both copies are discarded
+	os.WriteFile(dictPath+compactSuffix, []byte("partial"), 0644)
+	os.WriteFile(postPath+compactSuffix, []byte("partial"), 0644)
+	if err := recoverCompaction(opts); err != nil {
+		t.Fatalf("recoverCompaction(opts) = %v want <nil>", err)
+	}
+	if utils.FileExists(dictPath+compactSuffix) || utils.FileExists(postPath+compactSuffix) {
+		t.Errorf("recoverCompaction(opts) kept an uncommitted copy")
+	}
+
+	// committed, posting.index is replaced
+	os.WriteFile(postPath+compactSuffix, []byte("compacted"), 0644)
+	if err := recoverCompaction(opts); err != nil {
+		t.Fatalf("recoverCompaction(opts) = %v want <nil>", err)
+	}
+	if data, _ := os.ReadFile(postPath); string(data) != "compacted" {
+		t.Errorf("posting.index = %q want %q", data, "compacted")
+	}
+}
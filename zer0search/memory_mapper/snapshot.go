@@ -0,0 +1,412 @@
+package memorymapper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"searchengine/utils"
+	"strings"
+	"time"
+)
+
+/**
+a snapshot is a copy of every file of an index at one point in time, taken while no write runs
+
+	snapshot.json
+	memory_mapper/segments/segments.json
+	memory_mapper/segments/seg_00000004/dictionary.index
+	memory_mapper/segments/seg_00000004/posting.index
+	memory_mapper/norms.index, tombstones.index, terms.index, access.index, docs.dat, docs.idx, analyzer.json, schema.json
+
+paths are relative to Options.Dir, snapshot.json is written last and marks a complete snapshot
+a directory snapshot hard links the immutable segment files and copies the others,
+a path ending in .tar.gz or .tgz is written as a gzip tarball
+index.wal is not copied, it is empty when no write runs
+**/
+
+const SnapshotInfoFile = "snapshot.json"
+
+var ErrNotSnapshot = errors.New("not a snapshot")
+
+type SnapshotInfo struct {
+	Created   time.Time     `json:"created"`
+	LastDocId int64         `json:"lastDocId"` // largest docId of the document store
+	Segments  []SegmentInfo `json:"segments"`
+	Files     int           `json:"files"`
+	Bytes     uint64        `json:"bytes"`
+}
+
+// index files besides the segments, a missing file is skipped, docs.dat and docs.idx with the mysql store
+var snapshotFiles = []string{normsIndexFile, tombstonesIndexFile, termsIndexFile, accessIndexFile, docsDataFile, docsIndexFile, AnalyzerFile, SchemaFile}
+
+type snapshotWriter interface {
+	// add size bytes of the file at path under name, an immutable file can be linked
+	add(name, path string, size int64, immutable bool) error
+	write(name string, data []byte) error
+	close() error
+}
+
+// check if path is written as a gzip tarball
+func isTarball(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// index file name as stored in a snapshot
+func snapshotName(file string) string {
+	return strings.TrimPrefix(filepath.ToSlash(file), "/")
+}
+
+/**
+1. Add the files of every live segment and segments.json, merges wait until they are added
+2. Add the other index files
+3. Add snapshot.json
+the caller holds every write, dest must not exist, a failed snapshot is removed
+**/
+
+func Snapshot(segments *Segments, dest string, lastDocId int64) (SnapshotInfo, error) {
+	info := SnapshotInfo{Created: time.Now().UTC(), LastDocId: lastDocId}
+	if utils.FileExists(dest) {
+		return info, fmt.Errorf("%s already exists", dest)
+	}
+	var w snapshotWriter
+	var err error
+	if isTarball(dest) {
+		w, err = newTarWriter(dest)
+	} else {
+		w, err = newDirWriter(dest)
+	}
+	if err != nil {
+		return info, err
+	}
+	abort := func(err error) (SnapshotInfo, error) {
+		w.close()
+		os.RemoveAll(dest)
+		return info, err
+	}
+
+	add := func(name, path string, size int64, immutable bool) error {
+		if size < 0 {
+			stat, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			size = stat.Size()
+		}
+		info.Files++
+		info.Bytes += uint64(size)
+		return w.add(name, path, size, immutable)
+	}
+	info.Segments, err = segments.snapshot(add, w.write)
+	if err != nil {
+		return abort(err)
+	}
+	for _, file := range snapshotFiles {
+		path := segments.opts.path(file)
+		if !utils.FileExists(path) {
+			continue
+		}
+		if err := add(snapshotName(file), path, -1, false); err != nil {
+			return abort(err)
+		}
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return abort(err)
+	}
+	if err := w.write(SnapshotInfoFile, data); err != nil {
+		return abort(err)
+	}
+	if err := w.close(); err != nil {
+		os.RemoveAll(dest)
+		return info, err
+	}
+	slog.Info("[snapshot.go] [Snapshot()] snapshot written", "dest", dest, "files", info.Files, "bytes", info.Bytes)
+	return info, nil
+}
+
+// add the files of every live segment and segments.json, no merge swaps a segment meanwhile
+func (s *Segments) snapshot(add func(name, path string, size int64, immutable bool) error, write func(name string, data []byte) error) ([]SegmentInfo, error) {
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, errSegmentsClosed
+	}
+	for _, seg := range s.segments {
+		dir := filepath.Join(segmentsDir, seg.Info.Name)
+		// an open file is mapped past its data, only the data is copied
+		dictLen, postLen := seg.sizes()
+		for _, file := range []struct {
+			name string
+			size uint64
+		}{{filepath.Base(dictIndexFile), dictLen}, {filepath.Base(postingIndexFile), postLen}} {
+			name := filepath.Join(dir, file.name)
+			if err := add(snapshotName(name), s.opts.path(name), int64(file.size), true); err != nil {
+				return nil, err
+			}
+		}
+	}
+	data, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := write(snapshotName(filepath.Join(segmentsDir, manifestFile)), data); err != nil {
+		return nil, err
+	}
+	return append([]SegmentInfo{}, s.manifest.Segments...), nil
+}
+
+// snapshot into a directory
+type dirWriter struct {
+	root string
+}
+
+func newDirWriter(root string) (*dirWriter, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &dirWriter{root: root}, nil
+}
+
+func (d *dirWriter) add(name, path string, size int64, immutable bool) error {
+	dest := filepath.Join(d.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	// a segment is never written again, both names share its data
+	if immutable && os.Link(path, dest) == nil {
+		return nil
+	}
+	return copyFile(dest, path, size)
+}
+
+func (d *dirWriter) write(name string, data []byte) error {
+	dest := filepath.Join(d.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return writeFile(dest, data)
+}
+
+// fsync every directory of the snapshot
+func (d *dirWriter) close() error {
+	return filepath.WalkDir(d.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		return syncDir(path)
+	})
+}
+
+// copy size bytes of src to a new file at dest and fsync it
+func copyFile(dest, src string, size int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(out, in, size); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// snapshot into a gzip tarball
+type tarWriter struct {
+	file *os.File
+	gz   *gzip.Writer
+	tw   *tar.Writer
+}
+
+func newTarWriter(path string) (*tarWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &tarWriter{file: file, gz: gz, tw: tar.NewWriter(gz)}, nil
+}
+
+func (t *tarWriter) add(name, path string, size int64, _ bool) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := t.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err = io.CopyN(t.tw, in, size)
+	return err
+}
+
+func (t *tarWriter) write(name string, data []byte) error {
+	if err := t.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := t.tw.Write(data)
+	return err
+}
+
+func (t *tarWriter) close() error {
+	err := errors.Join(t.tw.Close(), t.gz.Close())
+	if err == nil {
+		err = t.file.Sync()
+	}
+	return errors.Join(err, t.file.Close())
+}
+
+/**
+1. Unpack or copy the snapshot at src into memory_mapper/restore.tmp, it must hold snapshot.json
+2. Remove every file of the current index
+3. Move the files of the snapshot into place
+
+every index file must be closed, an interrupted restore leaves a partial index, restoring again finishes it
+returns the info of the restored snapshot
+**/
+
+func RestoreSnapshot(opts Options, src string) (SnapshotInfo, error) {
+	var info SnapshotInfo
+	staging := opts.path(restoreDir)
+	if err := os.RemoveAll(staging); err != nil {
+		return info, err
+	}
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return info, err
+	}
+	defer os.RemoveAll(staging)
+
+	var err error
+	if isTarball(src) {
+		err = unpackTarball(src, staging)
+	} else {
+		err = copyDir(src, staging)
+	}
+	if err != nil {
+		return info, err
+	}
+	data, err := os.ReadFile(filepath.Join(staging, SnapshotInfoFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return info, fmt.Errorf("%s : %w, %s is missing", src, ErrNotSnapshot, SnapshotInfoFile)
+	}
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("%s : %w", SnapshotInfoFile, err)
+	}
+
+	if err := RemoveIndexFiles(opts); err != nil {
+		return info, err
+	}
+	err = filepath.WalkDir(staging, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(staging, path)
+		if err != nil || name == SnapshotInfoFile {
+			return err
+		}
+		dest := opts.path(name)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(path, dest); err != nil {
+			return err
+		}
+		return syncDir(filepath.Dir(dest))
+	})
+	if err != nil {
+		return info, err
+	}
+	slog.Info("[snapshot.go] [RestoreSnapshot()] snapshot restored", "src", src, "created", info.Created, "lastDocId", info.LastDocId)
+	return info, nil
+}
+
+// copy every file under src to the same path under dest
+func copyDir(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return copyFile(target, path, stat.Size())
+	})
+}
+
+// unpack the regular files of a gzip tarball under dest, a name leaving dest is an error
+func unpackTarball(src, dest string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("%s : %w", src, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s : %w", src, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("%s : %w, %s is outside of the snapshot", src, ErrNotSnapshot, header.Name)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(header.Name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Sync(); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+}
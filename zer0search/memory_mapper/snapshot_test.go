@@ -0,0 +1,84 @@
+package memorymapper
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	testCase := []string{"snapshot", "snapshot.tar.gz"}
+	for _, name := range testCase {
+		opts := testOptions(t)
+		s := openSegments(t, opts)
+		tombstones, err := NewTombstones(opts)
+		if err != nil {
+			t.Fatalf("NewTombstones(opts) = %v want <nil>", err)
+		}
+		docs, err := NewDocuments(opts)
+		if err != nil {
+			t.Fatalf("NewDocuments(opts) = %v want <nil>", err)
+		}
+		flushDocs(t, s, 1, 4)
+		docs.Append(1, "first document")
+		tombstones.Delete(3)
+
+		dest := filepath.Join(t.TempDir(), name)
+		info, err := Snapshot(s, dest, 4)
+		if err != nil {
+			t.Fatalf("Snapshot(%s) = %v want <nil>", name, err)
+		}
+		if len(info.Segments) != 1 || info.LastDocId != 4 || info.Files != 5 {
+			t.Errorf("Snapshot(%s) = %d segments, last docId %d, %d files want 1, 4, 5", name, len(info.Segments), info.LastDocId, info.Files)
+		}
+		if _, err := Snapshot(s, dest, 4); err == nil {
+			t.Errorf("Snapshot(%s) = <nil> want error for an existing path", name)
+		}
+
+		// changes after the snapshot are lost by the restore
+		flushDocs(t, s, 5, 6)
+		tombstones.Delete(1)
+		docs.Append(5, "fifth document")
+		s.Close()
+		tombstones.Close()
+		docs.Close()
+
+		restored, err := RestoreSnapshot(opts, dest)
+		if err != nil {
+			t.Fatalf("RestoreSnapshot(%s) = %v want <nil>", name, err)
+		}
+		if !reflect.DeepEqual(restored.Segments, info.Segments) {
+			t.Errorf("RestoreSnapshot(%s) = %v want %v", name, restored.Segments, info.Segments)
+		}
+
+		s = openSegments(t, opts)
+		if got := segmentDocIds(t, s, 1); !reflect.DeepEqual(got, []uint64{1, 2, 3, 4}) {
+			t.Errorf("Search(1) after RestoreSnapshot(%s) = %v want [1 2 3 4]", name, got)
+		}
+		s.Close()
+		tombstones, _ = NewTombstones(opts)
+		if !tombstones.IsDeleted(3) || tombstones.IsDeleted(1) {
+			t.Errorf("IsDeleted(3), IsDeleted(1) after RestoreSnapshot(%s) = %v, %v want true, false", name, tombstones.IsDeleted(3), tombstones.IsDeleted(1))
+		}
+		tombstones.Close()
+		docs, _ = NewDocuments(opts)
+		if _, err := docs.Get(5); !errors.Is(err, ErrDocumentNotFound) {
+			t.Errorf("Get(5) after RestoreSnapshot(%s) = %v want %v", name, err, ErrDocumentNotFound)
+		}
+		if document, _ := docs.Get(1); document != "first document" {
+			t.Errorf("Get(1) after RestoreSnapshot(%s) = %q want %q", name, document, "first document")
+		}
+		docs.Close()
+	}
+}
+
+func TestRestoreNotSnapshot(t *testing.T) {
+	opts := testOptions(t)
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "norms.index"), []byte("x"), 0644)
+	if _, err := RestoreSnapshot(opts, src); !errors.Is(err, ErrNotSnapshot) {
+		t.Errorf("RestoreSnapshot(%s) = %v want %v", src, err, ErrNotSnapshot)
+	}
+}
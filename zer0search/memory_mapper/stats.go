@@ -0,0 +1,118 @@
+package memorymapper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// postings of a segment, the entries of deleted docIds are dead until a merge drops them
+type SegmentStats struct {
+	SegmentInfo
+	LiveBytes    uint64 `json:"liveBytes"`    // bytes of posting.index holding live docIds, slice headers and skip pointers
+	DeadBytes    uint64 `json:"deadBytes"`    // compressed size of the entries of deleted docIds
+	DeadPostings uint64 `json:"deadPostings"` // entries of deleted docIds
+}
+
+// size of an index file against Options.MaxFileSize, growFile() fails past it
+type FileStats struct {
+	Name  string  `json:"name"`  // path under the data directory
+	Bytes uint64  `json:"bytes"` // size on disk, an open file is mapped ahead of its data
+	Fill  float64 `json:"fill"`  // Bytes / Options.MaxFileSize
+}
+
+// entries of a word in one segment
+type SegmentPostings struct {
+	Segment string
+	Entries []PostingEntry
+}
+
+// walk every segment for its live and dead posting bytes, docFreq gets the number of live docIds of every word
+func (s *Segments) Stats(tombstones *Tombstones, docFreq map[Key]uint64) ([]SegmentStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, errSegmentsClosed
+	}
+	stats := make([]SegmentStats, 0, len(s.segments))
+	for _, seg := range s.segments {
+		stat := SegmentStats{SegmentInfo: seg.Info}
+		if err := seg.Walk(func(key Key, entries []PostingEntry) error {
+			prev := uint64(0)
+			for _, entry := range entries {
+				if tombstones.IsDeleted(entry.DocId) {
+					stat.DeadBytes += varintEntrySize(entry, prev)
+					stat.DeadPostings++
+				} else {
+					docFreq[key]++
+				}
+				prev = entry.DocId
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		stat.LiveBytes = stat.Bytes - min(stat.DeadBytes, stat.Bytes)
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// entries of key in every segment holding it, oldest first
+func (s *Segments) Postings(key Key) ([]SegmentPostings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, errSegmentsClosed
+	}
+	postings := make([]SegmentPostings, 0)
+	for _, seg := range s.segments {
+		entries, err := seg.Search(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 {
+			postings = append(postings, SegmentPostings{Segment: seg.Info.Name, Entries: entries})
+		}
+	}
+	return postings, nil
+}
+
+// size every index file never grows past
+func (s *Segments) MaxFileSize() uint64 {
+	return s.opts.MaxFileSize
+}
+
+// sizes of the files of every segment and of the shared index files, a missing file is left out
+func IndexFiles(segments *Segments) ([]FileStats, error) {
+	paths := make([]string, 0)
+	for _, info := range segments.Infos() {
+		for _, name := range []string{dictIndexFile, postingIndexFile} {
+			paths = append(paths, filepath.Join(segments.dir, info.Name, filepath.Base(name)))
+		}
+	}
+	for _, name := range []string{normsIndexFile, tombstonesIndexFile, termsIndexFile, accessIndexFile, walFile, docsDataFile, docsIndexFile} {
+		paths = append(paths, segments.opts.path(name))
+	}
+
+	files := make([]FileStats, 0, len(paths))
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		name, err := filepath.Rel(segments.opts.Dir, path)
+		if err != nil {
+			name = path
+		}
+		files = append(files, FileStats{
+			Name:  filepath.ToSlash(strings.TrimPrefix(name, string(filepath.Separator))),
+			Bytes: uint64(stat.Size()),
+			Fill:  float64(stat.Size()) / float64(segments.opts.MaxFileSize),
+		})
+	}
+	return files, nil
+}
@@ -0,0 +1,51 @@
+package memorymapper
+
+import (
+	"testing"
+)
+
+func TestSegmentsStats(t *testing.T) {
+	opts := testOptions(t)
+	s := openSegments(t, opts)
+	defer s.Close()
+	tombstones, err := NewTombstones(opts)
+	if err != nil {
+		t.Fatalf("NewTombstones(opts) = %v want <nil>", err)
+	}
+	defer tombstones.Close()
+
+	// word 1 -> [1 2 3 4], word 2 -> [2 4], docId 2 is dead in both until a merge
+	flushDocs(t, s, 1, 4)
+	tombstones.Delete(2)
+
+	docFreq := make(map[Key]uint64)
+	stats, err := s.Stats(tombstones, docFreq)
+	if err != nil || len(stats) != 1 {
+		t.Fatalf("Stats() = %v, %v want one segment", stats, err)
+	}
+	if stats[0].DeadPostings != 2 || stats[0].DeadBytes == 0 || stats[0].LiveBytes+stats[0].DeadBytes != stats[0].Bytes {
+		t.Errorf("Stats() = %+v want 2 dead postings, live and dead bytes adding up to the segment", stats[0])
+	}
+	if docFreq[testKey(1)] != 3 || docFreq[testKey(2)] != 1 {
+		t.Errorf("Stats() docFreq = %v want 3 and 1", docFreq)
+	}
+
+	postings, err := s.Postings(testKey(2))
+	if err != nil || len(postings) != 1 || len(postings[0].Entries) != 2 {
+		t.Errorf("Postings(2) = %v, %v want both docIds, the deleted one included", postings, err)
+	}
+
+	files, err := IndexFiles(s)
+	if err != nil {
+		t.Fatalf("IndexFiles() = %v want <nil>", err)
+	}
+	// dictionary.index and posting.index of the segment, tombstones.index
+	if len(files) != 3 {
+		t.Errorf("IndexFiles() = %v want 3 files", files)
+	}
+	for _, file := range files {
+		if file.Bytes == 0 || file.Fill != float64(file.Bytes)/float64(opts.MaxFileSize) {
+			t.Errorf("IndexFiles() %s = %d bytes, fill %f want its size against %d", file.Name, file.Bytes, file.Fill, opts.MaxFileSize)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package memorymapper
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tysonmote/gommap"
+)
+
+// terms.index keeps the text of every word of dictionary.index, so terms can be found by prefix or pattern
+// [header][len][bytes][len][bytes]...
+// [header][uint64][len bytes]...
+// len field of the header is the end of written data, extra field is the number of terms
+// all terms are loaded in memory on open and kept sorted
+type Terms struct {
+	mu      sync.RWMutex // Walk() holds RLock, Add() and sorting hold Lock
+	file    *os.File
+	mmap    gommap.MMap // mmap
+	len     uint64      // end of written data
+	sorted  []string    // terms in order
+	added   []string    // terms appended since the last sort
+	maxSize uint64      // size the file never grows past
+	closed  bool        // flag to check if the terms.index is closed
+}
+
+// open terms.index, an existing file is reopened and its terms loaded
+func NewTerms(opts Options) (*Terms, error) {
+	file, mmap, size, err := mapFile(opts.path(termsIndexFile), opts)
+	if err != nil {
+		return nil, err
+	}
+	t := &Terms{
+		file:    file,
+		mmap:    mmap,
+		maxSize: opts.MaxFileSize,
+	}
+	if err := t.load(size); err != nil {
+		mmap.UnsafeUnmap()
+		file.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Terms) load(size uint64) error {
+	if _, err := loadHeader(t.mmap, termsMagic, termsVersion, size); err != nil {
+		return err
+	}
+	t.len = max(getField(t.mmap, lenField), headerSize)
+	if size != 0 && t.len > size {
+		return fmt.Errorf("terms.index has invalid len %d", t.len)
+	}
+	count := getField(t.mmap, extraField)
+	t.sorted = make([]string, 0, count)
+	for offset := headerSize; offset < t.len; {
+		if offset+byteSize > t.len {
+			return fmt.Errorf("terms.index has a broken term at offset %d", offset)
+		}
+		termLen := encoder.Uint64(t.mmap[offset : offset+byteSize])
+		offset += byteSize
+		if offset+termLen > t.len {
+			return fmt.Errorf("terms.index has a broken term at offset %d", offset)
+		}
+		t.sorted = append(t.sorted, string(t.mmap[offset:offset+termLen]))
+		offset += termLen
+	}
+	if uint64(len(t.sorted)) != count {
+		return fmt.Errorf("terms.index has %d terms want %d", len(t.sorted), count)
+	}
+	slices.Sort(t.sorted)
+	return nil
+}
+
+// append a term, the caller adds each term once, when it is new in dictionary.index
+func (t *Terms) Add(term string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return errors.New("terms.index file is closed")
+	}
+	size := byteSize + uint64(len(term))
+	if t.len+size > uint64(len(t.mmap)) {
+		mmap, err := growFile(t.file, t.mmap, t.len+size, t.maxSize)
+		if err != nil {
+			if mmap == nil {
+				t.file.Close()
+				t.closed = true
+			}
+			return err
+		}
+		t.mmap = mmap
+	}
+	encoder.PutUint64(t.mmap[t.len:t.len+byteSize], uint64(len(term)))
+	copy(t.mmap[t.len+byteSize:t.len+size], term)
+	t.len += size
+	t.added = append(t.added, term)
+	putField(t.mmap, lenField, t.len)
+	putField(t.mmap, extraField, uint64(len(t.sorted)+len(t.added)))
+	return nil
+}
+
+// call fn for every term starting with prefix, in order, until fn returns false
+// fn must not call back into the terms
+func (t *Terms) Walk(prefix string, fn func(term string) bool) error {
+	if err := t.sort(); err != nil {
+		return err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return errors.New("terms.index file is closed")
+	}
+	i, _ := slices.BinarySearch(t.sorted, prefix)
+	for ; i < len(t.sorted) && strings.HasPrefix(t.sorted[i], prefix); i++ {
+		if !fn(t.sorted[i]) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// merge the terms added since the last walk
+func (t *Terms) sort() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return errors.New("terms.index file is closed")
+	}
+	if len(t.added) == 0 {
+		return nil
+	}
+	slices.Sort(t.added)
+	merged := make([]string, 0, len(t.sorted)+len(t.added))
+	i, j := 0, 0
+	for i < len(t.sorted) && j < len(t.added) {
+		if t.sorted[i] <= t.added[j] {
+			merged = append(merged, t.sorted[i])
+			i++
+		} else {
+			merged = append(merged, t.added[j])
+			j++
+		}
+	}
+	merged = append(merged, t.sorted[i:]...)
+	t.sorted = append(merged, t.added[j:]...)
+	t.added = t.added[:0]
+	return nil
+}
+
+// number of terms stored
+func (t *Terms) Count() uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return uint64(len(t.sorted) + len(t.added))
+}
+
+// write the terms added since the last sync to disk
+func (t *Terms) Sync() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return errors.New("terms.index file is closed")
+	}
+	return syncFile(t.file, t.mmap)
+}
+
+// close the terms.index
+func (t *Terms) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	slog.Debug("[terms.go] [Close()] closing terms.index")
+	if t.closed {
+		return errors.New("file is closed")
+	}
+	if err := closeFile(t.file, t.mmap, t.len); err != nil {
+		return err
+	}
+	t.closed = true
+	t.mmap = nil
+	t.file = nil
+	return nil
+}
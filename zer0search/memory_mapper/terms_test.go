@@ -0,0 +1,54 @@
+package memorymapper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTermsWalk(t *testing.T) {
+	opts := testOptions(t)
+
+	terms, err := NewTerms(opts)
+	if err != nil {
+		t.Fatalf("NewTerms(opts) = %v want <nil>", err)
+	}
+	for _, term := range []string{"search", "engine", "sea", "seal", "café"} {
+		if err := terms.Add(term); err != nil {
+			t.Fatalf("Add(%s) = %v want <nil>", term, err)
+		}
+	}
+	if err := terms.Close(); err != nil {
+		t.Fatalf("Close() = %v want <nil>", err)
+	}
+
+	terms, err = NewTerms(opts)
+	if err != nil {
+		t.Fatalf("NewTerms(opts) = %v want <nil>", err)
+	}
+	defer terms.Close()
+	terms.Add("seam")
+
+	testCase := []struct {
+		prefix string
+		want   []string
+	}{
+		{"sea", []string{"sea", "seal", "seam", "search"}},
+		{"", []string{"café", "engine", "sea", "seal", "seam", "search"}},
+		{"x", []string{}},
+	}
+	for _, test := range testCase {
+		got := make([]string, 0)
+		if err := terms.Walk(test.prefix, func(term string) bool {
+			got = append(got, term)
+			return true
+		}); err != nil {
+			t.Fatalf("Walk(%s) = %v want <nil>", test.prefix, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Walk(%s) = %v want %v", test.prefix, got, test.want)
+		}
+	}
+	if terms.Count() != 6 {
+		t.Errorf("Count() = %d want 6", terms.Count())
+	}
+}
@@ -0,0 +1,130 @@
+package memorymapper
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/tysonmote/gommap"
+)
+
+// tombstones.index is a bitmap of deleted documents, bit docId is set once docId is deleted
+// [header][docId 0-7][docId 8-15]...
+// len field of the header is the number of deleted documents, extra field is the largest deleted docId
+// deleted docIds stay in the segments until a merge drops them, searches skip them before
+type Tombstones struct {
+	mu      sync.RWMutex // IsDeleted() holds RLock, Delete() and remapping hold Lock
+	file    *os.File
+	mmap    gommap.MMap // mmap
+	len     uint64      // current size
+	count   uint64      // number of deleted documents
+	last    uint64      // largest deleted docId
+	maxSize uint64      // size the file never grows past
+	closed  bool        // flag to check if the tombstones.index is closed
+}
+
+// open tombstones.index, an existing file is reopened and its count restored from the header
+func NewTombstones(opts Options) (*Tombstones, error) {
+	file, mmap, size, err := mapFile(opts.path(tombstonesIndexFile), opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := loadHeader(mmap, tombstonesMagic, tombstonesVersion, size); err != nil {
+		mmap.UnsafeUnmap()
+		file.Close()
+		return nil, err
+	}
+	return &Tombstones{
+		file:    file,
+		mmap:    mmap,
+		len:     max(size, headerSize),
+		count:   getField(mmap, lenField),
+		last:    getField(mmap, extraField),
+		maxSize: opts.MaxFileSize,
+	}, nil
+}
+
+// mark docId as deleted, returns false if it was deleted already
+func (t *Tombstones) Delete(docId uint64) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false, errors.New("tombstones.index file is closed")
+	}
+	offset, ok := entryOffset(docId/8, 1, t.maxSize)
+	if !ok {
+		return false, ErrMaxFileSize
+	}
+	if offset+1 > uint64(len(t.mmap)) {
+		mmap, err := growFile(t.file, t.mmap, offset+1, t.maxSize)
+		if err != nil {
+			if mmap == nil {
+				t.file.Close()
+				t.closed = true
+			}
+			return false, err
+		}
+		t.mmap = mmap
+	}
+	bit := byte(1) << (docId % 8)
+	if t.mmap[offset]&bit != 0 {
+		return false, nil
+	}
+	t.mmap[offset] |= bit
+	t.count++
+	t.last = max(t.last, docId)
+	putField(t.mmap, lenField, t.count)
+	putField(t.mmap, extraField, t.last)
+	t.len = max(t.len, offset+1)
+	return true, nil
+}
+
+// check if docId is deleted
+func (t *Tombstones) IsDeleted(docId uint64) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.isDeleted(docId)
+}
+
+func (t *Tombstones) isDeleted(docId uint64) bool {
+	offset, ok := entryOffset(docId/8, 1, t.len)
+	if t.closed || !ok {
+		return false
+	}
+	return t.mmap[offset]&(byte(1)<<(docId%8)) != 0
+}
+
+// number of deleted documents and the largest deleted docId
+func (t *Tombstones) Stats() (uint64, uint64) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.count, t.last
+}
+
+// write the docIds deleted since the last sync to disk
+func (t *Tombstones) Sync() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return errors.New("tombstones.index file is closed")
+	}
+	return syncFile(t.file, t.mmap)
+}
+
+// close the tombstones.index
+func (t *Tombstones) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	slog.Debug("[tombstones.go] [Close()] closing tombstones.index")
+	if t.closed {
+		return errors.New("file is closed")
+	}
+	if err := closeFile(t.file, t.mmap, t.len); err != nil {
+		return err
+	}
+	t.closed = true
+	t.mmap = nil
+	t.file = nil
+	return nil
+}
@@ -0,0 +1,34 @@
+package memorymapper
+
+import "testing"
+
+func TestTombstonesReopen(t *testing.T) {
+	opts := testOptions(t)
+
+	tombstones, err := NewTombstones(opts)
+	if err != nil {
+		t.Fatalf("NewTombstones(opts) = %v want <nil>", err)
+	}
+	for _, docId := range []uint64{3, 9, 100000} {
+		if _, err := tombstones.Delete(docId); err != nil {
+			t.Fatalf("Delete(%d) = %v want <nil>", docId, err)
+		}
+	}
+	if err := tombstones.Close(); err != nil {
+		t.Fatalf("Close() = %v want <nil>", err)
+	}
+
+	tombstones, err = NewTombstones(opts)
+	if err != nil {
+		t.Fatalf("NewTombstones(opts) = %v want <nil>", err)
+	}
+	defer tombstones.Close()
+	if count, last := tombstones.Stats(); count != 3 || last != 100000 {
+		t.Errorf("Stats() = %d, %d want 3, 100000", count, last)
+	}
+	for docId, want := range map[uint64]bool{3: true, 9: true, 100000: true, 4: false, 8: false, 200000: false} {
+		if got := tombstones.IsDeleted(docId); got != want {
+			t.Errorf("IsDeleted(%d) = %v want %v", docId, got, want)
+		}
+	}
+}
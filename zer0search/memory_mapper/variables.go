@@ -1,13 +1,58 @@
 package memorymapper
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"errors"
+)
 
 var (
-	dictIndexFile           = "/memory_mapper/dictionary.index"
-	postingIndexFile        = "/memory_mapper/posting.index"
-	byteSize         uint64 = 8
-	dictEntrySize    uint64 = 24       // [hash][offset][postingLen]
-	MaxFileSize      uint64 = 10485760 // 10Mb
+	dictIndexFile              = "/memory_mapper/dictionary.index"
+	postingIndexFile           = "/memory_mapper/posting.index"
+	normsIndexFile             = "/memory_mapper/norms.index"
+	tombstonesIndexFile        = "/memory_mapper/tombstones.index"
+	docsDataFile               = "/memory_mapper/docs.dat"
+	docsIndexFile              = "/memory_mapper/docs.idx"
+	walFile                    = "/memory_mapper/index.wal"
+	termsIndexFile             = "/memory_mapper/terms.index"
+	accessIndexFile            = "/memory_mapper/access.index"
+	AnalyzerFile               = "/memory_mapper/analyzer.json" // analyzer config the index is built with
+	SchemaFile                 = "/memory_mapper/schema.json"   // document fields the index is built with
+	byteSize            uint64 = 8
+	dictEntrySize       uint64 = 32        // [hash][check][offset][postingLen]
+	hashEntrySize       uint64 = 24        // [hash][offset][postingLen] of dictionary.index version 1 and 2
+	maxGrowStep         uint64 = 268435456 // 256Mb
+
+	headerSize        uint64 = 32                 // [magic][version][len][extra]
+	dictMagic         uint64 = 0x7a65723064696374 // "zer0dict"
+	postingMagic      uint64 = 0x7a65723070737467 // "zer0pstg"
+	normsMagic        uint64 = 0x7a6572306e6f726d // "zer0norm"
+	tombstonesMagic   uint64 = 0x7a657230746f6d62 // "zer0tomb"
+	docsMagic         uint64 = 0x7a657230646f6373 // "zer0docs"
+	docsIdxMagic      uint64 = 0x7a65723064696478 // "zer0didx"
+	termsMagic        uint64 = 0x7a6572307465726d // "zer0term"
+	accessMagic       uint64 = 0x7a65723061636373 // "zer0accs"
+	dictVersion       uint64 = 3                  // 1: append only entries, 2: open addressing hash table, 3: slots with a check hash
+	postingVersion    uint64 = 4                  // 1: docIds, 2: docIds and freqs, 3: docIds, freqs and positions, 4: compressed with skip pointers
+	normsVersion      uint64 = 1
+	tombstonesVersion uint64 = 1
+	docsVersion       uint64 = 1
+	termsVersion      uint64 = 1
+	accessVersion     uint64 = 2  // 1: owner hash, 2: owner hash and check hash
+	accessEntrySize   uint64 = 24 // [owner][check][visibility]
+	accessEntrySizeV1 uint64 = 16 // [owner][visibility] of access.index version 1
+	dictMaxLoad       uint64 = 75 // percent of slots a hash table can fill
+	SkipInterval      uint64 = 64 // entries of a compressed posting list between two skip pointers
+	skipEntrySize     uint64 = 24 // [prevDocId][index][dataOffset]
+
+	compactSuffix = ".compact" // copies of an in place compaction by an older version
+	tmpSuffix     = ".tmp"
+
+	segmentsDir   = "/memory_mapper/segments"
+	manifestFile  = "segments.json"
+	segmentPrefix = "seg_"
+	restoreDir    = "/memory_mapper/restore.tmp" // snapshot unpacked before it replaces the index
 
 	encoder = binary.BigEndian
 )
+
+var ErrMaxFileSize = errors.New("file is reached to maximum size")
@@ -0,0 +1,107 @@
+package memorymapper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// index.wal is a write ahead log of the docIds being indexed
+// [docId][docId]...
+// [uint64][uint64]...
+// Begin() appends docIds and fsyncs them before any index file or the document store is written,
+// Commit() empties the log once all of them are written
+// docIds found in the log on startup were interrupted, the caller rolls them back
+type WAL struct {
+	mu     sync.Mutex
+	file   *os.File
+	closed bool // flag to check if the index.wal is closed
+}
+
+// open index.wal, docIds of an interrupted write are kept for Pending()
+func NewWAL(opts Options) (*WAL, error) {
+	file, err := os.OpenFile(opts.path(walFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &WAL{
+		file: file,
+	}, nil
+}
+
+// log docIds as being written, they are durable when Begin() returns
+func (w *WAL) Begin(docIds ...uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errors.New("index.wal file is closed")
+	}
+	buf := make([]byte, uint64(len(docIds))*byteSize)
+	for i, docId := range docIds {
+		encoder.PutUint64(buf[uint64(i)*byteSize:], docId)
+	}
+	if _, err := w.file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	if _, err := w.file.Write(buf); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// every logged docId is written or rolled back, empty the log
+func (w *WAL) Commit() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errors.New("index.wal file is closed")
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// docIds logged by Begin() and not committed
+func (w *WAL) Pending() ([]uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, errors.New("index.wal file is closed")
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(w.file)
+	if err != nil {
+		return nil, err
+	}
+	// a record torn by a crash was never synced, its docId was not written anywhere
+	if len(data)%int(byteSize) != 0 {
+		slog.Info("[wal.go] [Pending()] dropping torn record", "bytes", len(data)%int(byteSize))
+	}
+	docIds := make([]uint64, 0, len(data)/int(byteSize))
+	for offset := uint64(0); offset+byteSize <= uint64(len(data)); offset += byteSize {
+		docId := encoder.Uint64(data[offset : offset+byteSize])
+		if docId == 0 {
+			return nil, fmt.Errorf("index.wal has invalid docId at offset %d", offset)
+		}
+		docIds = append(docIds, docId)
+	}
+	return docIds, nil
+}
+
+// close the index.wal
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	slog.Debug("[wal.go] [Close()] closing index.wal")
+	if w.closed {
+		return errors.New("file is closed")
+	}
+	w.closed = true
+	return w.file.Close()
+}
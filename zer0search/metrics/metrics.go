@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"net/http"
+	memorymapper "searchengine/memory_mapper"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/**
+metrics served by GET /metrics in the Prometheus text format
+- latencies and counters are updated by EngineService as it indexes and searches
+- sizes of the index are read from an IndexSource at every scrape, see RegisterIndex()
+- Go runtime and process metrics
+**/
+
+const namespace = "zer0"
+
+// latency buckets from 0.5ms to about 16s
+var latencyBuckets = prometheus.ExponentialBuckets(0.0005, 2, 16)
+
+var (
+	Registry = prometheus.NewRegistry()
+
+	// one observation per write, a batch of POST /bulk or the importer is one write
+	IndexDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "index_duration_seconds",
+		Help:      "Time to index a document or a batch of documents.",
+		Buckets:   latencyBuckets,
+	})
+	SearchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "search_duration_seconds",
+		Help:      "Time to run a search, documents and snippets of the page included.",
+		Buckets:   latencyBuckets,
+	})
+	DocumentsIndexed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "documents_indexed_total",
+		Help:      "Documents indexed since the start, updates included.",
+	})
+	DocumentsDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "documents_deleted_total",
+		Help:      "Documents deleted since the start, updates included.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		IndexDuration,
+		SearchDuration,
+		DocumentsIndexed,
+		DocumentsDeleted,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// sizes of the index at a scrape
+type IndexSizes struct {
+	Documents    uint64 // indexed documents, deleted ones left out
+	Segments     uint64
+	SegmentBytes uint64 // posting bytes of the segments, deleted docIds included
+	BufferBytes  uint64 // compressed size of the postings not flushed
+	MaxFileSize  uint64
+	Files        []memorymapper.FileStats // mapped index files and their size on disk
+}
+
+// IndexSource is read at every scrape, EngineService implements it
+type IndexSource interface {
+	Sizes() (IndexSizes, error)
+}
+
+var (
+	documentsDesc    = prometheus.NewDesc(namespace+"_documents", "Indexed documents, deleted ones left out.", nil, nil)
+	segmentsDesc     = prometheus.NewDesc(namespace+"_segments", "Live segments of the index.", nil, nil)
+	postingBytesDesc = prometheus.NewDesc(namespace+"_posting_bytes", "Posting bytes of the segments and of the in-memory buffer.", []string{"location"}, nil)
+	mmapBytesDesc    = prometheus.NewDesc(namespace+"_mmap_file_bytes", "Size of a memory mapped index file, mapped ahead of its data.", []string{"file"}, nil)
+	mmapMaxDesc      = prometheus.NewDesc(namespace+"_mmap_max_file_bytes", "Size no index file grows past.", nil, nil)
+	scrapeErrorDesc  = prometheus.NewDesc(namespace+"_index_scrape_error", "1 if the sizes of the index could not be read.", nil, nil)
+)
+
+type indexCollector struct {
+	source IndexSource
+}
+
+// collect the sizes of source at every scrape, call once
+func RegisterIndex(source IndexSource) error {
+	return Registry.Register(indexCollector{source: source})
+}
+
+func (c indexCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- documentsDesc
+	ch <- segmentsDesc
+	ch <- postingBytesDesc
+	ch <- mmapBytesDesc
+	ch <- mmapMaxDesc
+	ch <- scrapeErrorDesc
+}
+
+func (c indexCollector) Collect(ch chan<- prometheus.Metric) {
+	sizes, err := c.source.Sizes()
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(scrapeErrorDesc, prometheus.GaugeValue, 1)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeErrorDesc, prometheus.GaugeValue, 0)
+	ch <- prometheus.MustNewConstMetric(documentsDesc, prometheus.GaugeValue, float64(sizes.Documents))
+	ch <- prometheus.MustNewConstMetric(segmentsDesc, prometheus.GaugeValue, float64(sizes.Segments))
+	ch <- prometheus.MustNewConstMetric(postingBytesDesc, prometheus.GaugeValue, float64(sizes.SegmentBytes), "segments")
+	ch <- prometheus.MustNewConstMetric(postingBytesDesc, prometheus.GaugeValue, float64(sizes.BufferBytes), "buffer")
+	ch <- prometheus.MustNewConstMetric(mmapMaxDesc, prometheus.GaugeValue, float64(sizes.MaxFileSize))
+	for _, file := range sizes.Files {
+		ch <- prometheus.MustNewConstMetric(mmapBytesDesc, prometheus.GaugeValue, float64(file.Bytes), file.Name)
+	}
+}
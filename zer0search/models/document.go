@@ -1,6 +1,16 @@
 package models
 
 type Document struct {
-	DocId string `json:"docId"`
-	Document string `json:"document"`
-}
\ No newline at end of file
+	DocId   int64          `json:"docId"`
+	Snippet string         `json:"snippet"` // best window of the document around the query words, highlighted
+	Score   float64        `json:"score"`
+	Fields  map[string]any `json:"fields,omitempty"` // stored fields of the schema
+}
+
+// one page of the documents matching a query
+type SearchResult struct {
+	Total     int        `json:"total"` // number of matching documents
+	Offset    int        `json:"offset"`
+	Limit     int        `json:"limit"`
+	Documents []Document `json:"documents"`
+}
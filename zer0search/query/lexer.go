@@ -0,0 +1,146 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenPhrase
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenMinus
+	tokenLParen
+	tokenRParen
+	tokenField
+)
+
+type token struct {
+	kind tokenKind
+	text string // word, phrase words, operator or field name
+	slop int    // only for tokenPhrase
+	pos  int    // byte offset in the query
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenPhrase:
+		return strconv.Quote(t.text)
+	case tokenField:
+		return "'" + t.text + ":'"
+	}
+	return "'" + t.text + "'"
+}
+
+// split a query into tokens
+func lex(q string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(q); {
+		r, size := utf8.DecodeRuneInString(q[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case r == '"':
+			tok, next, err := lexPhrase(q, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			i = next
+		case r == '-' && i+1 < len(q) && startsOperand(q[i+1:]):
+			tokens = append(tokens, token{kind: tokenMinus, text: "-", pos: i})
+			i++
+		case fieldName(q[i:]) > 0:
+			end := i + fieldName(q[i:])
+			tokens = append(tokens, token{kind: tokenField, text: q[i:end], pos: i})
+			i = end + 1
+		default:
+			end := i
+			for end < len(q) && !isSeparator(q[end:]) {
+				_, size := utf8.DecodeRuneInString(q[end:])
+				end += size
+			}
+			tokens = append(tokens, word(q[i:end], i))
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// read "phrase" or "phrase"~slop starting at the opening quote
+func lexPhrase(q string, start int) (token, int, error) {
+	end := strings.IndexByte(q[start+1:], '"')
+	if end < 0 {
+		return token{}, 0, &SyntaxError{Pos: start, Msg: "unclosed quote"}
+	}
+	end += start + 1
+	tok := token{kind: tokenPhrase, text: q[start+1 : end], pos: start}
+	next := end + 1
+	if next < len(q) && q[next] == '~' {
+		digits := next + 1
+		for digits < len(q) && q[digits] >= '0' && q[digits] <= '9' {
+			digits++
+		}
+		slop, err := strconv.Atoi(q[next+1 : digits])
+		if err != nil {
+			return token{}, 0, &SyntaxError{Pos: next, Msg: "expected a number after ~"}
+		}
+		tok.slop = slop
+		next = digits
+	}
+	return tok, next, nil
+}
+
+func word(text string, pos int) token {
+	switch text {
+	case "AND":
+		return token{kind: tokenAnd, text: text, pos: pos}
+	case "OR":
+		return token{kind: tokenOr, text: text, pos: pos}
+	case "NOT":
+		return token{kind: tokenNot, text: text, pos: pos}
+	}
+	return token{kind: tokenWord, text: text, pos: pos}
+}
+
+// length of the field name before name: at the beginning of q, 0 if q does not start with a field
+// a field is followed by a word, phrase or (, "name: x" is the word "name:"
+func fieldName(q string) int {
+	for i, r := range q {
+		switch {
+		case unicode.IsLetter(r) || r == '_' || (i > 0 && unicode.IsDigit(r)):
+			continue
+		case r == ':' && i > 0 && i+1 < len(q) && startsOperand(q[i+1:]) && q[i+1] != ':':
+			return i
+		}
+		return 0
+	}
+	return 0
+}
+
+// check if the rune at the beginning of q ends a word
+func isSeparator(q string) bool {
+	r, _ := utf8.DecodeRuneInString(q)
+	return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+}
+
+// check if a word, phrase or ( starts at the beginning of q
+func startsOperand(q string) bool {
+	r, _ := utf8.DecodeRuneInString(q)
+	return !unicode.IsSpace(r) && r != ')' && r != '-'
+}
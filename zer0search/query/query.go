@@ -0,0 +1,303 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/**
+query   := or
+or      := and ( OR and )*
+and     := unary ( [AND] unary )*          -> words next to each other are AND-ed
+unary   := NOT unary | -primary | primary
+primary := field:primary | ( or ) | "phrase" | "phrase"~slop | word
+word    := term | prefix* | wild?card* | fuzzy~ | fuzzy~distance
+field   := letter ( letter | digit | _ )*     -> title:foo, title:"a b", title:(a OR b)
+
+AND, OR and NOT are operators only in upper case
+* matches any number of characters, ? one character
+**/
+
+type Node interface {
+	String() string
+}
+
+// a single word, tokenized by the caller
+type Term struct {
+	Text string
+}
+
+// words that must appear next to each other, in order
+// "binary search" -> Words "binary search", Slop 0
+// "binary search"~3 -> Words "binary search", Slop 3
+type Phrase struct {
+	Words string // raw text between the quotes, tokenized by the caller
+	Slop  int    // extra positions allowed between the words, 0 for an exact phrase
+}
+
+// words starting with Text
+// "compu*" -> Text "compu"
+type Prefix struct {
+	Text string
+}
+
+// words matching Pattern, * is any number of characters, ? is one character
+type Wildcard struct {
+	Pattern string
+}
+
+// words at most Distance edits (Levenshtein) away from Text
+// "color~1" -> Text "color", Distance 1, "color~" -> Distance 2
+type Fuzzy struct {
+	Text     string
+	Distance int
+}
+
+// largest distance of a fuzzy word
+const MaxDistance = 2
+
+// Node searched only in the field Name of the documents
+// title:foo -> Name "title", Node foo
+type Field struct {
+	Name string
+	Node Node
+	Pos  int // byte offset of the name in the query
+}
+
+type And struct {
+	Nodes []Node
+}
+
+type Or struct {
+	Nodes []Node
+}
+
+type Not struct {
+	Node Node
+}
+
+func (t Term) String() string {
+	return t.Text
+}
+
+func (p Phrase) String() string {
+	if p.Slop == 0 {
+		return strconv.Quote(p.Words)
+	}
+	return strconv.Quote(p.Words) + "~" + strconv.Itoa(p.Slop)
+}
+
+func (p Prefix) String() string {
+	return p.Text + "*"
+}
+
+func (w Wildcard) String() string {
+	return w.Pattern
+}
+
+func (f Fuzzy) String() string {
+	return f.Text + "~" + strconv.Itoa(f.Distance)
+}
+
+func (f Field) String() string {
+	return f.Name + ":" + f.Node.String()
+}
+
+func (a And) String() string {
+	return join(a.Nodes, " AND ")
+}
+
+func (o Or) String() string {
+	return join(o.Nodes, " OR ")
+}
+
+func (n Not) String() string {
+	return "NOT " + n.Node.String()
+}
+
+func join(nodes []Node, sep string) string {
+	parts := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		parts = append(parts, node.String())
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// malformed query, Pos is the byte offset where parsing failed
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d : %s", e.Pos, e.Msg)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parse a query into a tree of Term, Phrase, Prefix, Wildcard, Fuzzy, Field, And, Or and Not
+func Parse(q string) (Node, error) {
+	tokens, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, &SyntaxError{Pos: 0, Msg: "empty query"}
+	}
+	p := &parser{tokens: tokens}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: "unexpected " + tok.String()}
+	}
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return token{kind: tokenEOF, pos: p.end()}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+// byte offset after the last token
+func (p *parser) end() int {
+	if len(p.tokens) == 0 {
+		return 0
+	}
+	last := p.tokens[len(p.tokens)-1]
+	return last.pos + len(last.text)
+}
+
+func (p *parser) or() (Node, error) {
+	node, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{node}
+	for p.peek().kind == tokenOr {
+		p.next()
+		node, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return Or{Nodes: nodes}, nil
+}
+
+func (p *parser) and() (Node, error) {
+	node, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{node}
+	for {
+		tok := p.peek()
+		if tok.kind == tokenAnd {
+			p.next()
+		} else if tok.kind == tokenEOF || tok.kind == tokenOr || tok.kind == tokenRParen {
+			break
+		}
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return And{Nodes: nodes}, nil
+}
+
+func (p *parser) unary() (Node, error) {
+	switch p.peek().kind {
+	case tokenNot:
+		p.next()
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: node}, nil
+	case tokenMinus:
+		p.next()
+		node, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: node}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenWord:
+		return parseWord(tok)
+	case tokenPhrase:
+		return Phrase{Words: tok.text, Slop: tok.slop}, nil
+	case tokenField:
+		node, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		return Field{Name: tok.text, Node: node, Pos: tok.pos}, nil
+	case tokenLParen:
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, &SyntaxError{Pos: closing.pos, Msg: "expected ) but found " + closing.String()}
+		}
+		return node, nil
+	}
+	return nil, &SyntaxError{Pos: tok.pos, Msg: "expected a word, phrase or ( but found " + tok.String()}
+}
+
+// a word is a term, a prefix, a wildcard pattern or a fuzzy word
+func parseWord(tok token) (Node, error) {
+	text := tok.text
+	if i := strings.LastIndexByte(text, '~'); i > 0 {
+		distance := MaxDistance
+		if i+1 < len(text) {
+			d, err := strconv.Atoi(text[i+1:])
+			if err != nil || d < 0 || d > MaxDistance {
+				return nil, &SyntaxError{Pos: tok.pos + i, Msg: fmt.Sprintf("expected a distance from 0 to %d after ~", MaxDistance)}
+			}
+			distance = d
+		}
+		if strings.ContainsAny(text[:i], "*?") {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: "a fuzzy word can not have wildcards"}
+		}
+		return Fuzzy{Text: text[:i], Distance: distance}, nil
+	}
+	wildcard := strings.IndexAny(text, "*?")
+	if wildcard < 0 {
+		return Term{Text: text}, nil
+	}
+	if strings.Trim(text, "*?") == "" {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: "a wildcard needs at least one letter"}
+	}
+	if wildcard == len(text)-1 && text[wildcard] == '*' {
+		return Prefix{Text: text[:wildcard]}, nil
+	}
+	return Wildcard{Pattern: text}, nil
+}
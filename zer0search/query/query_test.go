@@ -0,0 +1,82 @@
+package query
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCase := []struct {
+		query string
+		want  string
+	}{
+		{"binary", "binary"},
+		{"binary search", "(binary AND search)"},
+		{"binary AND search", "(binary AND search)"},
+		{"binary OR search", "(binary OR search)"},
+		{"a b OR c", "((a AND b) OR c)"},
+		{"a (b OR c)", "(a AND (b OR c))"},
+		{"a NOT b", "(a AND NOT b)"},
+		{"a -b", "(a AND NOT b)"},
+		{"a -(b OR c)", "(a AND NOT (b OR c))"},
+		{"e-mail", "e-mail"},
+		{`"binary search"`, `"binary search"`},
+		{`tree "binary search"~3`, `(tree AND "binary search"~3)`},
+		{`-"a b" c`, `(NOT "a b" AND c)`},
+		{"NOT NOT a", "NOT NOT a"},
+		{"and or not", "(and AND or AND not)"},
+		{"compu*", "compu*"},
+		{"wild?card", "wild?card"},
+		{"*ing", "*ing"},
+		{"colour~1", "colour~1"},
+		{"colour~", "colour~2"},
+		{"compu* -colour~1", "(compu* AND NOT colour~1)"},
+		{"title:binary", "title:binary"},
+		{`title:"binary search"~2 tree`, `(title:"binary search"~2 AND tree)`},
+		{"title:(a OR b) -tags:go", "(title:(a OR b) AND NOT tags:go)"},
+		{"published:2024-05-01T10:00:00Z", "published:2024-05-01T10:00:00Z"},
+		{"title:compu*", "title:compu*"},
+		{"a: b", "(a: AND b)"},
+	}
+
+	for _, test := range testCase {
+		got, err := Parse(test.query)
+		if err != nil {
+			t.Errorf("Parse(%s) = %v want <nil>", test.query, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("Parse(%s) = %s want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	testCase := []string{
+		"",
+		"   ",
+		"a AND",
+		"OR b",
+		"a OR OR b",
+		"(a b",
+		"a b)",
+		"()",
+		"NOT",
+		`"unclosed phrase`,
+		`"a b"~`,
+		"*",
+		"?*",
+		"colour~3",
+		"colour~x",
+		"col*r~1",
+		"title:)",
+	}
+
+	for _, test := range testCase {
+		_, err := Parse(test)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) = %v want *SyntaxError", test, err)
+		}
+	}
+}
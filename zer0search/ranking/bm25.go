@@ -0,0 +1,33 @@
+package ranking
+
+import "math"
+
+// Okapi BM25
+// score(doc, query) = sum over words of idf * freq * (k1 + 1) / (freq + k1 * (1 - b + b * docLen / avgDocLen))
+type BM25 struct {
+	K1 float64 // term frequency saturation
+	B  float64 // document length normalization
+}
+
+func NewBM25() *BM25 {
+	return &BM25{
+		K1: 1.2,
+		B:  0.75,
+	}
+}
+
+// inverse document frequency of a word found in df out of docs documents
+func (b *BM25) IDF(df, docs uint64) float64 {
+	docs = max(docs, df)
+	return math.Log(1 + (float64(docs)-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// score of a word found freq times in a document of docLen tokens
+func (b *BM25) Score(idf float64, freq, docLen uint64, avgDocLen float64) float64 {
+	norm := 1.0
+	if avgDocLen > 0 {
+		norm = 1 - b.B + b.B*float64(docLen)/avgDocLen
+	}
+	tf := float64(freq)
+	return idf * tf * (b.K1 + 1) / (tf + b.K1*norm)
+}
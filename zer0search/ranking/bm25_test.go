@@ -0,0 +1,22 @@
+package ranking
+
+import "testing"
+
+func TestBM25(t *testing.T) {
+	bm25 := NewBM25()
+
+	if rare, common := bm25.IDF(1, 100), bm25.IDF(50, 100); rare <= common {
+		t.Errorf("IDF(1, 100) = %v want > IDF(50, 100) = %v", rare, common)
+	}
+	if idf := bm25.IDF(100, 100); idf <= 0 {
+		t.Errorf("IDF(100, 100) = %v want > 0", idf)
+	}
+
+	idf := bm25.IDF(10, 100)
+	if more, less := bm25.Score(idf, 3, 10, 10), bm25.Score(idf, 1, 10, 10); more <= less {
+		t.Errorf("Score(freq 3) = %v want > Score(freq 1) = %v", more, less)
+	}
+	if short, long := bm25.Score(idf, 1, 5, 10), bm25.Score(idf, 1, 20, 10); short <= long {
+		t.Errorf("Score(docLen 5) = %v want > Score(docLen 20) = %v", short, long)
+	}
+}
@@ -1,10 +1,12 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"errors"
 	"log/slog"
 	"searchengine/db"
+	memorymapper "searchengine/memory_mapper"
 )
 
 type DocumentRepo struct {
@@ -17,25 +19,48 @@ func NewDocumentRepo(db *sql.DB) *DocumentRepo {
 	}
 }
 
-func (d *DocumentRepo) Insert(document string) (int64, error) {
-	res, err1 := d.db.Exec(db.InsertStmt, document)
-	docId, err2 := res.LastInsertId()
-	if err1 == nil && err2 == nil {
-		return docId, nil
+// store document under docId assigned by the index, so both always agree on ids
+func (d *DocumentRepo) Insert(ctx context.Context, docId int64, document string) error {
+	if _, err := d.db.ExecContext(ctx, db.InsertStmt, docId, document); err != nil {
+		slog.ErrorContext(ctx, "[document_repo.go] [Insert()] document insertion error", "docId", docId, "err", err)
+		return err
 	}
-	slog.Info("[document_repo.go] [Insert()] document insertion error : ", err1, err2)
-	return 0, fmt.Errorf("%w, %w", err1, err2)
+	return nil
 }
 
-func (d *DocumentRepo) Query(id int) (string, error) {
+func (d *DocumentRepo) Query(ctx context.Context, id int) (string, error) {
 	var document string
-	if err := d.db.QueryRow(db.QueryStmt, id).Scan(&document); err != nil {
-		slog.Error("[document_repo.go] [Query()] document retriving error : ", err)
+	err := d.db.QueryRowContext(ctx, db.QueryStmt, id).Scan(&document)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", memorymapper.ErrDocumentNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "[document_repo.go] [Query()] document retriving error", "docId", id, "err", err)
 		return "", err
 	}
 	return document, nil
 }
 
-func (d *DocumentRepo) DeleteAt(docId int) {
+// largest stored document id, 0 if there is no document
+func (d *DocumentRepo) LastId(ctx context.Context) (int64, error) {
+	var id int64
+	if err := d.db.QueryRowContext(ctx, db.LastIdStmt).Scan(&id); err != nil {
+		slog.ErrorContext(ctx, "[document_repo.go] [LastId()] last document id error", "err", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// delete the document stored under docId, deleting a missing document is not an error
+func (d *DocumentRepo) DeleteAt(ctx context.Context, docId int) error {
+	if _, err := d.db.ExecContext(ctx, db.DeleteStmt, docId); err != nil {
+		slog.ErrorContext(ctx, "[document_repo.go] [DeleteAt()] document deletion error", "docId", docId, "err", err)
+		return err
+	}
+	return nil
+}
 
+// every statement is committed by mysql when it returns
+func (d *DocumentRepo) Sync(ctx context.Context) error {
+	return nil
 }
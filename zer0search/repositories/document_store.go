@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"context"
+	"log/slog"
+	memorymapper "searchengine/memory_mapper"
+)
+
+// DocumentStore keeps the text of every indexed document under its docId
+// DocumentRepo stores documents in mysql, FileDocumentRepo in the embedded docs.dat
+// ctx is the context of the request, mysql queries are cancelled with it
+// Query returns memorymapper.ErrDocumentNotFound for a docId without document
+// Sync makes every insert and delete durable, it is called before index.wal is cleared
+type DocumentStore interface {
+	Insert(ctx context.Context, docId int64, document string) error
+	Query(ctx context.Context, id int) (string, error)
+	LastId(ctx context.Context) (int64, error)
+	DeleteAt(ctx context.Context, docId int) error
+	Sync(ctx context.Context) error
+}
+
+type FileDocumentRepo struct {
+	docs *memorymapper.Documents
+}
+
+func NewFileDocumentRepo(docs *memorymapper.Documents) *FileDocumentRepo {
+	return &FileDocumentRepo{
+		docs: docs,
+	}
+}
+
+func (f *FileDocumentRepo) Insert(ctx context.Context, docId int64, document string) error {
+	if err := f.docs.Append(uint64(docId), document); err != nil {
+		slog.ErrorContext(ctx, "[document_store.go] [Insert()] document insertion error", "docId", docId, "err", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FileDocumentRepo) Query(ctx context.Context, id int) (string, error) {
+	document, err := f.docs.Get(uint64(id))
+	if err != nil {
+		slog.ErrorContext(ctx, "[document_store.go] [Query()] document retriving error", "docId", id, "err", err)
+		return "", err
+	}
+	return document, nil
+}
+
+// largest docId ever stored, deleted documents included, 0 if there is no document
+func (f *FileDocumentRepo) LastId(ctx context.Context) (int64, error) {
+	_, last := f.docs.Stats()
+	return int64(last), nil
+}
+
+// delete the document stored under docId, deleting a missing document is not an error
+func (f *FileDocumentRepo) DeleteAt(ctx context.Context, docId int) error {
+	if _, err := f.docs.Delete(uint64(docId)); err != nil {
+		slog.ErrorContext(ctx, "[document_store.go] [DeleteAt()] document deletion error", "docId", docId, "err", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FileDocumentRepo) Sync(ctx context.Context) error {
+	if err := f.docs.Sync(); err != nil {
+		slog.ErrorContext(ctx, "[document_store.go] [Sync()] document sync error", "err", err)
+		return err
+	}
+	return nil
+}
@@ -1,60 +1,374 @@
 package repositories
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	memorymapper "searchengine/memory_mapper"
 )
 
+// the index is a buffer of the documents indexed since the last flush and the immutable segments before it
+// norms, tombstones, index.wal, terms.index and access.index are shared by all of them
 type IndexRepo struct {
-	dict *memorymapper.Dictionary
-	post *memorymapper.Posting
+	segments   *memorymapper.Segments
+	buffer     *memorymapper.Buffer
+	norms      *memorymapper.Norms
+	tombstones *memorymapper.Tombstones
+	wal        *memorymapper.WAL
+	terms      *memorymapper.Terms
+	access     *memorymapper.Access
 }
 
-func NewIndexRepo(dict *memorymapper.Dictionary, post *memorymapper.Posting) *IndexRepo {
+func NewIndexRepo(segments *memorymapper.Segments, norms *memorymapper.Norms, tombstones *memorymapper.Tombstones, wal *memorymapper.WAL, terms *memorymapper.Terms, access *memorymapper.Access) *IndexRepo {
 	return &IndexRepo{
-		dict: dict,
-		post: post,
+		segments:   segments,
+		buffer:     memorymapper.NewBuffer(),
+		norms:      norms,
+		tombstones: tombstones,
+		wal:        wal,
+		terms:      terms,
+		access:     access,
 	}
 }
 
-// search word in dictionary.index
-// true : get docIds from posting.index, append new docId and update dictionary.index
-// false : append docId in posting.index and append postingOffset in dictionary.index
-func (i *IndexRepo) Update(wordHash uint64, docId int64) error {
-	found, offset, postingOffset, postingLen, err := i.dict.Search(wordHash)
+// add entries of a batch of documents, sorted by docId, to the word's posting list in the buffer
+// a word not in the buffer nor in a segment is added to terms.index
+// the word is keyed by its hash and its check hash, words of the same hash keep their own posting lists
+func (i *IndexRepo) UpdateMany(word string, entries []memorymapper.PostingEntry) error {
+	key := memorymapper.WordKey(word)
+	known := i.hasKey(key)
+	if err := i.buffer.Add(key, entries...); err != nil {
+		return err
+	}
+	if known {
+		return nil
+	}
+	return i.terms.Add(word)
+}
+
+// add entries of a document indexed again from the document store after a crash lost the buffer
+// its words were added to terms.index when it was first indexed
+func (i *IndexRepo) Replay(word string, entries []memorymapper.PostingEntry) error {
+	return i.buffer.Add(memorymapper.WordKey(word), entries...)
+}
+
+// drop the buffer, Replay() rebuilds it from the document store
+func (i *IndexRepo) ClearBuffer() {
+	i.buffer.Clear()
+}
+
+// write the buffer as a new segment
+func (i *IndexRepo) Flush() error {
+	return i.segments.Flush(i.buffer)
+}
+
+// largest docId written to a segment, the documents after it are lost from the buffer by a crash
+func (i *IndexRepo) Flushed() uint64 {
+	return i.segments.Flushed()
+}
+
+// flush the buffer and merge every segment into one, without deleted docIds
+func (i *IndexRepo) Compact() error {
+	if err := i.Flush(); err != nil {
+		return err
+	}
+	return i.segments.ForceMerge(i.tombstones)
+}
+
+// merge small segments in the background until the segments are closed
+func (i *IndexRepo) MergeLoop() {
+	i.segments.MergeLoop(i.tombstones)
+}
+
+// segments written by an older version are read only, rewrite them into the current format
+// the words of terms.index give the check hashes a segment without them is missing, call it once terms.index is complete
+func (i *IndexRepo) Upgrade() error {
+	return i.segments.Upgrade(i.tombstones, i.terms)
+}
+
+// get docIds with their term frequency and positions from every segment and the buffer, deleted docIds are skipped
+func (i *IndexRepo) GetPostings(word string) ([]memorymapper.PostingEntry, error) {
+	key := memorymapper.WordKey(word)
+	entries, err := i.segments.Search(key)
+	if err != nil {
+		return []memorymapper.PostingEntry{}, err
+	}
+	return i.live(append(entries, i.buffer.Search(key)...)), nil
+}
+
+// postings of the word limited to sorted docIds, deleted docIds are skipped
+// segments jump over the docIds in between with their skip pointers
+func (i *IndexRepo) GetPostingsIn(word string, docIds []uint64) ([]memorymapper.PostingEntry, error) {
+	if len(docIds) == 0 {
+		return []memorymapper.PostingEntry{}, nil
+	}
+	key := memorymapper.WordKey(word)
+	entries, err := i.segments.Seek(key, docIds)
 	if err != nil {
+		return []memorymapper.PostingEntry{}, err
+	}
+	return i.live(append(entries, i.buffer.Seek(key, docIds)...)), nil
+}
+
+// entries without deleted docIds
+func (i *IndexRepo) live(entries []memorymapper.PostingEntry) []memorymapper.PostingEntry {
+	live := entries[:0]
+	for _, entry := range entries {
+		if !i.tombstones.IsDeleted(entry.DocId) {
+			live = append(live, entry)
+		}
+	}
+	return live
+}
+
+// number of docIds in the posting list of the word, deleted docIds count until a merge drops them
+func (i *IndexRepo) DocFreq(word string) uint64 {
+	key := memorymapper.WordKey(word)
+	return i.segments.DocFreq(key) + i.buffer.DocFreq(key)
+}
+
+// call fn for every stored term starting with prefix, in order, until fn returns false
+func (i *IndexRepo) Terms(prefix string, fn func(term string) bool) error {
+	return i.terms.Walk(prefix, fn)
+}
+
+// add a word of the index missing from terms.index
+func (i *IndexRepo) AddTerm(word string) error {
+	return i.terms.Add(word)
+}
+
+// check if every word of the segments and the buffer can be in terms.index
+// an index built before terms.index, or a crash between both appends, leaves words without a term
+func (i *IndexRepo) TermsComplete() bool {
+	seen := make(map[memorymapper.Key]struct{})
+	if err := i.segments.Words(seen); err != nil {
+		return false
+	}
+	i.buffer.Words(seen)
+	return i.terms.Count() >= uint64(len(seen))
+}
+
+// check if word is stored in a segment or in the buffer
+func (i *IndexRepo) HasWord(word string) bool {
+	return i.hasKey(memorymapper.WordKey(word))
+}
+
+func (i *IndexRepo) hasKey(key memorymapper.Key) bool {
+	return i.buffer.HasWord(key) || i.segments.HasWord(key)
+}
+
+// mark docId as deleted and drop its length from the ranking stats
+// returns false if docId is not indexed or deleted already
+func (i *IndexRepo) Delete(docId uint64) (bool, error) {
+	if i.norms.Get(docId) == 0 {
+		return false, nil
+	}
+	deleted, err := i.tombstones.Delete(docId)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	if err := i.norms.Set(docId, 0); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// log docIds in index.wal before any of their words is written
+func (i *IndexRepo) Begin(docIds ...int64) error {
+	ids := make([]uint64, len(docIds))
+	for j, docId := range docIds {
+		ids[j] = uint64(docId)
+	}
+	return i.wal.Begin(ids...)
+}
+
+// docId is written to the index and the document store, clear index.wal
+// the mapped files and docs are synced first, a crash after the commit finds every write on disk
+// the buffer is flushed once it is full, a failed flush is retried by the next commit
+func (i *IndexRepo) Commit(ctx context.Context, docs DocumentStore) error {
+	if err := i.sync(); err != nil {
+		slog.ErrorContext(ctx, "[index_repo.go]		[Commit()]	sync error", "err", err)
+		return err
+	}
+	if err := docs.Sync(ctx); err != nil {
 		return err
 	}
-	if !found {
-		postingOffset, err = i.post.Append(uint64(docId), true)
-		if err != nil {
-			return err
+	if err := i.wal.Commit(); err != nil {
+		return err
+	}
+	if i.segments.Full(i.buffer) {
+		if err := i.Flush(); err != nil {
+			slog.ErrorContext(ctx, "[index_repo.go]		[Commit()]	flush error", "err", err)
 		}
-		err = i.dict.Append(wordHash, postingOffset, uint64(1))
-		if err != nil {
-			return err
+	}
+	return nil
+}
+
+// write norms.index, tombstones.index, terms.index and access.index to disk
+func (i *IndexRepo) sync() error {
+	return errors.Join(
+		i.norms.Sync(),
+		i.tombstones.Sync(),
+		i.terms.Sync(),
+		i.access.Sync(),
+	)
+}
+
+// docIds left in index.wal by an interrupted write
+func (i *IndexRepo) Pending() ([]int64, error) {
+	pending, err := i.wal.Pending()
+	if err != nil {
+		return nil, err
+	}
+	docIds := make([]int64, 0, len(pending))
+	for _, docId := range pending {
+		docIds = append(docIds, int64(docId))
+	}
+	return docIds, nil
+}
+
+// hide a partly written docId, its posting entries are skipped and dropped by a merge
+func (i *IndexRepo) Rollback(docId int64) error {
+	if _, err := i.tombstones.Delete(uint64(docId)); err != nil {
+		return err
+	}
+	return i.norms.Set(uint64(docId), 0)
+}
+
+// check if docId is indexed and not deleted
+func (i *IndexRepo) Exists(docId uint64) bool {
+	return i.norms.Get(docId) != 0 && !i.tombstones.IsDeleted(docId)
+}
+
+// largest deleted docId, 0 if no document is deleted
+func (i *IndexRepo) LastDeleted() uint64 {
+	_, last := i.tombstones.Stats()
+	return last
+}
+
+// store the number of tokens of docId
+func (i *IndexRepo) SetLength(docId int64, length uint64) error {
+	return i.norms.Set(uint64(docId), length)
+}
+
+// number of tokens of docId
+func (i *IndexRepo) Length(docId uint64) uint64 {
+	return i.norms.Get(docId)
+}
+
+// store the owner key and the visibility of docId
+func (i *IndexRepo) SetAccess(docId int64, owner memorymapper.Key, private bool) error {
+	return i.access.Set(uint64(docId), owner, private)
+}
+
+// owner key of docId and if it is private
+func (i *IndexRepo) Access(docId uint64) (memorymapper.Key, bool) {
+	return i.access.Get(docId)
+}
+
+// number of indexed documents and sum of their lengths
+func (i *IndexRepo) Stats() (uint64, uint64) {
+	return i.norms.Stats()
+}
+
+// check that every word of every segment points to a valid slice in its posting.index
+// and every docId is sorted, in the range of its segment and exists in the document store (docId <= lastDocId) or is deleted
+func (i *IndexRepo) Verify(lastDocId int64) error {
+	return i.segments.Walk(func(info memorymapper.SegmentInfo, key memorymapper.Key, entries []memorymapper.PostingEntry) error {
+		prev := uint64(0)
+		for _, entry := range entries {
+			if entry.DocId < prev {
+				return fmt.Errorf("segment %s, word %d : docId %d is not sorted", info.Name, key.Hash, entry.DocId)
+			}
+			if entry.DocId < info.MinDocId || entry.DocId > info.MaxDocId {
+				return fmt.Errorf("segment %s, word %d : docId %d is out of the segment", info.Name, key.Hash, entry.DocId)
+			}
+			if entry.DocId == 0 || (entry.DocId > uint64(lastDocId) && !i.tombstones.IsDeleted(entry.DocId)) {
+				return fmt.Errorf("segment %s, word %d : docId %d not found in document store", info.Name, key.Hash, entry.DocId)
+			}
+			prev = entry.DocId
 		}
 		return nil
+	})
+}
+
+// copy the segments and the index files to dest, a directory or a .tar.gz, no write must run
+func (i *IndexRepo) Snapshot(dest string, lastDocId int64) (memorymapper.SnapshotInfo, error) {
+	return memorymapper.Snapshot(i.segments, dest, lastDocId)
+}
+
+// live segments, oldest first
+func (i *IndexRepo) Segments() []memorymapper.SegmentInfo {
+	return i.segments.Infos()
+}
+
+// documents and compressed posting bytes of the buffer, no write must run
+func (i *IndexRepo) BufferStats() (uint64, uint64) {
+	return i.buffer.Stats()
+}
+
+// index files and their size on disk
+func (i *IndexRepo) Files() ([]memorymapper.FileStats, error) {
+	return memorymapper.IndexFiles(i.segments)
+}
+
+// size no index file grows past
+func (i *IndexRepo) MaxFileSize() uint64 {
+	return i.segments.MaxFileSize()
+}
+
+// usage of the segments, the buffer and the index files
+type IndexStats struct {
+	Segments    []memorymapper.SegmentStats
+	Files       []memorymapper.FileStats
+	MaxFileSize uint64
+	BufferDocs  uint64
+	BufferBytes uint64
+	Deleted     uint64                      // deleted docIds
+	Terms       uint64                      // words of terms.index
+	DocFreq     map[memorymapper.Key]uint64 // live docIds of every word of the segments and the buffer
+}
+
+// walk every segment and the buffer, no write must run
+func (i *IndexRepo) Inspect() (IndexStats, error) {
+	stats := IndexStats{
+		MaxFileSize: i.MaxFileSize(),
+		Terms:       i.terms.Count(),
+		DocFreq:     make(map[memorymapper.Key]uint64),
 	}
-	postingOffset, err = i.post.Update(postingOffset, postingLen, uint64(docId))
+	segments, err := i.segments.Stats(i.tombstones, stats.DocFreq)
 	if err != nil {
-		return err
+		return stats, err
 	}
-	err = i.dict.Update(offset, postingOffset, postingLen+1)
+	stats.Segments = segments
+	files, err := i.Files()
 	if err != nil {
-		return err
+		return stats, err
 	}
-	return nil
+	stats.Files = files
+	stats.BufferDocs, stats.BufferBytes = i.BufferStats()
+	stats.Deleted, _ = i.tombstones.Stats()
+
+	buffered := make(map[memorymapper.Key]struct{})
+	i.buffer.Words(buffered)
+	for key := range buffered {
+		if live := uint64(len(i.live(i.buffer.Search(key)))); live > 0 {
+			stats.DocFreq[key] += live
+		}
+	}
+	return stats, nil
 }
 
-// search word in dictionary.index
-// get docIds from posting.index
-func (i *IndexRepo) GetDocIds(wordHash uint64) ([]uint64, error) {
-	found, _, postingOffset, postingLen, err := i.dict.Search(wordHash)
+// entries of word in every segment and in the buffer, deleted docIds included
+func (i *IndexRepo) Postings(word string) ([]memorymapper.SegmentPostings, error) {
+	key := memorymapper.WordKey(word)
+	postings, err := i.segments.Postings(key)
 	if err != nil {
-		return []uint64{}, err
+		return nil, err
 	}
-	if !found {
-		return []uint64{}, nil
+	if entries := i.buffer.Search(key); len(entries) > 0 {
+		postings = append(postings, memorymapper.SegmentPostings{Segment: "buffer", Entries: entries})
 	}
-	return i.post.Search(postingOffset, postingLen)
+	return postings, nil
 }
@@ -0,0 +1,289 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"searchengine/utils"
+	"strings"
+	"time"
+	"unicode"
+)
+
+/**
+fields of the documents of an index, declared once when the index is created
+
+	{"fields": [
+		{"name": "title", "type": "text", "boost": 2, "stored": true},
+		{"name": "body", "type": "text", "stored": true},
+		{"name": "tags", "type": "keyword", "stored": true},
+		{"name": "published", "type": "date", "stored": true}
+	]}
+
+text    : analyzed into words, searched by terms and phrases
+keyword : every value is one exact term, a string or a list of strings
+date    : RFC 3339 timestamp, indexed as one term in UTC
+
+every field has its own inverted index in dictionary.index, a word is stored as "field:word",
+except in DefaultField which keeps the plain word, so an index of plain text documents reads the same
+a word of DefaultField starting with "field:" of another field is stored as "document:field:..." instead,
+the plain word would read as the field's word
+**/
+
+const (
+	Text    = "text"
+	Keyword = "keyword"
+	Date    = "date"
+)
+
+// field of a plain text document
+const DefaultField = "document"
+
+// a document does not match the schema
+var ErrInvalidDocument = errors.New("invalid document")
+
+type Field struct {
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Boost  float64 `json:"boost,omitempty"` // score multiplier of the field's words, 0 is 1
+	Stored bool    `json:"stored"`          // returned with search results
+}
+
+type Schema struct {
+	Fields []Field `json:"fields"`
+	byName map[string]int
+}
+
+// values of every field of a document, a text or date field holds one value
+type Document map[string][]string
+
+// a single stored text field, the schema of an index built before schemas
+func Default() *Schema {
+	s, _ := New([]Field{{Name: DefaultField, Type: Text, Stored: true}})
+	return s
+}
+
+func New(fields []Field) (*Schema, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("schema has no fields")
+	}
+	s := &Schema{Fields: fields, byName: make(map[string]int, len(fields))}
+	for i, field := range fields {
+		if !validName(field.Name) {
+			return nil, fmt.Errorf("field name %q must be letters, digits and _", field.Name)
+		}
+		if _, ok := s.byName[field.Name]; ok {
+			return nil, fmt.Errorf("field %s is declared twice", field.Name)
+		}
+		if field.Type != Text && field.Type != Keyword && field.Type != Date {
+			return nil, fmt.Errorf("field %s has unknown type %q", field.Name, field.Type)
+		}
+		if field.Boost < 0 {
+			return nil, fmt.Errorf("field %s has a negative boost", field.Name)
+		}
+		s.byName[field.Name] = i
+	}
+	return s, nil
+}
+
+// a field name starts with a letter, the query parser reads name: as a field
+func validName(name string) bool {
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// schema stored at path, an index keeps the schema it was created with
+// a new index stores the schema declared in the file declared, or Default() when declared is empty
+func Load(path string, declared string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s := Default()
+		if declared != "" {
+			if s, err = read(declared); err != nil {
+				return nil, err
+			}
+		}
+		return s, Save(path, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parse(path, data)
+}
+
+func read(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(path, data)
+}
+
+func parse(path string, data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s : %w", path, err)
+	}
+	return New(s.Fields)
+}
+
+// store s at path, a crash keeps the previous schema or the new one
+func Save(path string, s *Schema) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, data)
+}
+
+func (s *Schema) Field(name string) (Field, bool) {
+	i, ok := s.byName[name]
+	if !ok {
+		return Field{}, false
+	}
+	return s.Fields[i], true
+}
+
+// check if s only has DefaultField, its documents are stored as plain text
+func (s *Schema) IsDefault() bool {
+	return len(s.Fields) == 1 && s.Fields[0].Name == DefaultField
+}
+
+// word of field as stored in dictionary.index and terms.index
+func (s *Schema) Key(field, word string) string {
+	if field == DefaultField && !s.prefixed(word) {
+		return word
+	}
+	return field + ":" + word
+}
+
+// field and word of a stored key, DefaultField if the key has no field of s
+func (s *Schema) Split(key string) (string, string) {
+	if s.prefixed(key) {
+		i := strings.IndexByte(key, ':')
+		return key[:i], key[i+1:]
+	}
+	return DefaultField, key
+}
+
+// check if key starts with a field of s and a ':', the default schema has no other field to collide with
+func (s *Schema) prefixed(key string) bool {
+	if s.IsDefault() {
+		return false
+	}
+	i := strings.IndexByte(key, ':')
+	if i <= 0 {
+		return false
+	}
+	_, ok := s.byName[key[:i]]
+	return ok
+}
+
+// score multiplier of field
+func (f Field) Weight() float64 {
+	if f.Boost == 0 {
+		return 1
+	}
+	return f.Boost
+}
+
+// check the fields of a JSON document against s
+// a text field is a string, a keyword field a string or a list of strings, a date field an RFC 3339 string
+func (s *Schema) Parse(fields map[string]any) (Document, error) {
+	doc := make(Document, len(fields))
+	for name, value := range fields {
+		field, ok := s.Field(name)
+		if !ok {
+			return nil, fmt.Errorf("%w : unknown field %s", ErrInvalidDocument, name)
+		}
+		values, err := field.values(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w : %w", ErrInvalidDocument, err)
+		}
+		if len(values) > 0 {
+			doc[name] = values
+		}
+	}
+	if len(doc) == 0 {
+		return nil, fmt.Errorf("%w : no fields", ErrInvalidDocument)
+	}
+	return doc, nil
+}
+
+func (f Field) values(value any) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		if f.Type == Date {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("field %s is not an RFC 3339 date", f.Name)
+			}
+			v = t.UTC().Format(time.RFC3339)
+		}
+		return []string{v}, nil
+	case []any:
+		if f.Type != Keyword {
+			return nil, fmt.Errorf("field %s holds one value", f.Name)
+		}
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("field %s must be a list of strings", f.Name)
+			}
+			if str != "" {
+				values = append(values, str)
+			}
+		}
+		return values, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("field %s must be a string", f.Name)
+}
+
+// document as saved in the document store, plain text for the default schema, JSON otherwise
+func (s *Schema) Encode(doc Document) (string, error) {
+	if s.IsDefault() {
+		return strings.Join(doc[DefaultField], " "), nil
+	}
+	data, err := json.Marshal(doc)
+	return string(data), err
+}
+
+// document read from the document store
+func (s *Schema) Decode(stored string) (Document, error) {
+	if s.IsDefault() {
+		return Document{DefaultField: {stored}}, nil
+	}
+	var doc Document
+	if err := json.Unmarshal([]byte(stored), &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// stored fields of doc as returned by a search, keyword fields are lists
+func (s *Schema) Stored(doc Document) map[string]any {
+	stored := make(map[string]any)
+	for _, field := range s.Fields {
+		values, ok := doc[field.Name]
+		if !field.Stored || !ok {
+			continue
+		}
+		if field.Type == Keyword {
+			stored[field.Name] = values
+		} else {
+			stored[field.Name] = values[0]
+		}
+	}
+	return stored
+}
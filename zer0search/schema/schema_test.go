@@ -0,0 +1,155 @@
+package schema
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testSchema(t *testing.T) *Schema {
+	t.Helper()
+	s, err := New([]Field{
+		{Name: "title", Type: Text, Boost: 2, Stored: true},
+		{Name: "body", Type: Text},
+		{Name: "tags", Type: Keyword, Stored: true},
+		{Name: "published", Type: Date, Stored: true},
+	})
+	if err != nil {
+		t.Fatalf("New() = %v want <nil>", err)
+	}
+	return s
+}
+
+func TestNew(t *testing.T) {
+	testCase := [][]Field{
+		{},
+		{{Name: "title", Type: Text}, {Name: "title", Type: Keyword}},
+		{{Name: "1title", Type: Text}},
+		{{Name: "ti:tle", Type: Text}},
+		{{Name: "title", Type: "number"}},
+		{{Name: "title", Type: Text, Boost: -1}},
+	}
+
+	for _, fields := range testCase {
+		if _, err := New(fields); err == nil {
+			t.Errorf("New(%v) = <nil> want error", fields)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	s := testSchema(t)
+
+	doc, err := s.Parse(map[string]any{
+		"title":     "Binary search",
+		"tags":      []any{"go", "search"},
+		"published": "2024-05-01T12:00:00+02:00",
+	})
+	if err != nil {
+		t.Fatalf("Parse() = %v want <nil>", err)
+	}
+	want := Document{"title": {"Binary search"}, "tags": {"go", "search"}, "published": {"2024-05-01T10:00:00Z"}}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("Parse() = %v want %v", doc, want)
+	}
+
+	stored, err := s.Encode(doc)
+	if err != nil {
+		t.Fatalf("Encode() = %v want <nil>", err)
+	}
+	if decoded, err := s.Decode(stored); err != nil || !reflect.DeepEqual(decoded, doc) {
+		t.Errorf("Decode(%s) = %v, %v want %v", stored, decoded, err, doc)
+	}
+	wantStored := map[string]any{"title": "Binary search", "tags": []string{"go", "search"}, "published": "2024-05-01T10:00:00Z"}
+	if got := s.Stored(doc); !reflect.DeepEqual(got, wantStored) {
+		t.Errorf("Stored() = %v want %v", got, wantStored)
+	}
+
+	invalid := []map[string]any{
+		{},
+		{"title": ""},
+		{"author": "jane"},
+		{"title": []any{"a", "b"}},
+		{"tags": []any{"go", 1}},
+		{"published": "yesterday"},
+		{"title": 3.0},
+	}
+	for _, fields := range invalid {
+		if _, err := s.Parse(fields); !errors.Is(err, ErrInvalidDocument) {
+			t.Errorf("Parse(%v) = %v want ErrInvalidDocument", fields, err)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	s := testSchema(t)
+
+	testCase := []struct {
+		field, word, key string
+	}{
+		{DefaultField, "binary", "binary"},
+		{"title", "binary", "title:binary"},
+		{"tags", "c:b", "tags:c:b"},
+	}
+	for _, test := range testCase {
+		if got := s.Key(test.field, test.word); got != test.key {
+			t.Errorf("Key(%s, %s) = %s want %s", test.field, test.word, got, test.key)
+		}
+		if field, word := s.Split(test.key); field != test.field || word != test.word {
+			t.Errorf("Split(%s) = %s, %s want %s, %s", test.key, field, word, test.field, test.word)
+		}
+	}
+	if field, word := s.Split("author:jane"); field != DefaultField || word != "author:jane" {
+		t.Errorf("Split(author:jane) = %s, %s want %s, author:jane", field, word, DefaultField)
+	}
+
+	// a word of DefaultField never reads as the word of another field
+	mixed, err := New([]Field{{Name: DefaultField, Type: Text}, {Name: "title", Type: Text}})
+	if err != nil {
+		t.Fatalf("New() = %v want <nil>", err)
+	}
+	mixedCase := []struct {
+		field, word, key string
+	}{
+		{DefaultField, "foo", "foo"},
+		{DefaultField, "title:foo", "document:title:foo"},
+		{DefaultField, "document:foo", "document:document:foo"},
+		{DefaultField, "author:foo", "author:foo"},
+		{"title", "foo", "title:foo"},
+	}
+	for _, test := range mixedCase {
+		if got := mixed.Key(test.field, test.word); got != test.key {
+			t.Errorf("Key(%s, %s) = %s want %s", test.field, test.word, got, test.key)
+		}
+		if field, word := mixed.Split(test.key); field != test.field || word != test.word {
+			t.Errorf("Split(%s) = %s, %s want %s, %s", test.key, field, word, test.field, test.word)
+		}
+	}
+
+	// an index of plain text documents keeps its words as they are
+	if got := Default().Key(DefaultField, "document:foo"); got != "document:foo" {
+		t.Errorf("Key(%s, document:foo) = %s want document:foo", DefaultField, got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	declared := filepath.Join(dir, "declared.json")
+	if err := Save(declared, testSchema(t)); err != nil {
+		t.Fatalf("Save() = %v want <nil>", err)
+	}
+	path := filepath.Join(dir, "schema.json")
+
+	s, err := Load(path, declared)
+	if err != nil || !reflect.DeepEqual(s.Fields, testSchema(t).Fields) {
+		t.Fatalf("Load() = %v, %v want the declared schema", s, err)
+	}
+	// the stored schema wins over a new declaration
+	if s, err := Load(path, ""); err != nil || s.IsDefault() {
+		t.Errorf("Load() = %v, %v want the stored schema", s, err)
+	}
+	if s, err := Load(filepath.Join(dir, "plain.json"), ""); err != nil || !s.IsDefault() {
+		t.Errorf("Load() = %v, %v want Default()", s, err)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"searchengine/auth"
+	memorymapper "searchengine/memory_mapper"
+)
+
+// owner and visibility stored with a new document
+type Access struct {
+	Owner   string // name of the user indexing the document, "" for no owner
+	Private bool   // only the owner and admins find the document
+}
+
+var ErrForbidden = errors.New("document belongs to another user")
+
+// key of an owner name as stored in access.index, a zero Key for no owner
+func ownerKey(name string) memorymapper.Key {
+	if name == "" {
+		return memorymapper.Key{}
+	}
+	return memorymapper.WordKey(name)
+}
+
+// check if owner is the key of name, records of access.index version 1 have no check hash and match by hash alone
+func isOwner(owner memorymapper.Key, name string) bool {
+	key := ownerKey(name)
+	return owner.Hash != 0 && owner.Hash == key.Hash && (owner.Check == 0 || owner.Check == key.Check)
+}
+
+// check if user finds docId, admins find every document
+func (e *EngineService) visible(docId uint64, user auth.User) bool {
+	if user.IsAdmin() {
+		return true
+	}
+	owner, private := e.indexRepo.Access(docId)
+	return !private || isOwner(owner, user.Name)
+}
+
+// check if user may delete or replace docId, admins change every document, writers their own
+// a document user does not find is not found
+func (e *EngineService) checkOwner(docId uint64, user auth.User) error {
+	if !e.visible(docId, user) {
+		return ErrDocumentNotFound
+	}
+	if user.IsAdmin() {
+		return nil
+	}
+	owner, _ := e.indexRepo.Access(docId)
+	if !user.CanWrite() || !isOwner(owner, user.Name) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// matches user finds, in order
+func (e *EngineService) visibleMatches(matches []match, user auth.User) []match {
+	if user.IsAdmin() {
+		return matches
+	}
+	result := matches[:0]
+	for _, m := range matches {
+		if e.visible(m.docId, user) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// result of one document of a batch, DocId is 0 when Err is set
+type BatchItem struct {
+	DocId int64
+	Err   error
+}
+
+/**
+1. Check every document against the schema and analyze it, a document failing here fails alone
+2. Assign consecutive docIds to the other ones, log all of them in index.wal with one fsync
+3. Add the entries of each word in the batch to its posting list at once
+4. Store lengths, access and documents, clear index.wal
+a failure in 3-4 rolls back every docId of the batch, every document of it gets the error
+
+returns one item per document, in order
+**/
+
+func (e *EngineService) IndexBatch(ctx context.Context, batch []map[string]any, access Access) []BatchItem {
+	items := make([]BatchItem, len(batch))
+	docs := make([]preparedDocument, 0, len(batch))
+	positions := make([]int, 0, len(batch)) // index in batch of every prepared document
+	for i, fields := range batch {
+		doc, err := e.schema.Parse(fields)
+		if err != nil {
+			items[i].Err = err
+			continue
+		}
+		prepared, err := e.prepare(doc, ownerKey(access.Owner), access.Private)
+		if err != nil {
+			items[i].Err = err
+			continue
+		}
+		docs = append(docs, prepared)
+		positions = append(positions, i)
+	}
+	if len(docs) == 0 {
+		return items
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var docIds []int64
+	err := ErrClosed
+	if !e.closed {
+		docIds, err = e.indexPrepared(ctx, docs, 0)
+	}
+	if err != nil && !errors.Is(err, ErrClosed) {
+		slog.ErrorContext(ctx, "[batch.go]		[IndexBatch()]	", "documents", len(docs), "err", err)
+	}
+	for j, i := range positions {
+		if err != nil {
+			items[i].Err = err
+			continue
+		}
+		items[i].DocId = docIds[j]
+	}
+	return items
+}
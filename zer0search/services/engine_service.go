@@ -1,127 +1,598 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"searchengine/auth"
+	memorymapper "searchengine/memory_mapper"
+	"searchengine/metrics"
+	"searchengine/models"
+	"searchengine/query"
+	"searchengine/ranking"
 	"searchengine/repositories"
+	"searchengine/schema"
 	"searchengine/tokenizer"
 	"searchengine/utils"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // business logic, user repo
+// methods serving a request take its context, records they log carry its request ID
 
+// single writer, multiple readers
+// IndexDocument(), DeleteDocument(), UpdateDocument(), Compact(), Flush(), Snapshot(), Restore() and Close() hold Lock,
+// a write runs alone and a search never sees half of it
+// SearchDocument() holds RLock, searches run in parallel
+// index files lock their own mmap, so a remap never happens under a reader
+// background merges do not take the lock, a merged segment replaces its sources under the segments' lock
+// once Close() returns every method fails with ErrClosed, the index files can be closed under no reader
 type EngineService struct {
+	mu        sync.RWMutex
 	indexRepo *repositories.IndexRepo
-	docRepo   *repositories.DocumentRepo
-	hasher    *utils.Hash
+	docRepo   repositories.DocumentStore
+	analyzer  tokenizer.Analyzer // documents and queries are analyzed by the same chain
+	schema    *schema.Schema     // fields of the documents
+	ranker    *ranking.BM25
 	docId     int64
+	closed    bool
 }
 
-func NewEngineService(indexRepo *repositories.IndexRepo, docRepo *repositories.DocumentRepo, hasher *utils.Hash) *EngineService {
+func NewEngineService(indexRepo *repositories.IndexRepo, docRepo repositories.DocumentStore, analyzer tokenizer.Analyzer, schema *schema.Schema) *EngineService {
 	return &EngineService{
 		indexRepo: indexRepo,
 		docRepo:   docRepo,
-		hasher:    hasher,
+		analyzer:  analyzer,
+		schema:    schema,
+		ranker:    ranking.NewBM25(),
 		docId:     1,
 	}
 }
 
-/***
-1. Assign docId
-2. Tokenize the document
-3. for each word ::
-		- search in dict.index
-		- if presernt
-			- append docId storing at offset in post.index
-		- else
-			- append docId in post.index (at the last), store offset in dict.index
-4. Insert document to mysql database, (Todo -> store document in docs.dat)
+var (
+	ErrDocumentNotFound    = errors.New("document not found")
+	ErrNoWords             = errors.New("document not inserted, no words")
+	ErrSnapshotExists      = errors.New("snapshot path already exists")
+	ErrSnapshotUnsupported = errors.New("snapshot needs the embedded document store, back up mysql on its own")
+	ErrClosed              = errors.New("engine is closed")
+)
+
+/**
+1. Roll back docIds left in index.wal by a crash while indexing
+2. Get last docId from the document store
+3. Index the documents after the last flushed docId again into the buffer, a crash lost them
+4. Check the segments and the document store agree
+5. Add words missing from terms.index, analyzing the stored documents again
+6. Upgrade segments written by an older version
+7. Continue assigning docId after the last stored or deleted document
+
+Must be called before serving
 **/
 
-func (e *EngineService) IndexDocument(document string) error {
-	tokens := tokenizer.GetTokens(document)
-	var insertedFlag bool = false
-	for _, tok := range tokens.Tokens {
-		tokenHash := e.getHash(tok)
-		if err := e.indexRepo.Update(tokenHash, e.docId); err != nil {
-			slog.Error("[engine_service.go]		[IndexDocument()]	", err)
-			continue
-		}
-		insertedFlag = true
+func (e *EngineService) Restore(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrClosed
 	}
-	if !insertedFlag {
-		slog.Error("[engine_service.go]		[IndexDocument()]	document not inserted")
-		return errors.New("document not inserted")
+	if err := e.recover(ctx); err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[Restore()]	", "err", err)
+		return fmt.Errorf("rollback of interrupted insert failed : %w", err)
 	}
-
-	id, err := e.docRepo.Insert(document)
+	lastId, err := e.docRepo.LastId(ctx)
 	if err != nil {
-		slog.Error("[engine_service.go]		[IndexDocument()]	", err)
-		// (To-Do) Document is not stored in database, rollback to previous state
 		return err
 	}
-	e.docId = id + 1
+	if err := e.replay(ctx, lastId); err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[Restore()]	", "err", err)
+		return fmt.Errorf("replay of unflushed documents failed : %w", err)
+	}
+	if err := e.indexRepo.Verify(lastId); err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[Restore()]	", "err", err)
+		return fmt.Errorf("index does not match document store : %w", err)
+	}
+	if !e.indexRepo.TermsComplete() {
+		if err := e.rebuildTerms(ctx, lastId); err != nil {
+			slog.ErrorContext(ctx, "[engine_service.go]		[Restore()]	", "err", err)
+			return err
+		}
+	}
+	if err := e.indexRepo.Upgrade(); err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[Restore()]	", "err", err)
+		return err
+	}
+	e.docId = max(lastId, int64(e.indexRepo.LastDeleted())) + 1
 	return nil
 }
 
-/**
-1. Tokenize the document
-2. For each word ::
-	- search doct.index and get offset
-	- read post.index and get docId slice
-	- intersect docIds
-3. Retrive documents from mysql database
-
-To-do:
-	- ranking mechanism
-**/
+// roll back every docId logged in index.wal and not committed
+func (e *EngineService) recover(ctx context.Context) error {
+	pending, err := e.indexRepo.Pending()
+	if err != nil {
+		return err
+	}
+	for _, docId := range pending {
+		slog.InfoContext(ctx, "[engine_service.go]		[recover()]	rolling back interrupted insert", "docId", docId)
+		if err := e.rollback(ctx, docId); err != nil {
+			return err
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	return e.indexRepo.Commit(ctx, e.docRepo)
+}
 
-func (e *EngineService) SearchDocument(document string) []string {
-	tokens := tokenizer.GetTokens(document)
-	foundDocIds := make(map[uint64]struct{})
-	for _, tok := range tokens.Tokens {
-		tokenHash := e.getHash(tok)
-		tempSlice, err := e.indexRepo.GetDocIds(tokenHash)
+// the buffer is only in memory, index the stored documents after the last flushed docId again
+// the document store keeps them in docId order, so the buffer gets the same entries as before the crash
+func (e *EngineService) replay(ctx context.Context, lastId int64) error {
+	e.indexRepo.ClearBuffer()
+	replayed := 0
+	for docId := int64(e.indexRepo.Flushed()) + 1; docId <= lastId; docId++ {
+		if !e.indexRepo.Exists(uint64(docId)) {
+			continue
+		}
+		doc, err := e.document(ctx, docId)
+		if errors.Is(err, memorymapper.ErrDocumentNotFound) {
+			// a crash between deleting the body and its tombstone, finish the delete
+			slog.InfoContext(ctx, "[engine_service.go]		[replay()]	deleting docId without document", "docId", docId)
+			if err := e.indexRepo.Rollback(docId); err != nil {
+				return err
+			}
+			continue
+		}
 		if err != nil {
-			slog.Error("[engine_service.go]		[SearchDocument()]	", err)
+			return fmt.Errorf("docId %d : %w", docId, err)
+		}
+		words, positions, _ := e.documentWords(doc)
+		for _, word := range words {
+			if err := e.indexRepo.Replay(word, []memorymapper.PostingEntry{{
+				DocId:     uint64(docId),
+				Freq:      uint64(len(positions[word])),
+				Positions: positions[word],
+			}}); err != nil {
+				return err
+			}
+		}
+		replayed++
+	}
+	if replayed > 0 {
+		slog.InfoContext(ctx, "[engine_service.go]		[replay()]	unflushed documents indexed again", "documents", replayed)
+	}
+	return nil
+}
+
+// words of the segments are only stored as hashes, find their text in the stored documents
+func (e *EngineService) rebuildTerms(ctx context.Context, lastId int64) error {
+	known := make(map[string]struct{})
+	if err := e.indexRepo.Terms("", func(term string) bool {
+		known[term] = struct{}{}
+		return true
+	}); err != nil {
+		return err
+	}
+	added := 0
+	for docId := int64(1); docId <= lastId; docId++ {
+		if !e.indexRepo.Exists(uint64(docId)) {
 			continue
 		}
-		// AND operation (intersection) on tempSlice and foundDocIds
-		if len(tempSlice) == 0 {
+		doc, err := e.document(ctx, docId)
+		if err != nil {
 			continue
 		}
+		words, _, _ := e.documentWords(doc)
+		for _, word := range words {
+			if _, ok := known[word]; ok || !e.indexRepo.HasWord(word) {
+				continue
+			}
+			if err := e.indexRepo.AddTerm(word); err != nil {
+				return err
+			}
+			known[word] = struct{}{}
+			added++
+		}
+	}
+	slog.InfoContext(ctx, "[engine_service.go]		[rebuildTerms()]	terms.index rebuilt", "added", added)
+	return nil
+}
+
+// hide every part of docId already written, the document store first so a search never returns it
+// a request cancelled while writing still rolls back
+func (e *EngineService) rollback(ctx context.Context, docId int64) error {
+	if err := e.docRepo.DeleteAt(context.WithoutCancel(ctx), int(docId)); err != nil {
+		return err
+	}
+	return e.indexRepo.Rollback(docId)
+}
+
+/***
+1. Assign docId, log it in index.wal
+2. Analyze every field of the document, collect the token positions of each word of each field
+3. for each word ::
+		- append [docId][freq][positions] to its posting list in the in-memory buffer
+		- a word new to the buffer and every segment is added to terms.index
+4. Store document length in norms.index, its owner and visibility in access.index
+5. Insert document to the document store (docs.dat or mysql) under docId, JSON unless it is plain text
+6. Clear index.wal, the document is committed, a full buffer is flushed as a new segment
 
-		if len(foundDocIds) == 0 {
-			for _, docId := range tempSlice {
-				foundDocIds[docId] = struct{}{}
+a failure in 3-6 rolls docId back: it is tombstoned and removed from the document store,
+a crash in 3-6 leaves docId in index.wal and Restore() rolls it back
+docIds are never reused, so a rolled back docId only leaves dead posting entries
+IndexBatch() writes many documents the same way
+
+returns docId of the document
+**/
+
+// index a public plain text document without owner, the text of schema.DefaultField
+func (e *EngineService) IndexDocument(ctx context.Context, document string) (int64, error) {
+	return e.IndexFields(ctx, map[string]any{schema.DefaultField: document}, Access{})
+}
+
+// index a JSON document owned by access.Owner, fields are checked against the schema
+func (e *EngineService) IndexFields(ctx context.Context, fields map[string]any, access Access) (int64, error) {
+	doc, err := e.schema.Parse(fields)
+	if err != nil {
+		return 0, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return 0, ErrClosed
+	}
+	return e.indexDocument(ctx, doc, ownerKey(access.Owner), access.Private, 0)
+}
+
+// a replaced docId above 0 is deleted in the same transaction
+func (e *EngineService) indexDocument(ctx context.Context, doc schema.Document, owner memorymapper.Key, private bool, replaced int64) (int64, error) {
+	prepared, err := e.prepare(doc, owner, private)
+	if err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[IndexDocument()]	", "err", err)
+		return 0, err
+	}
+	docIds, err := e.indexPrepared(ctx, []preparedDocument{prepared}, replaced)
+	if err != nil {
+		return 0, err
+	}
+	return docIds[0], nil
+}
+
+// analyzed document, ready to be written
+type preparedDocument struct {
+	document  string // as saved in the document store
+	words     []string
+	positions map[string][]uint64
+	length    uint64
+	owner     memorymapper.Key // key of the owner name, a zero Key for no owner
+	private   bool
+}
+
+func (e *EngineService) prepare(doc schema.Document, owner memorymapper.Key, private bool) (preparedDocument, error) {
+	words, positions, length := e.documentWords(doc)
+	if len(words) == 0 {
+		return preparedDocument{}, ErrNoWords
+	}
+	document, err := e.schema.Encode(doc)
+	if err != nil {
+		return preparedDocument{}, err
+	}
+	return preparedDocument{document: document, words: words, positions: positions, length: length, owner: owner, private: private}, nil
+}
+
+// assign consecutive docIds to docs and write them, all of them or none
+// a replaced docId above 0 is deleted once docs are committed, docs are rolled back if it can not be
+// a crash before the delete keeps both docIds, never neither
+func (e *EngineService) indexPrepared(ctx context.Context, docs []preparedDocument, replaced int64) ([]int64, error) {
+	defer prometheus.NewTimer(metrics.IndexDuration).ObserveDuration()
+	docIds := make([]int64, len(docs))
+	for i := range docs {
+		docIds[i] = e.docId + int64(i)
+	}
+	if err := e.indexRepo.Begin(docIds...); err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[IndexDocument()]	", "err", err)
+		return nil, err
+	}
+	// docIds below e.docId are visible to searches, docIds are committed or rolled back when it moves
+	defer func() { e.docId += int64(len(docs)) }()
+	err := e.insert(ctx, docIds, docs)
+	if err == nil {
+		err = e.indexRepo.Commit(ctx, e.docRepo)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[IndexDocument()]	", "docIds", docIds, "err", err)
+		for _, docId := range docIds {
+			if rollbackErr := e.rollback(ctx, docId); rollbackErr != nil {
+				// docIds stay in index.wal, Restore() rolls them back
+				slog.ErrorContext(ctx, "[engine_service.go]		[IndexDocument()]	rollback failed", "docId", docId, "err", rollbackErr)
+				return nil, errors.Join(err, rollbackErr)
 			}
-			continue
 		}
-		commonDocId := make(map[uint64]struct{}, 0)
-		for _, docId := range tempSlice {
-			if _, ok := foundDocIds[docId]; ok {
-				commonDocId[docId] = struct{}{}
+		if commitErr := e.indexRepo.Commit(ctx, e.docRepo); commitErr != nil {
+			slog.ErrorContext(ctx, "[engine_service.go]		[IndexDocument()]	", "err", commitErr)
+		}
+		return nil, err
+	}
+	if replaced > 0 {
+		if err := e.deleteDocument(ctx, replaced); err != nil {
+			slog.ErrorContext(ctx, "[engine_service.go]		[IndexDocument()]	", "replaced", replaced, "err", err)
+			// the committed docIds are hidden again, the document keeps its old docId
+			for _, docId := range docIds {
+				if rollbackErr := e.rollback(ctx, docId); rollbackErr != nil {
+					slog.ErrorContext(ctx, "[engine_service.go]		[IndexDocument()]	rollback failed", "docId", docId, "err", rollbackErr)
+					return nil, errors.Join(err, rollbackErr)
+				}
 			}
+			return nil, err
 		}
-		foundDocIds, commonDocId = commonDocId, foundDocIds
 	}
+	metrics.DocumentsIndexed.Add(float64(len(docIds)))
+	return docIds, nil
+}
 
-	result := make([]string, 0, len(foundDocIds))
-	for docId := range foundDocIds {
-		// Search from MySql
-		document, err := e.docRepo.Query(int(docId))
+// write every part of docIds, stops at the first failure, the caller commits
+// the entries of a word in every document are added to its posting list at once
+func (e *EngineService) insert(ctx context.Context, docIds []int64, docs []preparedDocument) error {
+	words := make([]string, 0)
+	entries := make(map[string][]memorymapper.PostingEntry)
+	for i, doc := range docs {
+		for _, word := range doc.words {
+			if _, ok := entries[word]; !ok {
+				words = append(words, word)
+			}
+			entries[word] = append(entries[word], memorymapper.PostingEntry{
+				DocId:     uint64(docIds[i]),
+				Freq:      uint64(len(doc.positions[word])),
+				Positions: doc.positions[word],
+			})
+		}
+	}
+	for _, word := range words {
+		if err := e.indexRepo.UpdateMany(word, entries[word]); err != nil {
+			return err
+		}
+	}
+	for i, doc := range docs {
+		if err := e.indexRepo.SetLength(docIds[i], doc.length); err != nil {
+			return err
+		}
+		if err := e.indexRepo.SetAccess(docIds[i], doc.owner, doc.private); err != nil {
+			return err
+		}
+		if err := e.docRepo.Insert(ctx, docIds[i], doc.document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+1. Check docId is indexed and not deleted, and user owns it or is an admin
+2. Mark docId in tombstones.index, searches skip it from now on
+3. Delete document from the document store, a failure only leaves an unread body
+4. A merge of its segment drops its postings later
+**/
+
+func (e *EngineService) DeleteDocument(ctx context.Context, docId int64, user auth.User) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrClosed
+	}
+	if !e.exists(docId) {
+		return ErrDocumentNotFound
+	}
+	if err := e.checkOwner(uint64(docId), user); err != nil {
+		return err
+	}
+	return e.deleteDocument(ctx, docId)
+}
+
+// check if docId is indexed and not deleted, docIds from e.docId on are not assigned yet
+func (e *EngineService) exists(docId int64) bool {
+	return docId > 0 && docId < e.docId && e.indexRepo.Exists(uint64(docId))
+}
+
+func (e *EngineService) deleteDocument(ctx context.Context, docId int64) error {
+	if !e.exists(docId) {
+		return ErrDocumentNotFound
+	}
+	deleted, err := e.indexRepo.Delete(uint64(docId))
+	if err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[DeleteDocument()]	", "docId", docId, "err", err)
+		return err
+	}
+	if !deleted {
+		return ErrDocumentNotFound
+	}
+	metrics.DocumentsDeleted.Inc()
+	// docId is deleted once tombstoned, a body left by a failure is never read again
+	if err := e.docRepo.DeleteAt(ctx, int(docId)); err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[DeleteDocument()]	document left in the store", "docId", docId, "err", err)
+	}
+	return nil
+}
+
+/**
+posting lists only grow at the end with increasing docIds, a document can not be indexed again under its docId
+
+1. Check docId is indexed and not deleted, and user owns it or is an admin
+2. Index document under a new docId, with the owner and visibility of docId
+3. Delete the old docId once the new docId is committed,
+   a failure rolls the new docId back and the document keeps its old docId,
+   a crash before the delete leaves both docIds
+
+returns the new docId of the document
+**/
+
+// replace docId with a plain text document
+func (e *EngineService) UpdateDocument(ctx context.Context, docId int64, document string, user auth.User) (int64, error) {
+	return e.UpdateFields(ctx, docId, map[string]any{schema.DefaultField: document}, user)
+}
+
+// replace docId with a JSON document
+func (e *EngineService) UpdateFields(ctx context.Context, docId int64, fields map[string]any, user auth.User) (int64, error) {
+	doc, err := e.schema.Parse(fields)
+	if err != nil {
+		return 0, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return 0, ErrClosed
+	}
+	if !e.exists(docId) {
+		return 0, ErrDocumentNotFound
+	}
+	if err := e.checkOwner(uint64(docId), user); err != nil {
+		return 0, err
+	}
+	owner, private := e.indexRepo.Access(uint64(docId))
+	return e.indexDocument(ctx, doc, owner, private, docId)
+}
+
+/**
+1. Parse the query into terms, "quoted phrases"~slop, field:queries, AND, OR, NOT and (groups)
+2. For each term and phrase, in its field or else in every text field ::
+	- tokenize, read [docId][freq][positions] of the word from every segment and the buffer
+	- add the word's BM25 score times the field boost to every docId
+	- a phrase keeps docIds where the word positions match
+3. Merge the sorted docIds, AND intersects, OR unions, NOT subtracts
+	- a term without docIds makes an AND match nothing
+	- keep the docIds opts.User finds, public ones and its own, every docId for an admin
+4. Sort docIds by score, keep the page from opts.Offset to opts.Offset + opts.Limit
+5. Retrive documents of the page from the document store
+6. Cut a snippet around the query words of the text field with most of them
+7. Return the stored fields
+**/
+
+func (e *EngineService) SearchDocument(ctx context.Context, text string, opts SearchOptions) (models.SearchResult, error) {
+	defer prometheus.NewTimer(metrics.SearchDuration).ObserveDuration()
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return models.SearchResult{}, ErrClosed
+	}
+	node, err := query.Parse(text)
+	if err != nil {
+		return models.SearchResult{}, err
+	}
+	if err := e.checkFields(node); err != nil {
+		return models.SearchResult{}, err
+	}
+	v := e.newEvaluator(ctx)
+	matches, _ := v.eval(node)
+	matches = e.visibleMatches(matches, opts.User)
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].docId < matches[j].docId
+	})
+
+	result := models.SearchResult{
+		Total:     len(matches),
+		Offset:    opts.Offset,
+		Limit:     opts.Limit,
+		Documents: make([]models.Document, 0, opts.Limit),
+	}
+	start := min(max(opts.Offset, 0), len(matches))
+	end := min(start+max(opts.Limit, 0), len(matches))
+	for _, m := range matches[start:end] {
+		// Search from the document store
+		doc, err := e.document(ctx, int64(m.docId))
 		if err != nil {
-			slog.Error("[engine_service.go]		[SearchDocument()]	", err)
+			slog.ErrorContext(ctx, "[engine_service.go]		[SearchDocument()]	", "docId", m.docId, "err", err)
 			continue
 		}
-		result = append(result, document)
+		result.Documents = append(result.Documents, models.Document{
+			DocId:   int64(m.docId),
+			Snippet: e.bestSnippet(doc, v.highlighted, opts),
+			Score:   m.score,
+			Fields:  e.schema.Stored(doc),
+		})
+	}
+	return result, nil
+}
+
+// flush the buffer and merge every segment into one, reclaiming the postings of deleted documents
+func (e *EngineService) Compact(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrClosed
+	}
+	if err := e.indexRepo.Compact(); err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[Compact()]	", "err", err)
+		return err
+	}
+	return nil
+}
+
+// write the buffer as a segment, so a restart does not index its documents again
+func (e *EngineService) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrClosed
 	}
-	return result
+	if err := e.indexRepo.Flush(); err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[Flush()]	", "err", err)
+		return err
+	}
+	return nil
 }
 
-func (e *EngineService) getHash(word string) uint64 {
-	e.hasher.WriteString(word)
-	wordHash := e.hasher.Sum()
-	e.hasher.Reset()
-	return wordHash
+// wait for the running writes and searches, flush the buffer as a segment and refuse every later call
+// the buffer is only in memory, a failed flush leaves its documents to Restore() after the restart
+func (e *EngineService) Close(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	if err := e.indexRepo.Flush(); err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[Close()]	", "err", err)
+		return err
+	}
+	return nil
+}
+
+/**
+1. Flush the buffer, every document is in a segment
+2. Copy the segments, norms, tombstones, terms, the document store, the analyzer config and the schema to dest
+writes and searches wait until the copy is done, segment files are hard linked into a directory snapshot
+
+dest is a new directory, or a gzip tarball when it ends in .tar.gz or .tgz
+**/
+
+func (e *EngineService) Snapshot(ctx context.Context, dest string) (memorymapper.SnapshotInfo, error) {
+	if _, ok := e.docRepo.(*repositories.FileDocumentRepo); !ok {
+		return memorymapper.SnapshotInfo{}, ErrSnapshotUnsupported
+	}
+	if utils.FileExists(dest) {
+		return memorymapper.SnapshotInfo{}, ErrSnapshotExists
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return memorymapper.SnapshotInfo{}, ErrClosed
+	}
+	if err := e.indexRepo.Flush(); err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[Snapshot()]	", "err", err)
+		return memorymapper.SnapshotInfo{}, err
+	}
+	lastId, err := e.docRepo.LastId(ctx)
+	if err != nil {
+		return memorymapper.SnapshotInfo{}, err
+	}
+	info, err := e.indexRepo.Snapshot(dest, lastId)
+	if err != nil {
+		slog.ErrorContext(ctx, "[engine_service.go]		[Snapshot()]	", "dest", dest, "err", err)
+		return info, err
+	}
+	return info, nil
 }
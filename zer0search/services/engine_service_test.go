@@ -0,0 +1,630 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"searchengine/auth"
+	memorymapper "searchengine/memory_mapper"
+	"searchengine/query"
+	"searchengine/repositories"
+	"searchengine/schema"
+	"searchengine/tokenizer"
+	"testing"
+)
+
+// engine over index files and an embedded document store in an empty directory
+func newTestEngine(t *testing.T) *EngineService {
+	t.Helper()
+	return newSchemaEngine(t, testOptions(t), schema.Default())
+}
+
+// options with an empty directory for the index files
+func testOptions(t *testing.T) memorymapper.Options {
+	t.Helper()
+	return memorymapper.DefaultOptions(t.TempDir())
+}
+
+// engine of documents with the fields of s
+func newSchemaEngine(t *testing.T, opts memorymapper.Options, s *schema.Schema) *EngineService {
+	t.Helper()
+	engine, _ := newWALEngine(t, opts, s)
+	return engine
+}
+
+// engine of documents with the fields of s and its index.wal, closed by a test to make commits fail
+func newWALEngine(t *testing.T, opts memorymapper.Options, s *schema.Schema) (*EngineService, *memorymapper.WAL) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(opts.Dir, "memory_mapper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := memorymapper.NewSegments(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	norms, err := memorymapper.NewNorms(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tombstones, err := memorymapper.NewTombstones(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := memorymapper.NewDocuments(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal, err := memorymapper.NewWAL(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	terms, err := memorymapper.NewTerms(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := memorymapper.NewAccess(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		segments.Close()
+		norms.Close()
+		tombstones.Close()
+		docs.Close()
+		wal.Close()
+		terms.Close()
+		access.Close()
+	})
+
+	indexRepo := repositories.NewIndexRepo(segments, norms, tombstones, wal, terms, access)
+	analyzer, err := tokenizer.Named("english")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngineService(indexRepo, repositories.NewFileDocumentRepo(docs), analyzer, s)
+	if err := engine.Restore(context.Background()); err != nil {
+		t.Fatalf("Restore() = %v want <nil>", err)
+	}
+	return engine, wal
+}
+
+// documents found by text, in ranked order
+func search(t *testing.T, engine *EngineService, text string) []string {
+	t.Helper()
+	result, err := engine.SearchDocument(context.Background(), text, SearchOptions{Limit: 100, SnippetSize: 100})
+	if err != nil {
+		t.Fatalf("SearchDocument(%s) = %v want <nil>", text, err)
+	}
+	documents := make([]string, 0, len(result.Documents))
+	for _, document := range result.Documents {
+		documents = append(documents, document.Snippet)
+	}
+	return documents
+}
+
+func TestSearchDocument(t *testing.T) {
+	engine := newTestEngine(t)
+	for _, document := range []string{"the quick brown fox", "the lazy brown dog", "quick dog"} {
+		if _, err := engine.IndexDocument(context.Background(), document); err != nil {
+			t.Fatalf("IndexDocument(%s) = %v want <nil>", document, err)
+		}
+	}
+
+	testCase := []struct {
+		query string
+		want  int
+	}{
+		{"brown", 2},
+		{"quick AND dog", 1},
+		{"quick OR lazy", 3},
+		{"brown -fox", 1},
+		{"NOT brown", 1},
+		{`"brown fox"`, 1},
+		{`"quick fox"~1`, 1},
+		{"(fox OR dog) AND quick", 2},
+		{"quick AND missing", 0},
+		{"qui*", 2},
+		{"br*n", 2},
+		{"d?g -lazy", 1},
+		{"brwn~1", 2},
+		{"quack~1", 2},
+		{"quack~0", 0},
+	}
+	for _, test := range testCase {
+		if got := search(t, engine, test.query); len(got) != test.want {
+			t.Errorf("SearchDocument(%s) = %v want %d documents", test.query, got, test.want)
+		}
+	}
+
+	var syntaxErr *query.SyntaxError
+	if _, err := engine.SearchDocument(context.Background(), "quick AND (dog", SearchOptions{}); !errors.As(err, &syntaxErr) {
+		t.Errorf("SearchDocument(quick AND (dog) = %v want *query.SyntaxError", err)
+	}
+}
+
+func TestAnalyzedSearch(t *testing.T) {
+	engine := newTestEngine(t)
+	for _, document := range []string{"State of the art engines", "The runner keeps running", "Crème brûlée"} {
+		if _, err := engine.IndexDocument(context.Background(), document); err != nil {
+			t.Fatalf("IndexDocument(%s) = %v want <nil>", document, err)
+		}
+	}
+
+	testCase := []struct {
+		query string
+		want  int
+	}{
+		{"runs", 1},
+		{"ENGINE", 1},
+		{"creme", 1},
+		{`"state of the art"`, 1},
+		{`"state art"`, 0},
+		{`"state art"~2`, 1},
+		{"the", 0},
+	}
+	for _, test := range testCase {
+		if got := search(t, engine, test.query); len(got) != test.want {
+			t.Errorf("SearchDocument(%s) = %v want %d documents", test.query, got, test.want)
+		}
+	}
+}
+
+func TestDeleteUpdateDocument(t *testing.T) {
+	engine := newTestEngine(t)
+	first, _ := engine.IndexDocument(context.Background(), "red apple")
+	second, _ := engine.IndexDocument(context.Background(), "green apple")
+
+	if err := engine.DeleteDocument(context.Background(), first, auth.NoAuth); err != nil {
+		t.Fatalf("DeleteDocument(%d) = %v want <nil>", first, err)
+	}
+	if err := engine.DeleteDocument(context.Background(), first, auth.NoAuth); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("DeleteDocument(%d) = %v want %v", first, err, ErrDocumentNotFound)
+	}
+	if got := search(t, engine, "apple"); len(got) != 1 || got[0] != "green apple" {
+		t.Errorf("SearchDocument(apple) = %v want [green apple]", got)
+	}
+
+	third, err := engine.UpdateDocument(context.Background(), second, "yellow banana", auth.NoAuth)
+	if err != nil || third <= second {
+		t.Fatalf("UpdateDocument(%d) = %d, %v want new docId, <nil>", second, third, err)
+	}
+	if got := search(t, engine, "apple"); len(got) != 0 {
+		t.Errorf("SearchDocument(apple) = %v want []", got)
+	}
+	if got := search(t, engine, "banana"); len(got) != 1 {
+		t.Errorf("SearchDocument(banana) = %v want [yellow banana]", got)
+	}
+	if _, err := engine.UpdateDocument(context.Background(), first, "deleted", auth.NoAuth); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("UpdateDocument(%d) = %v want %v", first, err, ErrDocumentNotFound)
+	}
+
+	// deleted docIds are dropped from posting.index
+	if err := engine.Compact(context.Background()); err != nil {
+		t.Fatalf("Compact() = %v want <nil>", err)
+	}
+	if got := search(t, engine, "banana OR apple"); len(got) != 1 {
+		t.Errorf("SearchDocument(banana OR apple) = %v want [yellow banana]", got)
+	}
+}
+
+// document store failing every insert
+type failingStore struct {
+	repositories.DocumentStore
+}
+
+func (f failingStore) Insert(ctx context.Context, docId int64, document string) error {
+	return errors.New("insert failed")
+}
+
+func TestIndexDocumentRollback(t *testing.T) {
+	engine := newTestEngine(t)
+	if _, err := engine.IndexDocument(context.Background(), "stored apple"); err != nil {
+		t.Fatalf("IndexDocument() = %v want <nil>", err)
+	}
+
+	store := engine.docRepo
+	engine.docRepo = failingStore{store}
+	if _, err := engine.IndexDocument(context.Background(), "lost apple"); err == nil {
+		t.Fatalf("IndexDocument() = <nil> want error")
+	}
+	engine.docRepo = store
+	if got := search(t, engine, "apple"); len(got) != 1 || got[0] != "stored apple" {
+		t.Errorf("SearchDocument(apple) = %v want [stored apple]", got)
+	}
+	if got := search(t, engine, "lost"); len(got) != 0 {
+		t.Errorf("SearchDocument(lost) = %v want []", got)
+	}
+
+	// crash after the document is stored and before index.wal is cleared
+	docId := engine.docId
+	if err := engine.indexRepo.Begin(docId); err != nil {
+		t.Fatalf("Begin(%d) = %v want <nil>", docId, err)
+	}
+	engine.indexRepo.UpdateMany("crashed", []memorymapper.PostingEntry{{DocId: uint64(docId), Freq: 1, Positions: []uint64{0}}})
+	engine.indexRepo.SetLength(docId, 1)
+	engine.docRepo.Insert(context.Background(), docId, "crashed")
+
+	if err := engine.Restore(context.Background()); err != nil {
+		t.Fatalf("Restore() = %v want <nil>", err)
+	}
+	if engine.docId <= docId {
+		t.Errorf("Restore() docId = %d want > %d, rolled back docIds are not reused", engine.docId, docId)
+	}
+	if got := search(t, engine, "crashed"); len(got) != 0 {
+		t.Errorf("SearchDocument(crashed) = %v want []", got)
+	}
+	if _, err := engine.docRepo.Query(context.Background(), int(docId)); err == nil {
+		t.Errorf("Query(%d) = <nil> want error for a rolled back document", docId)
+	}
+	if pending, _ := engine.indexRepo.Pending(); len(pending) != 0 {
+		t.Errorf("Pending() = %v want []", pending)
+	}
+}
+
+// document store failing to delete one docId
+type undeletableStore struct {
+	repositories.DocumentStore
+	docId int
+}
+
+func (u undeletableStore) DeleteAt(ctx context.Context, docId int) error {
+	if docId == u.docId {
+		return errors.New("delete failed")
+	}
+	return u.DocumentStore.DeleteAt(ctx, docId)
+}
+
+func TestUpdateDocumentOrphanBody(t *testing.T) {
+	engine := newTestEngine(t)
+	docId, err := engine.IndexDocument(context.Background(), "old apple")
+	if err != nil {
+		t.Fatalf("IndexDocument() = %v want <nil>", err)
+	}
+
+	store := engine.docRepo
+	engine.docRepo = undeletableStore{store, int(docId)}
+	if _, err := engine.UpdateDocument(context.Background(), docId, "new apple", auth.NoAuth); err != nil {
+		t.Fatalf("UpdateDocument(%d) = %v want <nil>", docId, err)
+	}
+	engine.docRepo = store
+	// the old docId is tombstoned, its body left in the store is never read again
+	if got := search(t, engine, "apple"); len(got) != 1 || got[0] != "new apple" {
+		t.Errorf("SearchDocument(apple) = %v want [new apple]", got)
+	}
+	if pending, _ := engine.indexRepo.Pending(); len(pending) != 0 {
+		t.Errorf("Pending() = %v want []", pending)
+	}
+}
+
+func TestRestoreMissingDocument(t *testing.T) {
+	engine := newTestEngine(t)
+	docId, err := engine.IndexDocument(context.Background(), "lost apple")
+	if err != nil {
+		t.Fatalf("IndexDocument() = %v want <nil>", err)
+	}
+	if _, err := engine.IndexDocument(context.Background(), "kept apple"); err != nil {
+		t.Fatalf("IndexDocument() = %v want <nil>", err)
+	}
+
+	// a crash between removing the body and writing its tombstone
+	if err := engine.docRepo.DeleteAt(context.Background(), int(docId)); err != nil {
+		t.Fatalf("DeleteAt(%d) = %v want <nil>", docId, err)
+	}
+	if err := engine.Restore(context.Background()); err != nil {
+		t.Fatalf("Restore() = %v want <nil>", err)
+	}
+	if got := search(t, engine, "apple"); len(got) != 1 || got[0] != "kept apple" {
+		t.Errorf("SearchDocument(apple) = %v want [kept apple]", got)
+	}
+	if err := engine.DeleteDocument(context.Background(), docId, auth.NoAuth); err != ErrDocumentNotFound {
+		t.Errorf("DeleteDocument(%d) = %v want %v", docId, err, ErrDocumentNotFound)
+	}
+}
+
+// document store whose writes never become durable
+type unsyncedStore struct {
+	repositories.DocumentStore
+}
+
+func (u unsyncedStore) Sync(ctx context.Context) error {
+	return errors.New("sync failed")
+}
+
+func TestIndexDocumentSyncFailure(t *testing.T) {
+	engine := newTestEngine(t)
+	store := engine.docRepo
+	engine.docRepo = unsyncedStore{store}
+	if _, err := engine.IndexDocument(context.Background(), "unsynced apple"); err == nil {
+		t.Fatalf("IndexDocument() = <nil> want error")
+	}
+	// index.wal is not cleared before the document is durable
+	if pending, _ := engine.indexRepo.Pending(); len(pending) != 1 {
+		t.Errorf("Pending() = %v want one docId", pending)
+	}
+
+	engine.docRepo = store
+	if err := engine.Restore(context.Background()); err != nil {
+		t.Fatalf("Restore() = %v want <nil>", err)
+	}
+	if got := search(t, engine, "apple"); len(got) != 0 {
+		t.Errorf("SearchDocument(apple) = %v want []", got)
+	}
+	if pending, _ := engine.indexRepo.Pending(); len(pending) != 0 {
+		t.Errorf("Pending() = %v want []", pending)
+	}
+}
+
+// document store running after every insert, before the commit
+type hookedStore struct {
+	repositories.DocumentStore
+	afterInsert func()
+}
+
+func (h hookedStore) Insert(ctx context.Context, docId int64, document string) error {
+	if err := h.DocumentStore.Insert(ctx, docId, document); err != nil {
+		return err
+	}
+	h.afterInsert()
+	return nil
+}
+
+func TestUpdateDocumentCommitFailure(t *testing.T) {
+	engine, wal := newWALEngine(t, testOptions(t), schema.Default())
+	docId, err := engine.IndexDocument(context.Background(), "old apple")
+	if err != nil {
+		t.Fatalf("IndexDocument() = %v want <nil>", err)
+	}
+
+	// index.wal can not be cleared, the new docId is never committed
+	engine.docRepo = hookedStore{engine.docRepo, func() { wal.Close() }}
+	if _, err := engine.UpdateDocument(context.Background(), docId, "new apple", auth.NoAuth); err == nil {
+		t.Fatalf("UpdateDocument(%d) = <nil> want error", docId)
+	}
+	if got := search(t, engine, "apple"); len(got) != 1 || got[0] != "old apple" {
+		t.Errorf("SearchDocument(apple) = %v want [old apple]", got)
+	}
+	if _, err := engine.docRepo.Query(context.Background(), int(docId)); err != nil {
+		t.Errorf("Query(%d) = %v want the old document", docId, err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	engine := newTestEngine(t)
+	if _, err := engine.IndexDocument(context.Background(), "buffered apple"); err != nil {
+		t.Fatalf("IndexDocument() = %v want <nil>", err)
+	}
+	if err := engine.Close(context.Background()); err != nil {
+		t.Fatalf("Close() = %v want <nil>", err)
+	}
+	// the buffer is written as a segment, a restart does not index it again
+	if got := len(engine.indexRepo.Segments()); got != 1 {
+		t.Errorf("Close() segments = %d want 1", got)
+	}
+	if err := engine.Close(context.Background()); err != nil {
+		t.Errorf("Close() again = %v want <nil>", err)
+	}
+
+	if _, err := engine.IndexDocument(context.Background(), "late apple"); !errors.Is(err, ErrClosed) {
+		t.Errorf("IndexDocument() after Close() = %v want %v", err, ErrClosed)
+	}
+	if _, err := engine.SearchDocument(context.Background(), "apple", SearchOptions{Limit: 10}); !errors.Is(err, ErrClosed) {
+		t.Errorf("SearchDocument() after Close() = %v want %v", err, ErrClosed)
+	}
+	if err := engine.DeleteDocument(context.Background(), 1, auth.NoAuth); !errors.Is(err, ErrClosed) {
+		t.Errorf("DeleteDocument() after Close() = %v want %v", err, ErrClosed)
+	}
+	items := engine.IndexBatch(context.Background(), []map[string]any{{"document": "late pear"}}, Access{})
+	if !errors.Is(items[0].Err, ErrClosed) {
+		t.Errorf("IndexBatch() after Close() = %v want %v", items[0].Err, ErrClosed)
+	}
+}
+
+func TestSegmentFlush(t *testing.T) {
+	opts := testOptions(t)
+	opts.FlushDocs = 2
+	engine := newSchemaEngine(t, opts, schema.Default())
+	for _, document := range []string{"quick brown fox", "lazy brown dog", "quick brown dog", "brown bear"} {
+		if _, err := engine.IndexDocument(context.Background(), document); err != nil {
+			t.Fatalf("IndexDocument(%s) = %v want <nil>", document, err)
+		}
+	}
+	if got := len(engine.indexRepo.Segments()); got != 2 {
+		t.Fatalf("Segments() = %d want 2, a segment every 2 documents", got)
+	}
+	engine.IndexDocument(context.Background(), "brown quick fox")
+	engine.DeleteDocument(context.Background(), 2, auth.NoAuth)
+
+	testCase := []struct {
+		query string
+		want  int
+	}{
+		{"brown", 4},
+		{`"quick brown"`, 2},
+		{"quick AND fox", 2},
+		{"dog", 1},
+	}
+	check := func() {
+		t.Helper()
+		for _, test := range testCase {
+			if got := search(t, engine, test.query); len(got) != test.want {
+				t.Errorf("SearchDocument(%s) = %v want %d documents", test.query, got, test.want)
+			}
+		}
+	}
+	check()
+
+	// a restart loses the buffer, the document after the last flushed docId is indexed again
+	if err := engine.Restore(context.Background()); err != nil {
+		t.Fatalf("Restore() = %v want <nil>", err)
+	}
+	check()
+
+	if err := engine.Compact(context.Background()); err != nil {
+		t.Fatalf("Compact() = %v want <nil>", err)
+	}
+	if segments := engine.indexRepo.Segments(); len(segments) != 1 || segments[0].MaxDocId != 5 {
+		t.Errorf("Segments() = %v want one segment up to docId 5", segments)
+	}
+	check()
+}
+
+func TestSearchPage(t *testing.T) {
+	engine := newTestEngine(t)
+	for i := 0; i < 5; i++ {
+		engine.IndexDocument(context.Background(), fmt.Sprintf("page %d", i))
+	}
+
+	result, err := engine.SearchDocument(context.Background(), "page", SearchOptions{Limit: 2, Offset: 3})
+	if err != nil {
+		t.Fatalf("SearchDocument(page) = %v want <nil>", err)
+	}
+	if result.Total != 5 || len(result.Documents) != 2 {
+		t.Fatalf("SearchDocument(page) = %d of %d documents want 2 of 5", len(result.Documents), result.Total)
+	}
+	// equal scores are ordered by docId
+	if result.Documents[0].DocId != 4 || result.Documents[1].DocId != 5 {
+		t.Errorf("SearchDocument(page) docIds = %d, %d want 4, 5", result.Documents[0].DocId, result.Documents[1].DocId)
+	}
+	if result, _ := engine.SearchDocument(context.Background(), "page", SearchOptions{Limit: 2, Offset: 10}); len(result.Documents) != 0 {
+		t.Errorf("SearchDocument(page) = %v want no documents after the last page", result.Documents)
+	}
+}
+
+func TestPhraseSeek(t *testing.T) {
+	defer func(interval uint64) { memorymapper.SkipInterval = interval }(memorymapper.SkipInterval)
+	memorymapper.SkipInterval = 4
+	engine := newTestEngine(t)
+	for i := 1; i <= 100; i++ {
+		document := fmt.Sprintf("brown %d", i)
+		if i%25 == 0 {
+			document = "quick brown fox"
+		} else if i%10 == 0 {
+			document = "quick red brown"
+		}
+		engine.IndexDocument(context.Background(), document)
+	}
+
+	// quick is read whole, brown only at its docIds
+	if got := search(t, engine, `"quick brown"`); len(got) != 4 {
+		t.Errorf("SearchDocument(\"quick brown\") = %v want 4 documents", got)
+	}
+	if got := search(t, engine, `"quick brown"~2`); len(got) != 4+8 {
+		t.Errorf("SearchDocument(\"quick brown\"~2) = %v want 12 documents", got)
+	}
+}
+
+func TestSearchFields(t *testing.T) {
+	s, err := schema.New([]schema.Field{
+		{Name: "title", Type: schema.Text, Boost: 3, Stored: true},
+		{Name: "body", Type: schema.Text, Stored: true},
+		{Name: "tags", Type: schema.Keyword, Stored: true},
+		{Name: "published", Type: schema.Date},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := newSchemaEngine(t, testOptions(t), s)
+	documents := []map[string]any{
+		{"title": "Binary search", "body": "halving a sorted array", "tags": []any{"algorithm", "go"}, "published": "2024-05-01T10:00:00Z"},
+		{"title": "Sorting", "body": "merge sort and binary heaps", "tags": []any{"algorithm"}},
+		{"title": "Go channels", "body": "search results sent over a channel", "tags": "go"},
+	}
+	for _, fields := range documents {
+		if _, err := engine.IndexFields(context.Background(), fields, Access{}); err != nil {
+			t.Fatalf("IndexFields(%v) = %v want <nil>", fields, err)
+		}
+	}
+	if _, err := engine.IndexDocument(context.Background(), "plain text"); !errors.Is(err, schema.ErrInvalidDocument) {
+		t.Errorf("IndexDocument() = %v want ErrInvalidDocument without a document field", err)
+	}
+
+	testCase := []struct {
+		query string
+		want  []int64
+	}{
+		// a title match is boosted over a body match
+		{"binary", []int64{1, 2}},
+		{"search", []int64{1, 3}},
+		{"title:binary", []int64{1}},
+		{"body:binary", []int64{2}},
+		{`body:"binary heaps"`, []int64{2}},
+		{"tags:go", []int64{1, 3}},
+		{"tags:algorithm -tags:go", []int64{2}},
+		{"go", []int64{3}},
+		{"tags:Go", []int64{}},
+		{"title:(go OR sort*)", []int64{2, 3}},
+		{"tags:al*", []int64{2, 1}},
+		{"published:2024-05-01T12:00:00+02:00", []int64{}},
+		{"published:2024-05-01T10:00:00Z", []int64{1}},
+	}
+	for _, test := range testCase {
+		result, err := engine.SearchDocument(context.Background(), test.query, SearchOptions{Limit: 10, SnippetSize: 10})
+		if err != nil {
+			t.Errorf("SearchDocument(%s) = %v want <nil>", test.query, err)
+			continue
+		}
+		got := make([]int64, 0, len(result.Documents))
+		for _, document := range result.Documents {
+			got = append(got, document.DocId)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("SearchDocument(%s) = %v want %v", test.query, got, test.want)
+		}
+	}
+
+	result, _ := engine.SearchDocument(context.Background(), "body:halving", SearchOptions{Limit: 10, SnippetSize: 10, PreTag: "[", PostTag: "]"})
+	document := result.Documents[0]
+	if document.Snippet != "[halving] a sorted array" {
+		t.Errorf("SearchDocument(body:halving) snippet = %q want the body", document.Snippet)
+	}
+	wantFields := map[string]any{"title": "Binary search", "body": "halving a sorted array", "tags": []string{"algorithm", "go"}}
+	if fmt.Sprint(document.Fields) != fmt.Sprint(wantFields) {
+		t.Errorf("SearchDocument(body:halving) fields = %v want %v", document.Fields, wantFields)
+	}
+
+	var syntaxErr *query.SyntaxError
+	if _, err := engine.SearchDocument(context.Background(), "binary author:jane", SearchOptions{}); !errors.As(err, &syntaxErr) || syntaxErr.Pos != 7 {
+		t.Errorf("SearchDocument(author:jane) = %v want unknown field at 7", err)
+	}
+}
+
+func TestIndexBatch(t *testing.T) {
+	engine := newTestEngine(t)
+	engine.IndexDocument(context.Background(), "sorted array")
+
+	items := engine.IndexBatch(context.Background(), []map[string]any{
+		{"document": "binary search in a sorted array"},
+		{"title": "unknown field"},
+		{"document": "the a"},
+		{"document": "merge sort of an array"},
+	}, Access{})
+	if items[0].DocId != 2 || items[3].DocId != 3 {
+		t.Errorf("IndexBatch() docIds = %d, %d want 2, 3", items[0].DocId, items[3].DocId)
+	}
+	if !errors.Is(items[1].Err, schema.ErrInvalidDocument) || !errors.Is(items[2].Err, ErrNoWords) {
+		t.Errorf("IndexBatch() errors = %v, %v want ErrInvalidDocument, ErrNoWords", items[1].Err, items[2].Err)
+	}
+	if got := search(t, engine, "array"); len(got) != 3 {
+		t.Errorf("SearchDocument(array) = %v want 3 documents", got)
+	}
+	if got := search(t, engine, `"sorted array"`); len(got) != 2 {
+		t.Errorf("SearchDocument(\"sorted array\") = %v want 2 documents", got)
+	}
+	if docId, _ := engine.IndexDocument(context.Background(), "next"); docId != 4 {
+		t.Errorf("IndexDocument() = %d want 4 after the batch", docId)
+	}
+
+	// a failed write rolls back the whole batch
+	store := engine.docRepo
+	engine.docRepo = failingStore{store}
+	items = engine.IndexBatch(context.Background(), []map[string]any{{"document": "lost array"}, {"document": "lost heap"}}, Access{})
+	engine.docRepo = store
+	if items[0].Err == nil || items[1].Err == nil {
+		t.Errorf("IndexBatch() = %v want every document failed", items)
+	}
+	if got := search(t, engine, "lost"); len(got) != 0 {
+		t.Errorf("SearchDocument(lost) = %v want []", got)
+	}
+}
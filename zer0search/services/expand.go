@@ -0,0 +1,145 @@
+package services
+
+import (
+	"log/slog"
+	"searchengine/query"
+	"searchengine/schema"
+	"strings"
+	"unicode/utf8"
+)
+
+// most terms a prefix, wildcard or fuzzy word expands to, the first ones in term order are kept
+var maxExpansions = 1024
+
+// stored terms of field starting with prefix
+func (v *evaluator) expandPrefix(field schema.Field, node query.Prefix) []string {
+	prefix := v.normalize(field, node.Text)
+	return v.expand(field, prefix, func(string) bool { return true })
+}
+
+// stored terms of field matching the pattern, only terms starting with the letters before the first wildcard are read
+func (v *evaluator) expandWildcard(field schema.Field, node query.Wildcard) []string {
+	pattern := v.normalize(field, node.Pattern)
+	prefix := pattern[:strings.IndexAny(pattern, "*?")]
+	return v.expand(field, prefix, func(term string) bool { return matchWildcard(pattern, term) })
+}
+
+// stored terms of field at most Distance edits away from the word
+func (v *evaluator) expandFuzzy(field schema.Field, node query.Fuzzy) []string {
+	word := v.normalize(field, node.Text)
+	return v.expand(field, "", func(term string) bool {
+		return levenshtein(word, term, node.Distance) <= node.Distance
+	})
+}
+
+// words of a text field are normalized like the analyzed ones, keywords and dates are exact
+func (v *evaluator) normalize(field schema.Field, text string) string {
+	if field.Type != schema.Text {
+		return text
+	}
+	return v.e.analyzer.Normalize(text)
+}
+
+// keys of the terms of field starting with prefix accepted by match, at most maxExpansions
+func (v *evaluator) expand(field schema.Field, prefix string, match func(term string) bool) []string {
+	terms := make([]string, 0)
+	err := v.e.indexRepo.Terms(v.e.schema.Key(field.Name, prefix), func(key string) bool {
+		name, term := v.e.schema.Split(key)
+		if name == field.Name && match(term) {
+			terms = append(terms, key)
+		}
+		return len(terms) < maxExpansions
+	})
+	if err != nil {
+		slog.ErrorContext(v.ctx, "[expand.go]		[expand()]	", "field", field.Name, "prefix", prefix, "err", err)
+	}
+	return terms
+}
+
+// docIds of any of the terms, scores of a docId found by several terms are added
+func (v *evaluator) terms(terms []string) []match {
+	v.highlight(terms...)
+	result := make([]match, 0)
+	for _, term := range terms {
+		postings := v.postings(term)
+		result = union(result, v.score(postings, uint64(len(postings))))
+	}
+	return result
+}
+
+// check if term matches pattern, * is any number of runes, ? is one rune
+func matchWildcard(pattern, term string) bool {
+	// backtrack to the last * when a rune does not match
+	star, starTerm := -1, 0
+	p, t := 0, 0
+	for t < len(term) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				star, starTerm = p, t
+				p++
+				continue
+			case '?':
+				_, size := utf8.DecodeRuneInString(term[t:])
+				p++
+				t += size
+				continue
+			default:
+				pr, psize := utf8.DecodeRuneInString(pattern[p:])
+				tr, tsize := utf8.DecodeRuneInString(term[t:])
+				if pr == tr {
+					p += psize
+					t += tsize
+					continue
+				}
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(term[starTerm:])
+		starTerm += size
+		p, t = star+1, starTerm
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// edit distance between the runes of a and b, any distance above limit is returned as limit + 1
+func levenshtein(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return min(prev[len(rb)], limit+1)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,48 @@
+package services
+
+import "testing"
+
+func TestMatchWildcard(t *testing.T) {
+	testCase := []struct {
+		pattern string
+		term    string
+		want    bool
+	}{
+		{"wild?card", "wildcard", false},
+		{"wild?card", "wild-card", true},
+		{"*ing", "running", true},
+		{"*ing", "ring", true},
+		{"*ing", "ringer", false},
+		{"r*n*g", "running", true},
+		{"caf?", "café", true},
+		{"a*", "a", true},
+		{"a?", "a", false},
+	}
+
+	for _, test := range testCase {
+		if got := matchWildcard(test.pattern, test.term); got != test.want {
+			t.Errorf("matchWildcard(%s, %s) = %v want %v", test.pattern, test.term, got, test.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	testCase := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"color", "colour", 2, 1},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 1, 2},
+		{"café", "cafe", 1, 1},
+		{"same", "same", 0, 0},
+		{"a", "abcd", 2, 3},
+	}
+
+	for _, test := range testCase {
+		if got := levenshtein(test.a, test.b, test.limit); got != test.want {
+			t.Errorf("levenshtein(%s, %s, %d) = %d want %d", test.a, test.b, test.limit, got, test.want)
+		}
+	}
+}
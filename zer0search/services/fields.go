@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"searchengine/query"
+	"searchengine/schema"
+	"searchengine/tokenizer"
+)
+
+// document docId read from the document store
+func (e *EngineService) document(ctx context.Context, docId int64) (schema.Document, error) {
+	stored, err := e.docRepo.Query(ctx, int(docId))
+	if err != nil {
+		return nil, err
+	}
+	return e.schema.Decode(stored)
+}
+
+/**
+words of every field of doc, as stored in the index, in order of first appearance
+	- a text field is analyzed, its words keep the token positions
+	- every value of a keyword or date field is one word, at the position of the value
+returns the words, the positions of each word and the document length (tokens of all fields)
+**/
+
+func (e *EngineService) documentWords(doc schema.Document) ([]string, map[string][]uint64, uint64) {
+	words := make([]string, 0)
+	positions := make(map[string][]uint64)
+	length := uint64(0)
+	for _, field := range e.schema.Fields {
+		for _, tok := range e.fieldTokens(field, doc[field.Name]...) {
+			key := e.schema.Key(field.Name, tok.Term)
+			if _, ok := positions[key]; !ok {
+				words = append(words, key)
+			}
+			positions[key] = append(positions[key], tok.Position)
+			length++
+		}
+	}
+	return words, positions, length
+}
+
+// tokens of the values of field, positions continue from one value to the next
+func (e *EngineService) fieldTokens(field schema.Field, values ...string) []tokenizer.Token {
+	tokens := make([]tokenizer.Token, 0)
+	for i, value := range values {
+		if field.Type != schema.Text {
+			tokens = append(tokens, tokenizer.Token{Term: value, Position: uint64(i), End: len(value)})
+			continue
+		}
+		tokens = append(tokens, e.analyzer.Analyze(value)...)
+	}
+	return tokens
+}
+
+// every field of a query must be in the schema
+func (e *EngineService) checkFields(node query.Node) error {
+	switch n := node.(type) {
+	case query.Field:
+		if _, ok := e.schema.Field(n.Name); !ok {
+			return &query.SyntaxError{Pos: n.Pos, Msg: fmt.Sprintf("unknown field %s", n.Name)}
+		}
+		return e.checkFields(n.Node)
+	case query.And:
+		for _, child := range n.Nodes {
+			if err := e.checkFields(child); err != nil {
+				return err
+			}
+		}
+	case query.Or:
+		for _, child := range n.Nodes {
+			if err := e.checkFields(child); err != nil {
+				return err
+			}
+		}
+	case query.Not:
+		return e.checkFields(n.Node)
+	}
+	return nil
+}
+
+// snippet of the text field with most distinct query words, the first text field if none has any
+func (e *EngineService) bestSnippet(doc schema.Document, words map[string]struct{}, opts SearchOptions) string {
+	best, bestWords := "", -1
+	for _, field := range e.schema.Fields {
+		values, ok := doc[field.Name]
+		if field.Type != schema.Text || !ok {
+			continue
+		}
+		snippet, found := e.snippet(values[0], field.Name, words, opts)
+		if found > bestWords {
+			best, bestWords = snippet, found
+		}
+	}
+	return best
+}
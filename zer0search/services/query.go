@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	memorymapper "searchengine/memory_mapper"
+	"searchengine/query"
+	"searchengine/schema"
+	"searchengine/tokenizer"
+	"sort"
+)
+
+// docId matched by a query node and its BM25 score
+// every list of matches is sorted by docId, so AND, OR and NOT are merges
+type match struct {
+	docId uint64
+	score float64
+}
+
+// evaluates a parsed query over the posting lists of one search
+type evaluator struct {
+	ctx         context.Context // of the search request, for logging
+	e           *EngineService
+	docs        uint64              // number of indexed documents
+	avgDocLen   float64             // average document length
+	highlighted map[string]struct{} // terms found by the query outside of NOT
+	negated     int                 // depth of NOT around the node being evaluated
+	field       string              // field of the node being evaluated, "" for every text field
+}
+
+func (e *EngineService) newEvaluator(ctx context.Context) *evaluator {
+	docs, totalLen := e.indexRepo.Stats()
+	return &evaluator{
+		ctx:         ctx,
+		e:           e,
+		docs:        docs,
+		avgDocLen:   float64(totalLen) / float64(max(docs, 1)),
+		highlighted: make(map[string]struct{}),
+	}
+}
+
+// matches of node, false if node has no word after tokenizing (ignored by its parent)
+// prefix, wildcard and fuzzy words expand to the stored terms they match
+func (v *evaluator) eval(node query.Node) ([]match, bool) {
+	switch n := node.(type) {
+	case query.Term:
+		return v.fields(func(field schema.Field) ([]match, bool) {
+			return v.words(field.Name, v.e.fieldTokens(field, n.Text), 0)
+		})
+	case query.Phrase:
+		return v.fields(func(field schema.Field) ([]match, bool) {
+			return v.words(field.Name, v.e.fieldTokens(field, n.Words), n.Slop)
+		})
+	case query.Prefix:
+		return v.fields(func(field schema.Field) ([]match, bool) {
+			return v.terms(v.expandPrefix(field, n)), true
+		})
+	case query.Wildcard:
+		return v.fields(func(field schema.Field) ([]match, bool) {
+			return v.terms(v.expandWildcard(field, n)), true
+		})
+	case query.Fuzzy:
+		return v.fields(func(field schema.Field) ([]match, bool) {
+			return v.terms(v.expandFuzzy(field, n)), true
+		})
+	case query.Field:
+		// fields are checked before evaluating
+		outer := v.field
+		v.field = n.Name
+		defer func() { v.field = outer }()
+		return v.eval(n.Node)
+	case query.And:
+		return v.and(n.Nodes)
+	case query.Or:
+		return v.or(n.Nodes)
+	case query.Not:
+		matches, ok := v.not(n.Node)
+		if !ok {
+			return nil, false
+		}
+		return difference(v.all(), matches), true
+	}
+	return nil, false
+}
+
+// matches of fn in the current field, or the union over every text field,
+// scores are multiplied by the boost of the field
+func (v *evaluator) fields(fn func(field schema.Field) ([]match, bool)) ([]match, bool) {
+	var result []match
+	found := false
+	for _, field := range v.e.schema.Fields {
+		if (v.field != "" && field.Name != v.field) || (v.field == "" && field.Type != schema.Text) {
+			continue
+		}
+		matches, ok := fn(field)
+		if !ok {
+			continue
+		}
+		for i := range matches {
+			matches[i].score *= field.Weight()
+		}
+		result, found = union(result, matches), true
+	}
+	return result, found
+}
+
+// intersect positive nodes, then remove NOT nodes
+// only NOT nodes are removed from every document
+func (v *evaluator) and(nodes []query.Node) ([]match, bool) {
+	var result []match
+	positive := false
+	negatives := make([][]match, 0)
+	for _, node := range nodes {
+		if not, ok := node.(query.Not); ok {
+			if matches, ok := v.not(not.Node); ok {
+				negatives = append(negatives, matches)
+			}
+			continue
+		}
+		matches, ok := v.eval(node)
+		if !ok {
+			continue
+		}
+		if !positive {
+			result, positive = matches, true
+			continue
+		}
+		result = intersect(result, matches)
+	}
+	if !positive && len(negatives) == 0 {
+		return nil, false
+	}
+	if !positive {
+		result = v.all()
+	}
+	for _, matches := range negatives {
+		result = difference(result, matches)
+	}
+	return result, true
+}
+
+// matches of a node under NOT, its words are not highlighted
+func (v *evaluator) not(node query.Node) ([]match, bool) {
+	v.negated++
+	defer func() { v.negated-- }()
+	return v.eval(node)
+}
+
+func (v *evaluator) or(nodes []query.Node) ([]match, bool) {
+	var result []match
+	found := false
+	for _, node := range nodes {
+		if matches, ok := v.eval(node); ok {
+			result, found = union(result, matches), true
+		}
+	}
+	return result, found
+}
+
+// one word is a term, more words (a phrase, or a term split by the analyzer) must match positions
+// the span between the first and the last word must match the span in the query, words removed
+// by the analyzer (stop words) still count
+// words are searched in field
+func (v *evaluator) words(field string, tokens []tokenizer.Token, slop int) ([]match, bool) {
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	keys := make([]string, len(tokens))
+	for i, tok := range tokens {
+		keys[i] = v.e.schema.Key(field, tok.Term)
+		v.highlight(keys[i])
+	}
+	if len(tokens) == 1 {
+		postings := v.postings(keys[0])
+		return v.score(postings, uint64(len(postings))), true
+	}
+	span := tokens[len(tokens)-1].Position - tokens[0].Position
+
+	// read the rarest word first, every next word only at the docIds found so far,
+	// segments jump over the others with their skip pointers
+	// only the first list is read whole, the document frequency of the others includes deleted docIds
+	freqs := make([]uint64, len(tokens))
+	order := make([]int, len(tokens))
+	for i, key := range keys {
+		freqs[i] = v.e.indexRepo.DocFreq(key)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return freqs[order[a]] < freqs[order[b]] })
+	lists := make([][]memorymapper.PostingEntry, len(tokens))
+	scores := make([][]match, len(tokens))
+	var docIds []uint64
+	for n, i := range order {
+		var postings []memorymapper.PostingEntry
+		if n == 0 {
+			postings = v.postings(keys[i])
+			freqs[i] = uint64(len(postings))
+		} else {
+			postings = v.postingsIn(keys[i], docIds)
+		}
+		if len(postings) == 0 {
+			return []match{}, true
+		}
+		lists[i] = postings
+		scores[i] = v.score(postings, freqs[i])
+		docIds = make([]uint64, 0, len(postings))
+		for _, posting := range postings {
+			docIds = append(docIds, posting.DocId)
+		}
+	}
+	result := make([]match, 0)
+	cursors := make([]int, len(lists))
+	positions := make([][]uint64, len(lists))
+	for cursors[0] < len(lists[0]) {
+		docId := lists[0][cursors[0]].DocId
+		common := true
+		for i := 1; i < len(lists); i++ {
+			for cursors[i] < len(lists[i]) && lists[i][cursors[i]].DocId < docId {
+				cursors[i]++
+			}
+			if cursors[i] == len(lists[i]) {
+				return result, true
+			}
+			if lists[i][cursors[i]].DocId != docId {
+				common = false
+			}
+		}
+		if common {
+			score := 0.0
+			for i := range lists {
+				positions[i] = lists[i][cursors[i]].Positions
+				score += scores[i][cursors[i]].score
+			}
+			if matchPositions(positions, span, slop) {
+				result = append(result, match{docId: docId, score: score})
+			}
+		}
+		cursors[0]++
+	}
+	return result, true
+}
+
+// postings of a word, a failed lookup is treated as no docIds
+// docIds from e.docId on are being indexed and not visible yet
+func (v *evaluator) postings(word string) []memorymapper.PostingEntry {
+	postings, err := v.e.indexRepo.GetPostings(word)
+	if err != nil {
+		slog.ErrorContext(v.ctx, "[query.go]		[postings()]	", "word", word, "err", err)
+		return []memorymapper.PostingEntry{}
+	}
+	for len(postings) > 0 && postings[len(postings)-1].DocId >= uint64(v.e.docId) {
+		postings = postings[:len(postings)-1]
+	}
+	return postings
+}
+
+// postings of a word at sorted docIds, already visible
+func (v *evaluator) postingsIn(word string, docIds []uint64) []memorymapper.PostingEntry {
+	postings, err := v.e.indexRepo.GetPostingsIn(word, docIds)
+	if err != nil {
+		slog.ErrorContext(v.ctx, "[query.go]		[postingsIn()]	", "word", word, "err", err)
+		return []memorymapper.PostingEntry{}
+	}
+	return postings
+}
+
+// BM25 score of every docId of a word found in df documents
+func (v *evaluator) score(postings []memorymapper.PostingEntry, df uint64) []match {
+	idf := v.e.ranker.IDF(df, v.docs)
+	matches := make([]match, 0, len(postings))
+	for _, posting := range postings {
+		docLen := v.e.indexRepo.Length(posting.DocId)
+		matches = append(matches, match{
+			docId: posting.DocId,
+			score: v.e.ranker.Score(idf, posting.Freq, docLen, v.avgDocLen),
+		})
+	}
+	return matches
+}
+
+// every indexed document with score 0, used by queries with only NOT
+func (v *evaluator) all() []match {
+	matches := make([]match, 0, v.docs)
+	for docId := uint64(1); docId < uint64(v.e.docId); docId++ {
+		if v.e.indexRepo.Length(docId) != 0 {
+			matches = append(matches, match{docId: docId})
+		}
+	}
+	return matches
+}
+
+// docIds in both lists, scores are added
+func intersect(a, b []match) []match {
+	result := make([]match, 0, min(len(a), len(b)))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i].docId < b[j].docId:
+			i++
+		case a[i].docId > b[j].docId:
+			j++
+		default:
+			result = append(result, match{docId: a[i].docId, score: a[i].score + b[j].score})
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// docIds in any list, scores of common docIds are added
+func union(a, b []match) []match {
+	result := make([]match, 0, max(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].docId < b[j].docId:
+			result = append(result, a[i])
+			i++
+		case a[i].docId > b[j].docId:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, match{docId: a[i].docId, score: a[i].score + b[j].score})
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
+
+// docIds of a not found in b
+func difference(a, b []match) []match {
+	result := make([]match, 0, len(a))
+	j := 0
+	for _, m := range a {
+		for j < len(b) && b[j].docId < m.docId {
+			j++
+		}
+		if j < len(b) && b[j].docId == m.docId {
+			continue
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+// check if the words appear in order and the span between the first and the last
+// differs from span by at most slop, lists[i] holds the sorted positions of the i-th word
+// for every position of the first word, take the nearest following position of each next word
+func matchPositions(lists [][]uint64, span uint64, slop int) bool {
+	for _, start := range lists[0] {
+		prev := start
+		for _, positions := range lists[1:] {
+			i := sort.Search(len(positions), func(i int) bool { return positions[i] > prev })
+			if i == len(positions) {
+				// a later start can not find a following position either
+				return false
+			}
+			prev = positions[i]
+		}
+		distance := int64(prev-start) - int64(span)
+		if distance >= -int64(slop) && distance <= int64(slop) {
+			return true
+		}
+	}
+	return false
+}
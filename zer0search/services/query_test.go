@@ -0,0 +1,58 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchPositions(t *testing.T) {
+	testCase := []struct {
+		lists [][]uint64
+		span  uint64
+		slop  int
+		want  bool
+	}{
+		{[][]uint64{{0}, {1}}, 1, 0, true},
+		{[][]uint64{{1}, {0}}, 1, 0, false},
+		{[][]uint64{{0}, {2}}, 1, 0, false},
+		{[][]uint64{{0}, {2}}, 1, 1, true},
+		{[][]uint64{{0, 7}, {4, 8}}, 1, 0, true},
+		{[][]uint64{{0}, {1}, {5}}, 2, 3, true},
+		{[][]uint64{{0}, {1}, {5}}, 2, 2, false},
+		{[][]uint64{{0, 2}, {1, 3}, {0, 2}}, 2, 0, true},
+		{[][]uint64{{0}, {}}, 1, 5, false},
+		// "state of the art" with stop words removed
+		{[][]uint64{{4}, {7}}, 3, 0, true},
+		{[][]uint64{{4}, {5}}, 3, 0, false},
+	}
+
+	for _, test := range testCase {
+		got := matchPositions(test.lists, test.span, test.slop)
+		if got != test.want {
+			t.Errorf("matchPositions(%v, %d, %d) = %v want %v", test.lists, test.span, test.slop, got, test.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := []match{{1, 1}, {3, 1}, {5, 1}}
+	b := []match{{3, 2}, {4, 2}, {5, 2}}
+
+	testCase := []struct {
+		name string
+		got  []match
+		want []match
+	}{
+		{"intersect", intersect(a, b), []match{{3, 3}, {5, 3}}},
+		{"union", union(a, b), []match{{1, 1}, {3, 3}, {4, 2}, {5, 3}}},
+		{"difference", difference(a, b), []match{{1, 1}}},
+		{"intersect empty", intersect(a, []match{}), []match{}},
+		{"difference empty", difference(a, nil), a},
+	}
+
+	for _, test := range testCase {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s = %v want %v", test.name, test.got, test.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"html"
+	"searchengine/auth"
+	"searchengine/tokenizer"
+	"strings"
+)
+
+// page and snippet settings of a search
+type SearchOptions struct {
+	Limit       int       // documents in a page
+	Offset      int       // documents skipped before the page
+	SnippetSize int       // tokens in a snippet
+	PreTag      string    // written before every highlighted word
+	PostTag     string    // written after every highlighted word
+	User        auth.User // finds public documents and its own, an admin finds every document
+}
+
+/**
+1. Analyze the text of field, a token is a hit when its word in field is a query word
+2. For each hit, count the distinct query words and the hits in the SnippetSize positions from it
+3. Take the window with most distinct words, then most hits, then the first one
+4. Move the window back by a quarter to show the words before the first hit,
+   and further when the document ends before the window does
+5. Cut the document at the token offsets and wrap hits in PreTag, PostTag,
+   the text is HTML escaped so only the tags are markup
+
+returns the snippet and the number of distinct query words in it
+**/
+
+func (e *EngineService) snippet(document string, field string, words map[string]struct{}, opts SearchOptions) (string, int) {
+	tokens := e.analyzer.Analyze(document)
+	if len(tokens) == 0 {
+		return "", 0
+	}
+	hit := func(tok tokenizer.Token) bool {
+		_, ok := words[e.schema.Key(field, tok.Term)]
+		return ok
+	}
+	size := uint64(max(opts.SnippetSize, 1))
+
+	best, bestWords, bestHits := 0, 0, 0
+	for i, tok := range tokens {
+		if !hit(tok) {
+			continue
+		}
+		seen := make(map[string]struct{})
+		hits := 0
+		for j := i; j < len(tokens) && tokens[j].Position < tok.Position+size; j++ {
+			if hit(tokens[j]) {
+				seen[tokens[j].Term] = struct{}{}
+				hits++
+			}
+		}
+		if len(seen) > bestWords || (len(seen) == bestWords && hits > bestHits) {
+			best, bestWords, bestHits = i, len(seen), hits
+		}
+	}
+
+	start := best
+	for start > 0 && tokens[best].Position-tokens[start-1].Position <= size/4 {
+		start--
+	}
+	end := start
+	for end+1 < len(tokens) && tokens[end+1].Position < tokens[start].Position+size {
+		end++
+	}
+	// a window cut short by the end of the document takes the words before it
+	for start > 0 && tokens[end].Position-tokens[start-1].Position < size {
+		start--
+	}
+
+	from, to := tokens[start].Start, tokens[end].End
+	if start == 0 {
+		from = 0
+	}
+	if end == len(tokens)-1 {
+		to = len(document)
+	}
+	var builder strings.Builder
+	if from > 0 {
+		builder.WriteString("…")
+	}
+	prev := from
+	for _, tok := range tokens[start : end+1] {
+		if !hit(tok) {
+			continue
+		}
+		builder.WriteString(html.EscapeString(document[prev:tok.Start]))
+		builder.WriteString(opts.PreTag)
+		builder.WriteString(html.EscapeString(document[tok.Start:tok.End]))
+		builder.WriteString(opts.PostTag)
+		prev = tok.End
+	}
+	builder.WriteString(html.EscapeString(document[prev:to]))
+	if to < len(document) {
+		builder.WriteString("…")
+	}
+	return strings.TrimSpace(builder.String()), bestWords
+}
+
+// keep the words of the query which are not under NOT, the ones a snippet highlights
+// terms are keys of schema.Key()
+func (v *evaluator) highlight(terms ...string) {
+	if v.negated > 0 {
+		return
+	}
+	for _, term := range terms {
+		v.highlighted[term] = struct{}{}
+	}
+}
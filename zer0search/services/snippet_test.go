@@ -0,0 +1,39 @@
+package services
+
+import (
+	"searchengine/schema"
+	"testing"
+)
+
+func TestSnippet(t *testing.T) {
+	engine := newTestEngine(t)
+	document := "Binary search finds an item in a sorted array by halving the search interval until the item is found"
+	words := map[string]struct{}{"sort": {}, "arrai": {}}
+
+	testCase := []struct {
+		size int
+		want string
+	}{
+		{4, "…[sorted] [array] by halving…"}, // stop words keep their positions
+		{2, "…[sorted] [array]…"},
+		{100, "Binary search finds an item in a [sorted] [array] by halving the search interval until the item is found"},
+	}
+
+	for _, test := range testCase {
+		got, _ := engine.snippet(document, schema.DefaultField, words, SearchOptions{SnippetSize: test.size, PreTag: "[", PostTag: "]"})
+		if got != test.want {
+			t.Errorf("snippet(%d) = %q want %q", test.size, got, test.want)
+		}
+	}
+
+	// document text is escaped, the tags are not
+	escaped := "a <b> sorted & unsorted array"
+	want := "a &lt;b&gt; <em>sorted</em> &amp; unsorted <em>array</em>"
+	if got, _ := engine.snippet(escaped, schema.DefaultField, words, SearchOptions{SnippetSize: 100, PreTag: "<em>", PostTag: "</em>"}); got != want {
+		t.Errorf("snippet(%q) = %q want %q", escaped, got, want)
+	}
+
+	if got, _ := engine.snippet("halving the interval", schema.DefaultField, words, SearchOptions{SnippetSize: 2}); got != "halving…" {
+		t.Errorf("snippet(no hits) = %q want %q", got, "halving…")
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	memorymapper "searchengine/memory_mapper"
+	"searchengine/metrics"
+	"slices"
+)
+
+// usage of the index reported by Stats()
+type IndexStats struct {
+	Documents   uint64                      `json:"documents"`   // indexed documents, deleted ones left out
+	Deleted     uint64                      `json:"deleted"`     // deleted docIds
+	Vocabulary  uint64                      `json:"vocabulary"`  // words with a live docId
+	Terms       uint64                      `json:"terms"`       // words of terms.index, a word of deleted documents only is kept
+	LiveBytes   uint64                      `json:"liveBytes"`   // posting bytes of every segment holding live docIds
+	DeadBytes   uint64                      `json:"deadBytes"`   // posting bytes of deleted docIds, dropped by the next merge
+	BufferDocs  uint64                      `json:"bufferDocs"`  // documents not flushed to a segment
+	BufferBytes uint64                      `json:"bufferBytes"` // compressed size of their postings
+	MaxFileSize uint64                      `json:"maxFileSize"` // size no index file grows past
+	Segments    []memorymapper.SegmentStats `json:"segments"`
+	Files       []memorymapper.FileStats    `json:"files"`
+	TopTerms    []TermStats                 `json:"topTerms"` // words of the most live docIds
+}
+
+type TermStats struct {
+	Term    string `json:"term"`
+	DocFreq uint64 `json:"docFreq"` // live docIds of the term
+}
+
+// a posting of a term as stored, Segment is "buffer" for the documents not flushed
+type TermPosting struct {
+	Segment   string   `json:"segment"`
+	DocId     uint64   `json:"docId"`
+	Freq      uint64   `json:"freq"`
+	Positions []uint64 `json:"positions"`
+	Deleted   bool     `json:"deleted"` // skipped by searches until a merge drops it
+}
+
+var ErrTermNotFound = errors.New("term not found")
+
+/**
+1. Walk every segment and the buffer, count the live docIds of each word and the posting bytes of deleted docIds
+2. Find the text of the words in terms.index, keep the top words by document frequency
+3. Stat the index files against MaxFileSize
+
+writes wait until the walk is done, searches run along
+**/
+
+func (e *EngineService) Stats(ctx context.Context, top int) (IndexStats, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return IndexStats{}, ErrClosed
+	}
+	repoStats, err := e.indexRepo.Inspect()
+	if err != nil {
+		slog.ErrorContext(ctx, "[stats.go]		[Stats()]	", "err", err)
+		return IndexStats{}, err
+	}
+	stats := IndexStats{
+		Deleted:     repoStats.Deleted,
+		Vocabulary:  uint64(len(repoStats.DocFreq)),
+		Terms:       repoStats.Terms,
+		BufferDocs:  repoStats.BufferDocs,
+		BufferBytes: repoStats.BufferBytes,
+		MaxFileSize: repoStats.MaxFileSize,
+		Segments:    repoStats.Segments,
+		Files:       repoStats.Files,
+		TopTerms:    []TermStats{},
+	}
+	stats.Documents, _ = e.indexRepo.Stats()
+	for _, segment := range repoStats.Segments {
+		stats.LiveBytes += segment.LiveBytes
+		stats.DeadBytes += segment.DeadBytes
+	}
+
+	if top <= 0 {
+		return stats, nil
+	}
+	terms := make([]TermStats, 0)
+	if err := e.indexRepo.Terms("", func(term string) bool {
+		if df := repoStats.DocFreq[memorymapper.WordKey(term)]; df > 0 {
+			terms = append(terms, TermStats{Term: term, DocFreq: df})
+		}
+		return true
+	}); err != nil {
+		slog.ErrorContext(ctx, "[stats.go]		[Stats()]	", "err", err)
+		return stats, err
+	}
+	// terms are walked in order, the stable sort keeps ties alphabetical
+	slices.SortStableFunc(terms, func(a, b TermStats) int {
+		return cmp.Compare(b.DocFreq, a.DocFreq)
+	})
+	stats.TopTerms = terms[:min(top, len(terms))]
+	return stats, nil
+}
+
+// every posting of term in the segments and the buffer, deleted docIds included
+// term is a word as stored in the index, field:word for a field of the schema
+func (e *EngineService) TermPostings(ctx context.Context, term string) ([]TermPosting, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return nil, ErrClosed
+	}
+	postings, err := e.indexRepo.Postings(term)
+	if err != nil {
+		slog.ErrorContext(ctx, "[stats.go]		[TermPostings()]	", "term", term, "err", err)
+		return nil, err
+	}
+	result := make([]TermPosting, 0)
+	for _, segment := range postings {
+		for _, entry := range segment.Entries {
+			result = append(result, TermPosting{
+				Segment:   segment.Segment,
+				DocId:     entry.DocId,
+				Freq:      entry.Freq,
+				Positions: entry.Positions,
+				Deleted:   !e.indexRepo.Exists(entry.DocId),
+			})
+		}
+	}
+	if len(result) == 0 {
+		return nil, ErrTermNotFound
+	}
+	return result, nil
+}
+
+// sizes of the index read by every scrape of GET /metrics, without walking the postings
+func (e *EngineService) Sizes() (metrics.IndexSizes, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return metrics.IndexSizes{}, ErrClosed
+	}
+	files, err := e.indexRepo.Files()
+	if err != nil {
+		return metrics.IndexSizes{}, err
+	}
+	sizes := metrics.IndexSizes{
+		MaxFileSize: e.indexRepo.MaxFileSize(),
+		Files:       files,
+	}
+	sizes.Documents, _ = e.indexRepo.Stats()
+	for _, segment := range e.indexRepo.Segments() {
+		sizes.Segments++
+		sizes.SegmentBytes += segment.Bytes
+	}
+	_, sizes.BufferBytes = e.indexRepo.BufferStats()
+	return sizes, nil
+}
@@ -0,0 +1,213 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"searchengine/utils"
+	"strings"
+)
+
+// text -> char filters -> tokenizer -> token filters -> tokens
+// indexing and searching must analyze with the same chain, so the chain of an index is stored with it
+
+// word found in a text
+// Position is the index of the token in the text before token filters dropped any,
+// Start and End are byte offsets of the token in the text
+type Token struct {
+	Term     string
+	Position uint64
+	Start    int
+	End      int
+}
+
+type Analyzer interface {
+	Analyze(text string) []Token
+	// apply only the filters which change letters (lowercase, folding) to a term,
+	// used for prefix, wildcard and fuzzy words which are not split or stemmed
+	Normalize(term string) string
+}
+
+// rewrite the text before it is split, the byte offsets of the text must be kept
+type CharFilter interface {
+	Filter(text string) string
+}
+
+// split the text into tokens
+type Tokenizer interface {
+	Tokenize(text string) []Token
+}
+
+// change or drop tokens
+type TokenFilter interface {
+	Filter(tokens []Token) []Token
+}
+
+// token filter changing the letters of a single term
+type Normalizer interface {
+	Normalize(term string) string
+}
+
+// names of the char filters, tokenizer and token filters of an analyzer, stored as json
+type Config struct {
+	CharFilters  []string `json:"charFilters"`
+	Tokenizer    string   `json:"tokenizer"`
+	TokenFilters []string `json:"tokenFilters"`
+}
+
+// analyzers known by name
+var configs = map[string]Config{
+	// the tokenizer of the first versions, kept for indexes built by them
+	"simple": {
+		Tokenizer:    "whitespace",
+		TokenFilters: []string{"lowercase", "trim_punctuation"},
+	},
+	"standard": {
+		Tokenizer:    "unicode",
+		TokenFilters: []string{"lowercase", "ascii_folding"},
+	},
+	"english": {
+		Tokenizer:    "unicode",
+		TokenFilters: []string{"lowercase", "ascii_folding", "stop", "porter"},
+	},
+}
+
+var (
+	charFilters = map[string]CharFilter{
+		"html_strip": htmlStrip{},
+	}
+	tokenizers = map[string]Tokenizer{
+		"whitespace": whitespace{},
+		"unicode":    unicodeWords{},
+	}
+	tokenFilters = map[string]TokenFilter{
+		"lowercase":        lowercase{},
+		"trim_punctuation": trimPunctuation{},
+		"ascii_folding":    asciiFolding{},
+		"stop":             stopWords{words: englishStopWords},
+		"porter":           porter{},
+	}
+)
+
+// chain of char filters, a tokenizer and token filters
+type Chain struct {
+	config       Config
+	charFilters  []CharFilter
+	tokenizer    Tokenizer
+	tokenFilters []TokenFilter
+}
+
+// analyzer registered under name, or the chain written in name, see ParseConfig()
+func Named(name string) (*Chain, error) {
+	config, err := ParseConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewChain(config)
+}
+
+// config of an analyzer name, or of a chain written as charFilters|tokenizer|tokenFilters
+// filters are separated by commas and may be left out, html_strip|unicode|lowercase,ascii_folding
+func ParseConfig(name string) (Config, error) {
+	if config, ok := configs[name]; ok {
+		return config, nil
+	}
+	parts := strings.Split(name, "|")
+	if len(parts) != 3 {
+		return Config{}, fmt.Errorf("unknown analyzer %s, use simple, standard, english or charFilters|tokenizer|tokenFilters", name)
+	}
+	list := func(part string) []string {
+		names := make([]string, 0)
+		for _, name := range strings.Split(part, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return Config{
+		CharFilters:  list(parts[0]),
+		Tokenizer:    strings.TrimSpace(parts[1]),
+		TokenFilters: list(parts[2]),
+	}, nil
+}
+
+// analyzer built from the names in config
+func NewChain(config Config) (*Chain, error) {
+	chain := &Chain{config: config}
+	for _, name := range config.CharFilters {
+		filter, ok := charFilters[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown char filter %s", name)
+		}
+		chain.charFilters = append(chain.charFilters, filter)
+	}
+	tokenizer, ok := tokenizers[config.Tokenizer]
+	if !ok {
+		return nil, fmt.Errorf("unknown tokenizer %s", config.Tokenizer)
+	}
+	chain.tokenizer = tokenizer
+	for _, name := range config.TokenFilters {
+		filter, ok := tokenFilters[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown token filter %s", name)
+		}
+		chain.tokenFilters = append(chain.tokenFilters, filter)
+	}
+	return chain, nil
+}
+
+func (c *Chain) Analyze(text string) []Token {
+	for _, filter := range c.charFilters {
+		text = filter.Filter(text)
+	}
+	tokens := c.tokenizer.Tokenize(text)
+	for _, filter := range c.tokenFilters {
+		tokens = filter.Filter(tokens)
+	}
+	return tokens
+}
+
+func (c *Chain) Normalize(term string) string {
+	for _, filter := range c.tokenFilters {
+		if normalizer, ok := filter.(Normalizer); ok {
+			term = normalizer.Normalize(term)
+		}
+	}
+	return term
+}
+
+func (c *Chain) Config() Config {
+	return c.config
+}
+
+// analyzer stored at path, or the analyzer of name stored at path when there is none yet
+// a stored analyzer is never replaced, the index must be rebuilt to change it
+func Load(path string, name string) (*Chain, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		chain, err := Named(name)
+		if err != nil {
+			return nil, err
+		}
+		return chain, Save(path, chain)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s : %w", path, err)
+	}
+	return NewChain(config)
+}
+
+// store the config of chain at path, a crash leaves the previous file or the new one
+func Save(path string, chain *Chain) error {
+	data, err := json.MarshalIndent(chain.config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, data)
+}
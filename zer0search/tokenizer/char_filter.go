@@ -0,0 +1,31 @@
+package tokenizer
+
+import "strings"
+
+// replace html tags and entities with spaces, byte offsets of the text are kept
+type htmlStrip struct{}
+
+func (htmlStrip) Filter(text string) string {
+	var builder strings.Builder
+	builder.Grow(len(text))
+	for i := 0; i < len(text); {
+		end := -1
+		switch text[i] {
+		case '<':
+			end = strings.IndexByte(text[i:], '>')
+		case '&':
+			end = strings.IndexByte(text[i:], ';')
+			if end > 10 || strings.ContainsAny(text[i:i+max(end, 0)], " \t\n") {
+				end = -1
+			}
+		}
+		if end < 0 {
+			builder.WriteByte(text[i])
+			i++
+			continue
+		}
+		builder.WriteString(strings.Repeat(" ", end+1))
+		i += end + 1
+	}
+	return builder.String()
+}
@@ -0,0 +1,300 @@
+package tokenizer
+
+// Porter stemming algorithm, M.F. Porter, 1980, "An algorithm for suffix stripping"
+// follows the reference C implementation, words which are not lowercase ascii are not changed
+
+type stemmer struct {
+	b []byte // word being stemmed, b[0..k]
+	k int    // end of the word
+	j int    // end of the stem, set by ends()
+}
+
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	s := &stemmer{b: []byte(word), k: len(word) - 1}
+	s.step1ab()
+	if s.k > 0 {
+		s.step1c()
+		s.step2()
+		s.step3()
+		s.step4()
+		s.step5()
+	}
+	return string(s.b[:s.k+1])
+}
+
+// check if b[i] is a consonant
+func (s *stemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		if i == 0 {
+			return true
+		}
+		return !s.cons(i - 1)
+	}
+	return true
+}
+
+// number of consonant sequences in b[0..j]
+// <c><v> -> 0, <c>vc<v> -> 1, <c>vcvc<v> -> 2 ...
+func (s *stemmer) m() int {
+	n, i := 0, 0
+	for {
+		if i > s.j {
+			return n
+		}
+		if !s.cons(i) {
+			break
+		}
+		i++
+	}
+	i++
+	for {
+		for {
+			if i > s.j {
+				return n
+			}
+			if s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+		n++
+		for {
+			if i > s.j {
+				return n
+			}
+			if !s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+	}
+}
+
+// check if b[0..j] has a vowel
+func (s *stemmer) vowelInStem() bool {
+	for i := 0; i <= s.j; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// check if b[i-1..i] is a double consonant
+func (s *stemmer) doublec(i int) bool {
+	if i < 1 || s.b[i] != s.b[i-1] {
+		return false
+	}
+	return s.cons(i)
+}
+
+// check if b[i-2..i] is consonant vowel consonant and the last one is not w, x or y
+// used to restore an e at the end of a short word, cav(e), lov(e), hop(e), crim(e), but snow, box, tray
+func (s *stemmer) cvc(i int) bool {
+	if i < 2 || !s.cons(i) || s.cons(i-1) || !s.cons(i-2) {
+		return false
+	}
+	switch s.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// check if b[0..k] ends with suffix, sets j to the end of the stem
+func (s *stemmer) ends(suffix string) bool {
+	l := len(suffix)
+	if l > s.k+1 || string(s.b[s.k-l+1:s.k+1]) != suffix {
+		return false
+	}
+	s.j = s.k - l
+	return true
+}
+
+// replace b[j+1..k] with str
+func (s *stemmer) setto(str string) {
+	s.b = append(s.b[:s.j+1], str...)
+	s.k = s.j + len(str)
+}
+
+func (s *stemmer) r(str string) {
+	if s.m() > 0 {
+		s.setto(str)
+	}
+}
+
+// replace the first suffix of rules found at the end of the word
+// rules are [suffix, replacement] pairs
+func (s *stemmer) replace(rules ...string) {
+	for i := 0; i+1 < len(rules); i += 2 {
+		if s.ends(rules[i]) {
+			s.r(rules[i+1])
+			return
+		}
+	}
+}
+
+// plurals and -ed or -ing
+// caresses -> caress, ponies -> poni, cats -> cat, feed -> feed, agreed -> agree,
+// plastered -> plaster, motoring -> motor, hopping -> hop, filing -> file
+func (s *stemmer) step1ab() {
+	if s.b[s.k] == 's' {
+		switch {
+		case s.ends("sses"):
+			s.k -= 2
+		case s.ends("ies"):
+			s.setto("i")
+		case s.b[s.k-1] != 's':
+			s.k--
+		}
+	}
+	if s.ends("eed") {
+		if s.m() > 0 {
+			s.k--
+		}
+		return
+	}
+	if (s.ends("ed") || s.ends("ing")) && s.vowelInStem() {
+		s.k = s.j
+		switch {
+		case s.ends("at"):
+			s.setto("ate")
+		case s.ends("bl"):
+			s.setto("ble")
+		case s.ends("iz"):
+			s.setto("ize")
+		case s.doublec(s.k):
+			s.k--
+			switch s.b[s.k] {
+			case 'l', 's', 'z':
+				s.k++
+			}
+		default:
+			s.j = s.k
+			if s.m() == 1 && s.cvc(s.k) {
+				s.setto("e")
+			}
+		}
+	}
+}
+
+// y -> i when there is another vowel in the stem, happy -> happi
+func (s *stemmer) step1c() {
+	if s.ends("y") && s.vowelInStem() {
+		s.b[s.k] = 'i'
+	}
+}
+
+// double suffixes to single ones when m() > 0, relational -> relate, digitizer -> digitize
+func (s *stemmer) step2() {
+	switch s.b[s.k-1] {
+	case 'a':
+		s.replace("ational", "ate", "tional", "tion")
+	case 'c':
+		s.replace("enci", "ence", "anci", "ance")
+	case 'e':
+		s.replace("izer", "ize")
+	case 'l':
+		s.replace("bli", "ble", "alli", "al", "entli", "ent", "eli", "e", "ousli", "ous")
+	case 'o':
+		s.replace("ization", "ize", "ation", "ate", "ator", "ate")
+	case 's':
+		s.replace("alism", "al", "iveness", "ive", "fulness", "ful", "ousness", "ous")
+	case 't':
+		s.replace("aliti", "al", "iviti", "ive", "biliti", "ble")
+	case 'g':
+		s.replace("logi", "log")
+	}
+}
+
+// -ic-, -full, -ness etc. when m() > 0, triplicate -> triplic, hopeful -> hope
+func (s *stemmer) step3() {
+	switch s.b[s.k] {
+	case 'e':
+		s.replace("icate", "ic", "ative", "", "alize", "al")
+	case 'i':
+		s.replace("iciti", "ic")
+	case 'l':
+		s.replace("ical", "ic", "ful", "")
+	case 's':
+		s.replace("ness", "")
+	}
+}
+
+// -ant, -ence etc. when m() > 1, allowance -> allow, adjustment -> adjust
+func (s *stemmer) step4() {
+	var suffixes []string
+	switch s.b[s.k-1] {
+	case 'a':
+		suffixes = []string{"al"}
+	case 'c':
+		suffixes = []string{"ance", "ence"}
+	case 'e':
+		suffixes = []string{"er"}
+	case 'i':
+		suffixes = []string{"ic"}
+	case 'l':
+		suffixes = []string{"able", "ible"}
+	case 'n':
+		suffixes = []string{"ant", "ement", "ment", "ent"}
+	case 'o':
+		if s.ends("ion") && s.j >= 0 && (s.b[s.j] == 's' || s.b[s.j] == 't') {
+			break
+		}
+		suffixes = []string{"ou"}
+	case 's':
+		suffixes = []string{"ism"}
+	case 't':
+		suffixes = []string{"ate", "iti"}
+	case 'u':
+		suffixes = []string{"ous"}
+	case 'v':
+		suffixes = []string{"ive"}
+	case 'z':
+		suffixes = []string{"ize"}
+	default:
+		return
+	}
+	if suffixes != nil {
+		found := false
+		for _, suffix := range suffixes {
+			if s.ends(suffix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+	if s.m() > 1 {
+		s.k = s.j
+	}
+}
+
+// remove a final -e when m() > 1, and -ll -> -l when m() > 1, probate -> probat, controll -> control
+func (s *stemmer) step5() {
+	s.j = s.k
+	if s.b[s.k] == 'e' {
+		a := s.m()
+		if a > 1 || (a == 1 && !s.cvc(s.k-1)) {
+			s.k--
+		}
+	}
+	if s.b[s.k] == 'l' && s.doublec(s.k) && s.m() > 1 {
+		s.k--
+	}
+}
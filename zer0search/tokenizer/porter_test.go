@@ -0,0 +1,45 @@
+package tokenizer
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	testCase := []struct {
+		word string
+		want string
+	}{
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"cats", "cat"},
+		{"feed", "feed"},
+		{"agreed", "agre"},
+		{"plastered", "plaster"},
+		{"motoring", "motor"},
+		{"sing", "sing"},
+		{"conflated", "conflat"},
+		{"hopping", "hop"},
+		{"falling", "fall"},
+		{"filing", "file"},
+		{"happy", "happi"},
+		{"sky", "sky"},
+		{"relational", "relat"},
+		{"conditional", "condit"},
+		{"digitizer", "digit"},
+		{"generalization", "gener"},
+		{"hopefulness", "hope"},
+		{"triplicate", "triplic"},
+		{"electrical", "electr"},
+		{"allowance", "allow"},
+		{"adjustment", "adjust"},
+		{"adoption", "adopt"},
+		{"controll", "control"},
+		{"running", "run"},
+		{"is", "is"},
+		{"café", "café"},
+	}
+
+	for _, test := range testCase {
+		if got := Stem(test.word); got != test.want {
+			t.Errorf("Stem(%s) = %s want %s", test.word, got, test.want)
+		}
+	}
+}
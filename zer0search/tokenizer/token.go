@@ -3,50 +3,130 @@ package tokenizer
 import (
 	"strings"
 	"unicode"
+
+	"golang.org/x/text/unicode/norm"
 )
 
-type Token struct {
-	Tokens []string
+// token filters change a term in place or drop the token, positions of the tokens left are kept
+
+type lowercase struct{}
+
+func (lowercase) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = strings.ToLower(tokens[i].Term)
+	}
+	return tokens
 }
 
-// Remove leading and tailing punctuation
-func (t *Token) removePunctuation() {
-	tok := make([]string, 0, len(t.Tokens))
-	for _, token := range t.Tokens {
-		token = cleanToken(token)
-		if len(token) != 0 {
-			tok = append(tok, token)
+func (lowercase) Normalize(term string) string {
+	return strings.ToLower(term)
+}
+
+// remove leading and tailing punctuation, drop tokens left empty
+type trimPunctuation struct{}
+
+func (trimPunctuation) Filter(tokens []Token) []Token {
+	kept := tokens[:0]
+	for _, token := range tokens {
+		term := cleanToken(token.Term)
+		if len(term) == 0 {
+			continue
 		}
+		// keep offsets on the word left
+		token.Start += strings.Index(token.Term, term)
+		token.End = token.Start + len(term)
+		token.Term = term
+		kept = append(kept, token)
 	}
-	t.Tokens = tok
+	return kept
+}
+
+func cleanToken(token string) string {
+	return strings.TrimFunc(token, unicode.IsPunct)
+}
+
+// fold letters to their ascii form, é -> e, ß -> ss
+type asciiFolding struct{}
+
+// letters without a decomposition to ascii
+var foldings = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+	'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D", 'þ': "th", 'Þ': "TH", 'ð': "d", 'Ð': "D", 'ı': "i",
 }
 
-func (t *Token) toLower() {
-	for i := range t.Tokens {
-		t.Tokens[i] = strings.ToLower(t.Tokens[i])
+func (asciiFolding) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = fold(tokens[i].Term)
 	}
+	return tokens
 }
 
-func cleanToken(token string) string {
-	start, end := 0, len(token)-1
-	for i := 0; i < len(token); i++ {
-		if unicode.IsPunct(rune(token[i])) {
-			continue
+func (asciiFolding) Normalize(term string) string {
+	return fold(term)
+}
+
+// decompose, drop combining marks, map the letters left
+func fold(term string) string {
+	ascii := true
+	for i := 0; i < len(term); i++ {
+		if term[i] >= 0x80 {
+			ascii = false
+			break
 		}
-		start = i
-		break
 	}
-	for i := len(token) - 1; i >= 0; i-- {
-		if unicode.IsPunct(rune(token[i])) {
+	if ascii {
+		return term
+	}
+	var builder strings.Builder
+	builder.Grow(len(term))
+	for _, r := range norm.NFD.String(term) {
+		if unicode.Is(unicode.Mn, r) {
 			continue
 		}
-		end = i
-		break
+		if folded, ok := foldings[r]; ok {
+			builder.WriteString(folded)
+			continue
+		}
+		builder.WriteRune(r)
 	}
+	return norm.NFC.String(builder.String())
+}
 
-	var builder strings.Builder
-	for i := start; i <= end; i++ {
-		builder.WriteRune(rune(token[i]))
+// drop common words, filter after lowercase
+type stopWords struct {
+	words map[string]struct{}
+}
+
+func (s stopWords) Filter(tokens []Token) []Token {
+	kept := tokens[:0]
+	for _, token := range tokens {
+		if _, ok := s.words[token.Term]; !ok {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
+
+var englishStopWords = toSet([]string{
+	"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if", "in", "into", "is", "it",
+	"no", "not", "of", "on", "or", "such", "that", "the", "their", "then", "there", "these",
+	"they", "this", "to", "was", "will", "with",
+})
+
+func toSet(words []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		set[word] = struct{}{}
+	}
+	return set
+}
+
+// reduce english words to their stem, filter after lowercase
+type porter struct{}
+
+func (porter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = Stem(tokens[i].Term)
 	}
-	return builder.String()
+	return tokens
 }
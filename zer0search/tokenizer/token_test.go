@@ -1 +1,43 @@
 package tokenizer
+
+import "testing"
+
+func TestCleanToken(t *testing.T) {
+	testCase := []struct {
+		token string
+		want  string
+	}{
+		{"hello", "hello"},
+		{"(hello)", "hello"},
+		{"«héllo»", "héllo"},
+		{"¿qué?", "qué"},
+		{"don't!", "don't"},
+		{"...", ""},
+	}
+
+	for _, test := range testCase {
+		if got := cleanToken(test.token); got != test.want {
+			t.Errorf("cleanToken(%s) = %s want %s", test.token, got, test.want)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	testCase := []struct {
+		term string
+		want string
+	}{
+		{"plain", "plain"},
+		{"crème", "creme"},
+		{"ÅNGSTRÖM", "ANGSTROM"},
+		{"straße", "strasse"},
+		{"łódź", "lodz"},
+		{"日本", "日本"},
+	}
+
+	for _, test := range testCase {
+		if got := fold(test.term); got != test.want {
+			t.Errorf("fold(%s) = %s want %s", test.term, got, test.want)
+		}
+	}
+}
@@ -1,15 +1,87 @@
 package tokenizer
 
-import "strings"
-
-func GetTokens(msg string) Token {
-	if len(msg) == 0 {
-		return Token{}
-	}
-	msg = strings.TrimSpace(msg)
-	var token Token
-	token.Tokens = strings.Fields(msg)
-	token.toLower()
-	token.removePunctuation()
-	return token
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// split on white space, like strings.Fields
+type whitespace struct{}
+
+func (whitespace) Tokenize(text string) []Token {
+	tokens := make([]Token, 0)
+	start := -1
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				tokens = append(tokens, Token{Term: text[start:i], Position: uint64(len(tokens)), Start: start, End: i})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, Token{Term: text[start:], Position: uint64(len(tokens)), Start: start, End: len(text)})
+	}
+	return tokens
+}
+
+// unicode word segmentation, a simplified UAX #29
+// a word is a run of letters, digits and marks (any script),
+// joined by an apostrophe or period between letters (don't, e.g) and by a period or comma between digits (3.14, 1,000)
+// or by an underscore (snake_case)
+type unicodeWords struct{}
+
+func (unicodeWords) Tokenize(text string) []Token {
+	tokens := make([]Token, 0)
+	start := -1
+	var prev rune
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case isWordRune(r):
+		case start >= 0 && r == '_':
+		case start >= 0 && joinsWord(prev, r, text[i+size:]):
+		default:
+			if start >= 0 {
+				tokens = append(tokens, Token{Term: text[start:i], Position: uint64(len(tokens)), Start: start, End: i})
+				start = -1
+			}
+			prev = r
+			i += size
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		prev = r
+		i += size
+	}
+	if start >= 0 {
+		tokens = append(tokens, Token{Term: text[start:], Position: uint64(len(tokens)), Start: start, End: len(text)})
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// check if r, between prev and the text after it, stays inside a word
+func joinsWord(prev, r rune, rest string) bool {
+	next, _ := utf8.DecodeRuneInString(rest)
+	switch r {
+	case '\'', '’', '.':
+		if unicode.IsLetter(prev) && unicode.IsLetter(next) {
+			return true
+		}
+	}
+	switch r {
+	case '.', ',':
+		return unicode.IsDigit(prev) && unicode.IsDigit(next)
+	}
+	return false
 }
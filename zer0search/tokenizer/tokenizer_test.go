@@ -1 +1,117 @@
-package tokenizer
\ No newline at end of file
+package tokenizer
+
+import (
+	"path/filepath"
+	"reflect"
+	"searchengine/utils"
+	"testing"
+)
+
+func terms(tokens []Token) []string {
+	got := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		got = append(got, token.Term)
+	}
+	return got
+}
+
+func TestWhitespace(t *testing.T) {
+	tokens := whitespace{}.Tokenize("  hello,  wörld\tfoo ")
+	want := []Token{
+		{Term: "hello,", Position: 0, Start: 2, End: 8},
+		{Term: "wörld", Position: 1, Start: 10, End: 16},
+		{Term: "foo", Position: 2, Start: 17, End: 20},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Tokenize() = %v want %v", tokens, want)
+	}
+}
+
+func TestUnicodeWords(t *testing.T) {
+	testCase := []struct {
+		text string
+		want []string
+	}{
+		{"Hello, world!", []string{"Hello", "world"}},
+		{"don't stop e.g. now", []string{"don't", "stop", "e.g", "now"}},
+		{"pi is 3.14, not 1,000.", []string{"pi", "is", "3.14", "not", "1,000"}},
+		{"snake_case (tag)", []string{"snake_case", "tag"}},
+		{"naïve café", []string{"naïve", "café"}},
+		{"Привет мир", []string{"Привет", "мир"}},
+		{"'quoted'", []string{"quoted"}},
+		{"", []string{}},
+	}
+
+	for _, test := range testCase {
+		if got := terms(unicodeWords{}.Tokenize(test.text)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Tokenize(%s) = %q want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestHtmlStrip(t *testing.T) {
+	text := "<b>bold</b> &amp; text"
+	got := htmlStrip{}.Filter(text)
+	if want := "   bold     &amp; text"; len(got) != len(text) || got[:11] != want[:11] {
+		t.Errorf("Filter(%s) = %q want %q", text, got, want)
+	}
+	if got := terms(unicodeWords{}.Tokenize(got)); !reflect.DeepEqual(got, []string{"bold", "text"}) {
+		t.Errorf("Tokenize() = %q want [bold text]", got)
+	}
+}
+
+func TestAnalyzers(t *testing.T) {
+	testCase := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"simple", "Hello, Wörld! ...", []string{"hello", "wörld"}},
+		{"standard", "Crème Brûlée, STRASSE straße", []string{"creme", "brulee", "strasse", "strasse"}},
+		{"english", "The runners are running to the stations", []string{"runner", "run", "station"}},
+		{"html_strip|unicode|lowercase", "<p>Hello</p> &amp; World", []string{"hello", "world"}},
+		{"|whitespace|", "Hello, World", []string{"Hello,", "World"}},
+	}
+
+	for _, test := range testCase {
+		analyzer, err := Named(test.name)
+		if err != nil {
+			t.Fatalf("Named(%s) = %v want <nil>", test.name, err)
+		}
+		if got := terms(analyzer.Analyze(test.text)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s Analyze(%s) = %q want %q", test.name, test.text, got, test.want)
+		}
+	}
+
+	// stop words keep the positions of the words after them
+	analyzer, _ := Named("english")
+	tokens := analyzer.Analyze("state of the art")
+	if len(tokens) != 2 || tokens[0].Position != 0 || tokens[1].Position != 3 {
+		t.Errorf("Analyze(state of the art) = %v want positions 0, 3", tokens)
+	}
+
+	if _, err := NewChain(Config{Tokenizer: "unicode", TokenFilters: []string{"missing"}}); err == nil {
+		t.Errorf("NewChain() = <nil> want error for an unknown token filter")
+	}
+	for _, name := range []string{"html", "html_strip|unicode", "html_strip||lowercase"} {
+		if _, err := Named(name); err == nil {
+			t.Errorf("Named(%s) = <nil> want error", name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analyzer.json")
+	analyzer, err := Load(path, "html_strip|unicode|lowercase,ascii_folding")
+	if err != nil {
+		t.Fatalf("Load(%s) = %v want <nil>", path, err)
+	}
+	if utils.FileExists(path + ".tmp") {
+		t.Errorf("Load(%s) left %s.tmp", path, path)
+	}
+	// the stored chain wins over the analyzer of a new index
+	stored, err := Load(path, "simple")
+	if err != nil || !reflect.DeepEqual(stored.Config(), analyzer.Config()) {
+		t.Errorf("Load(%s) = %+v, %v want %+v", path, stored.Config(), err, analyzer.Config())
+	}
+}
@@ -19,6 +19,13 @@ func NewHash() *Hash {
 	}
 }
 
+// hash of a second seed, words with the same hash of NewHash() almost never share it
+func NewCheckHash() *Hash {
+	return &Hash{
+		h: xxhash.NewWithSeed(checkSeed),
+	}
+}
+
 func (h *Hash) WriteString(msg string) error {
 	if _, err := h.h.WriteString(msg); err != nil {
 		return err
@@ -1,6 +1,7 @@
 package utils
 
-var (
-	seed uint64 = 6483064366178809867
-	Path string
-)
+// seed of every word hash, the index files store the hashes so it never changes
+const seed uint64 = 6483064366178809867
+
+// seed of the check hash, independent of seed, telling apart words with the same hash
+const checkSeed uint64 = 11400714819323198485